@@ -1,8 +1,10 @@
 // app/providers/ApolloProvider.js
 'use client';
 
-import { ApolloClient, InMemoryCache, createHttpLink, ApolloProvider } from '@apollo/client';
+import { ApolloClient, InMemoryCache, createHttpLink, ApolloProvider, from, fromPromise } from '@apollo/client';
 import { setContext } from '@apollo/client/link/context';
+import { onError } from '@apollo/client/link/error';
+import { getAccessToken, hasRefreshToken, isAuthenticationError, refreshAccessToken } from '../../lib/authTokens';
 
 export function ApolloWrapper({ children }) {
   // Create the HTTP link
@@ -11,10 +13,10 @@ export function ApolloWrapper({ children }) {
   });
 
   // Add authentication link
-  const authLink = setContext((_, { headers }) => {
-    // Get token from localStorage
-    const token = localStorage.getItem('token');
-    
+  const authLink = setContext(async (_, { headers }) => {
+    // Get a token, refreshed first if it is about to expire
+    const token = await getAccessToken();
+
     return {
       headers: {
         ...headers,
@@ -23,9 +25,25 @@ export function ApolloWrapper({ children }) {
     };
   });
 
+  // Retry an operation once with a fresh token if the API no longer accepts
+  // the one it was sent with
+  const refreshLink = onError(({ graphQLErrors, operation, forward }) => {
+    const unauthenticated = graphQLErrors?.some(e => isAuthenticationError(e.message));
+    if (!unauthenticated || operation.getContext().retriedAfterRefresh || !hasRefreshToken()) {
+      return;
+    }
+
+    return fromPromise(refreshAccessToken())
+      .filter(Boolean)
+      .flatMap(() => {
+        operation.setContext({ retriedAfterRefresh: true });
+        return forward(operation);
+      });
+  });
+
   // Create Apollo Client instance
   const client = new ApolloClient({
-    link: authLink.concat(httpLink),
+    link: from([refreshLink, authLink, httpLink]),
     cache: new InMemoryCache()
   });
 
@@ -34,4 +52,4 @@ export function ApolloWrapper({ children }) {
       {children}
     </ApolloProvider>
   );
-}
\ No newline at end of file
+}
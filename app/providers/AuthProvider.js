@@ -3,12 +3,15 @@
 
 import { createContext, useContext, useState, useEffect } from 'react';
 import { useMutation, useLazyQuery, gql } from '@apollo/client';
+import { clearTokens, storeTokens } from '../../lib/authTokens';
 
 // GraphQL Queries & Mutations
 const LOGIN_MUTATION = gql`
   mutation Login($input: LoginInput!) {
     login(input: $input) {
       token
+      refreshToken
+      expiresAt
       user {
         id
         email
@@ -25,6 +28,8 @@ const REGISTER_MUTATION = gql`
   mutation Register($input: RegisterInput!) {
     register(input: $input) {
       token
+      refreshToken
+      expiresAt
       user {
         id
         email
@@ -96,7 +101,7 @@ export function AuthProvider({ children }) {
         return { success: true, user: data.me };
       } else {
         setUser(null);
-        localStorage.removeItem('token');
+        clearTokens();
         return { success: false, message: 'Invalid token' };
       }
     } catch (err) {
@@ -125,10 +130,8 @@ export function AuthProvider({ children }) {
         // Store user data
         setUser(data.login.user);
         
-        // Store token in localStorage
-        if (data.login.token) {
-          localStorage.setItem('token', data.login.token);
-        }
+        // Store tokens in localStorage
+        storeTokens(data.login);
         
         return { 
           success: true, 
@@ -156,7 +159,10 @@ export function AuthProvider({ children }) {
       
       const { data } = await registerMutation({
         variables: {
-          input: userData
+          input: {
+            email: userData.email,
+            password: userData.password
+          }
         }
       });
       
@@ -164,10 +170,8 @@ export function AuthProvider({ children }) {
         // Store user data
         setUser(data.register.user);
         
-        // Store token in localStorage
-        if (data.register.token) {
-          localStorage.setItem('token', data.register.token);
-        }
+        // Store tokens in localStorage
+        storeTokens(data.register);
         
         return { 
           success: true, 
@@ -195,16 +199,16 @@ export function AuthProvider({ children }) {
       // Clear user data
       setUser(null);
       
-      // Remove token from localStorage
-      localStorage.removeItem('token');
+      // Remove tokens from localStorage
+      clearTokens();
       
       return { success: true };
     } catch (err) {
       console.error('Logout error:', err);
       setError(err.message);
       
-      // Still remove token on error
-      localStorage.removeItem('token');
+      // Still remove tokens on error
+      clearTokens();
       setUser(null);
       
       return { success: false, error: err.message };
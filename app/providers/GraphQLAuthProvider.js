@@ -2,6 +2,7 @@
 
 import { createContext, useContext, useState, useEffect } from 'react';
 import { graphqlRequest, LOGIN_MUTATION, REGISTER_MUTATION, ME_QUERY } from '../../lib/graphqlClient';
+import { clearTokens, getAccessToken, storeTokens } from '../../lib/authTokens';
 
 const AuthContext = createContext({
   user: null,
@@ -23,8 +24,8 @@ export function AuthProvider({ children }) {
     try {
       setLoading(true);
       
-      // Get token from localStorage
-      const token = typeof window !== 'undefined' ? localStorage.getItem('token') : null;
+      // Get token from localStorage, refreshed first if it is about to expire
+      const token = await getAccessToken();
       
       if (!token) {
         setUser(null);
@@ -39,14 +40,14 @@ export function AuthProvider({ children }) {
         return { success: true, user: data.me };
       } else {
         setUser(null);
-        localStorage.removeItem('token');
+        clearTokens();
         return { success: false, message: 'Session expired or invalid' };
       }
     } catch (err) {
       console.error('Auth check error:', err);
       setError(err.message);
       setUser(null);
-      localStorage.removeItem('token');
+      clearTokens();
       return { success: false, error: err.message };
     } finally {
       setLoading(false);
@@ -70,15 +71,13 @@ export function AuthProvider({ children }) {
         throw new Error('Login failed');
       }
       
-      const { token, user, setupRequired, nextStep } = data.login;
+      const { user, setupRequired, nextStep } = data.login;
       
       // Store user data
       setUser(user);
       
-      // Store token in localStorage
-      if (token) {
-        localStorage.setItem('token', token);
-      }
+      // Store tokens in localStorage
+      storeTokens(data.login);
       
       return { 
         success: true, 
@@ -101,12 +100,12 @@ export function AuthProvider({ children }) {
       setLoading(true);
       setError(null);
       
-      // Prepare input for GraphQL mutation
+      // Prepare input for GraphQL mutation. The role is not chosen here:
+      // whoever registers becomes the owner of the organisation they create.
       const variables = {
         input: {
           email: userData.email,
-          password: userData.password,
-          role: userData.role || 'admin'
+          password: userData.password
         }
       };
       
@@ -117,15 +116,13 @@ export function AuthProvider({ children }) {
         throw new Error('Registration failed');
       }
       
-      const { token, user, setupRequired, nextStep } = data.register;
+      const { user, setupRequired, nextStep } = data.register;
       
       // Store user data
       setUser(user);
       
-      // Store token in localStorage
-      if (token) {
-        localStorage.setItem('token', token);
-      }
+      // Store tokens in localStorage
+      storeTokens(data.register);
       
       return { 
         success: true, 
@@ -150,16 +147,16 @@ export function AuthProvider({ children }) {
       // Clear user data
       setUser(null);
       
-      // Remove token from localStorage
-      localStorage.removeItem('token');
+      // Remove tokens from localStorage
+      clearTokens();
       
       return { success: true };
     } catch (err) {
       console.error('Logout error:', err);
       setError(err.message);
       
-      // Still remove token on error
-      localStorage.removeItem('token');
+      // Still remove tokens on error
+      clearTokens();
       setUser(null);
       
       return { success: false, error: err.message };
@@ -9,8 +9,7 @@ export default function RegisterPage() {
   const [formData, setFormData] = useState({
     email: '',
     password: '',
-    confirmPassword: '',
-    role: 'admin'
+    confirmPassword: ''
   });
   const [error, setError] = useState('');
   const { register, loading, user } = useAuth();
@@ -46,8 +45,7 @@ export default function RegisterPage() {
     // Register using GraphQL
     const result = await register({
       email: formData.email,
-      password: formData.password,
-      role: formData.role
+      password: formData.password
     });
     
     if (result.success) {
@@ -0,0 +1,129 @@
+// Command migrate-storage copies uploaded document files from one storage
+// backend to another, e.g. from local disk to an S3 bucket.
+//
+// Both backends are configured through the usual environment variables
+// (UPLOAD_DIR for local, S3_* for S3). Document records only hold the
+// storage key, so once the copy succeeds switching STORAGE_BACKEND is enough.
+//
+//	go run ./cmd/migrate-storage -from local -to s3
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"strings"
+
+	"github.com/joho/godotenv"
+
+	"crmgo/internal/config"
+	"crmgo/internal/database"
+	"crmgo/internal/models"
+	"crmgo/internal/storage"
+	"crmgo/internal/tenant"
+)
+
+func main() {
+	from := flag.String("from", storage.BackendLocal, "backend to copy files from (local or s3)")
+	to := flag.String("to", storage.BackendS3, "backend to copy files to (local or s3)")
+	dryRun := flag.Bool("dry-run", false, "list the files that would be copied without copying them")
+	deleteSource := flag.Bool("delete-source", false, "delete each file from the source backend once it has been copied")
+	flag.Parse()
+
+	if err := godotenv.Load(); err != nil {
+		log.Println("No .env file found, using environment variables")
+	}
+
+	if strings.EqualFold(*from, *to) {
+		log.Fatalf("Source and destination backends must differ")
+	}
+
+	cfg := config.LoadConfig()
+
+	db, err := database.InitDB(cfg.DatabasePath)
+	if err != nil {
+		log.Fatalf("Failed to connect to database: %v", err)
+	}
+
+	source, err := storage.NewBackend(*from, cfg)
+	if err != nil {
+		log.Fatalf("Failed to initialize %s storage: %v", *from, err)
+	}
+	destination, err := storage.NewBackend(*to, cfg)
+	if err != nil {
+		log.Fatalf("Failed to initialize %s storage: %v", *to, err)
+	}
+
+	// Soft-deleted documents are included so they can still be restored after
+	// the move, and documents of every organisation are migrated
+	var documents []models.Document
+	if err := db.WithContext(tenant.WithoutScope(context.Background())).Unscoped().Where("storage_key IS NOT NULL AND storage_key <> ''").Order("id").Find(&documents).Error; err != nil {
+		log.Fatalf("Failed to load documents: %v", err)
+	}
+
+	log.Printf("Migrating %d stored files from %s to %s", len(documents), *from, *to)
+
+	ctx := context.Background()
+	copied, failed := 0, 0
+	for _, document := range documents {
+		key := *document.StorageKey
+
+		if *dryRun {
+			log.Printf("Would copy document %d: %s", document.ID, key)
+			continue
+		}
+
+		if err := copyBlob(ctx, source, destination, document); err != nil {
+			log.Printf("Failed to copy document %d (%s): %v", document.ID, key, err)
+			failed++
+			continue
+		}
+		copied++
+
+		if *deleteSource {
+			if err := source.Delete(ctx, key); err != nil {
+				log.Printf("Copied document %d but failed to delete the source file: %v", document.ID, err)
+			}
+		}
+	}
+
+	log.Printf("Copied %d files, %d failed", copied, failed)
+	if failed > 0 {
+		log.Fatalf("Storage migration incomplete; fix the errors above and run it again")
+	}
+}
+
+// copyBlob copies one document's file between backends, verifying the
+// recorded checksum when there is one
+func copyBlob(ctx context.Context, source, destination storage.BlobStore, document models.Document) error {
+	key := *document.StorageKey
+
+	reader, err := source.Get(ctx, key)
+	if err != nil {
+		return err
+	}
+	defer reader.Close()
+
+	contentType := ""
+	if document.FileType != nil {
+		contentType = *document.FileType
+	}
+
+	hasher := sha256.New()
+	if err := destination.Put(ctx, key, io.TeeReader(reader, hasher), contentType); err != nil {
+		return err
+	}
+
+	if document.Checksum != nil && *document.Checksum != "" {
+		if sum := hex.EncodeToString(hasher.Sum(nil)); sum != *document.Checksum {
+			destination.Delete(ctx, key)
+			return fmt.Errorf("checksum mismatch: expected %s, got %s", *document.Checksum, sum)
+		}
+	}
+
+	return nil
+}
@@ -2,28 +2,26 @@ package main
 
 import (
 	"context"
-	"encoding/json"
-	"fmt"
-	"io"
 	"log"
+	"net"
 	"net/http"
 	"os"
 	"os/signal"
 	"strings"
 	"syscall"
 	"time"
+	_ "time/tzdata" // Organisation time zones are checked against the IANA database, which slim images lack
 
-	"github.com/99designs/gqlgen/graphql"
-	"github.com/99designs/gqlgen/graphql/handler"
 	"github.com/99designs/gqlgen/graphql/playground"
-	"github.com/golang-jwt/jwt/v5"
 	"github.com/joho/godotenv"
 	//"gorm.io/gorm"
 	
+	"crmgo/internal/auth"
 	"crmgo/internal/config"
 	"crmgo/internal/database"
-	"crmgo/internal/graphql/generated"
 	"crmgo/internal/graphql/resolvers"
+	"crmgo/internal/services"
+	"crmgo/internal/storage"
 )
 
 func main() {
@@ -34,6 +32,9 @@ func main() {
 
 	// Initialize configuration
 	cfg := config.LoadConfig()
+	if err := cfg.Validate(); err != nil {
+		log.Fatalf("Invalid configuration: %v", err)
+	}
 
 	// Initialize database connection
 	db, err := database.InitDB(cfg.DatabasePath)
@@ -42,16 +43,30 @@ func main() {
 	}
 	log.Println("Database connection established to SQLite at", cfg.DatabasePath)
 
+	// Initialize email service
+	emailService := services.NewEmailService(cfg.EmailAPIKey, cfg.EmailSender, "CRM Dashboard")
+
+	// Initialize document blob storage
+	blobStore, err := storage.New(cfg)
+	if err != nil {
+		log.Fatalf("Failed to initialize %s storage: %v", cfg.StorageBackend, err)
+	}
+	log.Println("Document storage backend:", cfg.StorageBackend)
+
+	// Initialize access token signing
+	tokens, err := auth.NewTokensFromConfig(cfg)
+	if err != nil {
+		log.Fatalf("Failed to initialize token signing: %v", err)
+	}
+
 	// Create a resolver instance using the proper resolver type
-	resolver := resolvers.NewResolver(db, cfg.JWTSecret)
+	resolver := resolvers.NewResolver(db, cfg, emailService, blobStore, tokens)
+
+	// Authenticate requests by access token or API key
+	authenticator := auth.NewAuthenticator(tokens, resolver.IsSessionActive, resolver.AuthenticateAPIKey)
 
 	// Create GraphQL server
-	srv := handler.NewDefaultServer(generated.NewExecutableSchema(generated.Config{
-		Resolvers: resolver,
-		Directives: generated.DirectiveRoot{
-			Auth: authDirective,
-		},
-	}))
+	srv := resolver.GraphQLServer()
 
 	// Create GraphQL playground handler
 	playgroundHandler := playground.Handler("GraphQL Playground", "/graphql")
@@ -59,42 +74,15 @@ func main() {
 	// Set up routes with standard library
 	mux := http.NewServeMux()
 
-	// Add GraphQL endpoint with middleware chain
-	graphqlHandler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		// Special handling for introspection queries and health checks
-		if r.Method == "POST" {
-			bodyBytes, _ := io.ReadAll(r.Body)
-			r.Body.Close()
-			
-			// Restore the body for later use
-			r.Body = io.NopCloser(strings.NewReader(string(bodyBytes)))
-			
-			var requestBody struct {
-				Query string `json:"query"`
-			}
-			
-			if err := json.Unmarshal(bodyBytes, &requestBody); err == nil {
-				// Skip auth for introspection and health queries
-				if strings.Contains(requestBody.Query, "__schema") || 
-				   strings.Contains(requestBody.Query, "query Health") || 
-				   strings.Contains(requestBody.Query, "health") {
-					// Skip authentication for these queries
-					srv.ServeHTTP(w, r)
-					return
-				}
-			}
-			
-			// For all other queries, apply auth middleware
-			authMiddleware(http.HandlerFunc(srv.ServeHTTP), cfg.JWTSecret).ServeHTTP(w, r)
-			return
-		}
-		
-		// Handle other methods
-		srv.ServeHTTP(w, r)
-	})
+	// Add GraphQL endpoint with middleware chain. Authentication is optional
+	// here: public operations such as login work without a token, and the
+	// schema's @public, @auth and @hasRole directives enforce access per field.
+	// Each request gets its own data loaders to batch related-item lookups.
+	graphqlHandler := authenticator.Optional(resolver.DataLoaders(srv))
 	
 	// Apply middleware chain - Fix the type assertion errors by applying middleware directly
 	var graphqlWithMiddleware http.Handler = graphqlHandler
+	graphqlWithMiddleware = clientIPMiddleware(graphqlWithMiddleware, cfg.TrustProxyHeaders)
 	graphqlWithMiddleware = loggingMiddleware(graphqlWithMiddleware)
 	graphqlWithMiddleware = corsMiddleware(graphqlWithMiddleware)
 	mux.Handle("/graphql", graphqlWithMiddleware)
@@ -104,7 +92,31 @@ func main() {
 	playgroundWithMiddleware = loggingMiddleware(playgroundWithMiddleware)
 	playgroundWithMiddleware = corsMiddleware(playgroundWithMiddleware)
 	mux.Handle("/playground", playgroundWithMiddleware)
+
+	// Add authenticated document downloads with middleware
+	var downloadWithMiddleware http.Handler = resolver.DocumentDownloadHandler()
+	downloadWithMiddleware = authenticator.Require(downloadWithMiddleware)
+	downloadWithMiddleware = loggingMiddleware(downloadWithMiddleware)
+	downloadWithMiddleware = corsMiddleware(downloadWithMiddleware)
+	mux.Handle("/documents/{id}/download", downloadWithMiddleware)
+	
+	// Add single sign-on endpoints with middleware; the browser is sent
+	// here, so no CORS is needed
+	var ssoLoginWithMiddleware http.Handler = resolver.SSOLoginHandler()
+	ssoLoginWithMiddleware = loggingMiddleware(ssoLoginWithMiddleware)
+	mux.Handle("/auth/oidc/login", ssoLoginWithMiddleware)
+
+	var ssoCallbackWithMiddleware http.Handler = resolver.SSOCallbackHandler()
+	ssoCallbackWithMiddleware = clientIPMiddleware(ssoCallbackWithMiddleware, cfg.TrustProxyHeaders)
+	ssoCallbackWithMiddleware = loggingMiddleware(ssoCallbackWithMiddleware)
+	mux.Handle("/auth/oidc/callback", ssoCallbackWithMiddleware)
 	
+	// Publish the token verification keys for other services
+	var jwksWithMiddleware http.Handler = tokens.JWKSHandler()
+	jwksWithMiddleware = loggingMiddleware(jwksWithMiddleware)
+	jwksWithMiddleware = corsMiddleware(jwksWithMiddleware)
+	mux.Handle("/.well-known/jwks.json", jwksWithMiddleware)
+
 	// Add health check with middleware
 	healthHandler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		w.Header().Set("Content-Type", "application/json")
@@ -137,6 +149,11 @@ func main() {
 		serverErrors <- server.ListenAndServe()
 	}()
 
+	// Delete organisations whose grace period has passed
+	purgeCtx, stopPurge := context.WithCancel(context.Background())
+	defer stopPurge()
+	go purgeDeletedOrganisations(purgeCtx, resolver)
+
 	// Graceful shutdown
 	shutdown := make(chan os.Signal, 1)
 	signal.Notify(shutdown, os.Interrupt, syscall.SIGTERM)
@@ -162,62 +179,55 @@ func main() {
 	}
 }
 
-// authDirective implements the @auth directive for GraphQL
-func authDirective(ctx context.Context, obj interface{}, next graphql.Resolver) (interface{}, error) {
-	// Get user ID from context and use it in the condition
-	userID, ok := ctx.Value("userId").(uint)
-	if !ok || userID == 0 {
-		return nil, fmt.Errorf("access denied: not authenticated")
+// purgeDeletedOrganisations deletes organisations whose grace period has
+// passed, once at startup and then every hour until ctx is cancelled
+func purgeDeletedOrganisations(ctx context.Context, resolver *resolvers.Resolver) {
+	ticker := time.NewTicker(time.Hour)
+	defer ticker.Stop()
+
+	for {
+		if _, err := resolver.PurgeDeletedOrganisations(ctx); err != nil {
+			log.Printf("Failed to delete organisations: %v", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
 	}
-	
-	return next(ctx)
 }
 
-// authMiddleware adds authentication to an http.Handler
-func authMiddleware(next http.Handler, jwtSecret string) http.Handler {
+// clientIPMiddleware records the caller's IP address in the request context.
+// Proxy headers are only honoured when the server runs behind a trusted proxy,
+// otherwise clients could pick their own address.
+func clientIPMiddleware(next http.Handler, trustProxyHeaders bool) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		// Get the Authorization header
-		authHeader := r.Header.Get("Authorization")
-		
-		// Check if auth required and token provided
-		if authHeader == "" || !strings.HasPrefix(authHeader, "Bearer ") {
-			http.Error(w, `{"error":"Authentication required"}`, http.StatusUnauthorized)
-			return
-		}
-		
-		// Extract and validate token
-		tokenString := strings.TrimPrefix(authHeader, "Bearer ")
-		token, err := jwt.Parse(tokenString, func(token *jwt.Token) (interface{}, error) {
-			if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
-				return nil, fmt.Errorf("unexpected signing method")
+		ctx := auth.WithClientIP(r.Context(), clientIP(r, trustProxyHeaders))
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// clientIP works out the IP address a request came from
+func clientIP(r *http.Request, trustProxyHeaders bool) string {
+	if trustProxyHeaders {
+		// The last X-Forwarded-For entry is the one added by our own proxy
+		if forwarded := r.Header.Get("X-Forwarded-For"); forwarded != "" {
+			parts := strings.Split(forwarded, ",")
+			if ip := strings.TrimSpace(parts[len(parts)-1]); ip != "" {
+				return ip
 			}
-			return []byte(jwtSecret), nil
-		})
-		
-		if err != nil || !token.Valid {
-			http.Error(w, `{"error":"Invalid token"}`, http.StatusUnauthorized)
-			return
 		}
-		
-		// Extract claims
-		claims, ok := token.Claims.(jwt.MapClaims)
-		if !ok {
-			http.Error(w, `{"error":"Invalid token claims"}`, http.StatusUnauthorized)
-			return
-		}
-		
-		// Add user info to context
-		ctx := context.WithValue(r.Context(), "userId", uint(claims["id"].(float64)))
-		ctx = context.WithValue(ctx, "userEmail", claims["email"])
-		ctx = context.WithValue(ctx, "userRole", claims["role"])
-		
-		if orgId, ok := claims["organisation_id"].(float64); ok {
-			ctx = context.WithValue(ctx, "organisationId", uint(orgId))
+		if ip := strings.TrimSpace(r.Header.Get("X-Real-IP")); ip != "" {
+			return ip
 		}
-		
-		// Call the next handler with updated context
-		next.ServeHTTP(w, r.WithContext(ctx))
-	})
+	}
+
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
 }
 
 // CORS middleware to allow requests from all origins
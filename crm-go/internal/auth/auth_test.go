@@ -0,0 +1,416 @@
+package auth
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"crmgo/internal/models"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+const (
+	testIssuer   = "crm-go"
+	testAudience = "crm-dashboard"
+)
+
+func newTestTokens(t *testing.T, signing *Key, retired ...*Key) *Tokens {
+	t.Helper()
+	keys, err := NewKeySet(signing, retired...)
+	if err != nil {
+		t.Fatalf("key set: %v", err)
+	}
+	return NewTokens(keys, testIssuer, testAudience)
+}
+
+func testClaims() Claims {
+	orgID, teamMemberID := uint(7), uint(9)
+	claims := Claims{UserID: 3, Email: "jane@example.com", Role: models.RoleAgent, OrganisationID: &orgID, TeamMemberID: &teamMemberID}
+	claims.ID = "session-1"
+	return claims
+}
+
+// sign signs arbitrary claims with an HMAC secret, for tokens Issue would
+// never make
+func sign(t *testing.T, method jwt.SigningMethod, kid, secret string, claims jwt.MapClaims) string {
+	t.Helper()
+	token := jwt.NewWithClaims(method, claims)
+	if kid != "" {
+		token.Header["kid"] = kid
+	}
+	signed, err := token.SignedString([]byte(secret))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return signed
+}
+
+func TestIssueAndVerify(t *testing.T) {
+	tokens := newTestTokens(t, HMACKey("k1", "secret-1"))
+
+	raw, err := tokens.Issue(testClaims(), time.Now().Add(time.Minute))
+	if err != nil {
+		t.Fatalf("Issue: %v", err)
+	}
+	claims, err := tokens.Verify(raw)
+	if err != nil {
+		t.Fatalf("Verify: %v", err)
+	}
+
+	p := claims.Principal()
+	want := Principal{UserID: 3, Email: "jane@example.com", OrganisationID: 7, Role: models.RoleAgent, TeamMemberID: 9, Method: MethodSession, SessionID: "session-1"}
+	if p.UserID != want.UserID || p.Email != want.Email || p.OrganisationID != want.OrganisationID || p.Role != want.Role ||
+		p.TeamMemberID != want.TeamMemberID || p.Method != want.Method || p.SessionID != want.SessionID {
+		t.Errorf("principal = %+v, want %+v", *p, want)
+	}
+}
+
+func TestVerifyRejectsInvalidTokens(t *testing.T) {
+	tokens := newTestTokens(t, HMACKey("k1", "secret-1"))
+
+	valid := func() jwt.MapClaims {
+		return jwt.MapClaims{
+			"id":  3,
+			"jti": "session-1",
+			"iss": testIssuer,
+			"aud": testAudience,
+			"iat": time.Now().Unix(),
+			"exp": time.Now().Add(time.Minute).Unix(),
+		}
+	}
+	if _, err := tokens.Verify(sign(t, jwt.SigningMethodHS256, "k1", "secret-1", valid())); err != nil {
+		t.Fatalf("valid token rejected: %v", err)
+	}
+
+	tests := []struct {
+		name  string
+		token func() string
+	}{
+		{"wrong issuer", func() string {
+			claims := valid()
+			claims["iss"] = "someone-else"
+			return sign(t, jwt.SigningMethodHS256, "k1", "secret-1", claims)
+		}},
+		{"wrong audience", func() string {
+			claims := valid()
+			claims["aud"] = "another-app"
+			return sign(t, jwt.SigningMethodHS256, "k1", "secret-1", claims)
+		}},
+		{"expired", func() string {
+			claims := valid()
+			claims["exp"] = time.Now().Add(-time.Hour).Unix()
+			return sign(t, jwt.SigningMethodHS256, "k1", "secret-1", claims)
+		}},
+		{"no expiry", func() string {
+			claims := valid()
+			delete(claims, "exp")
+			return sign(t, jwt.SigningMethodHS256, "k1", "secret-1", claims)
+		}},
+		{"no user", func() string {
+			claims := valid()
+			delete(claims, "id")
+			return sign(t, jwt.SigningMethodHS256, "k1", "secret-1", claims)
+		}},
+		{"other algorithm", func() string {
+			return sign(t, jwt.SigningMethodHS512, "k1", "secret-1", valid())
+		}},
+		{"unsigned", func() string {
+			token := jwt.NewWithClaims(jwt.SigningMethodNone, valid())
+			token.Header["kid"] = "k1"
+			signed, _ := token.SignedString(jwt.UnsafeAllowNoneSignatureType)
+			return signed
+		}},
+		{"no key ID", func() string {
+			return sign(t, jwt.SigningMethodHS256, "", "secret-1", valid())
+		}},
+		{"unknown key ID", func() string {
+			return sign(t, jwt.SigningMethodHS256, "k2", "secret-1", valid())
+		}},
+		{"wrong secret", func() string {
+			return sign(t, jwt.SigningMethodHS256, "k1", "guessed", valid())
+		}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := tokens.Verify(tt.token()); !errors.Is(err, ErrInvalidToken) {
+				t.Errorf("got %v, want ErrInvalidToken", err)
+			}
+		})
+	}
+}
+
+func TestKeyRotation(t *testing.T) {
+	old := newTestTokens(t, HMACKey("k1", "secret-1"))
+	raw, err := old.Issue(testClaims(), time.Now().Add(time.Minute))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// After rotating, tokens signed with the retired key still verify
+	rotated := newTestTokens(t, HMACKey("k2", "secret-2"), HMACKey("k1", "secret-1"))
+	if _, err := rotated.Verify(raw); err != nil {
+		t.Errorf("token of retired key rejected: %v", err)
+	}
+	fresh, err := rotated.Issue(testClaims(), time.Now().Add(time.Minute))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := old.Verify(fresh); err == nil {
+		t.Error("token of the new key accepted by a server that does not know it")
+	}
+
+	// Once the retired key is dropped its tokens stop working
+	dropped := newTestTokens(t, HMACKey("k2", "secret-2"))
+	if _, err := dropped.Verify(raw); err == nil {
+		t.Error("token of a dropped key accepted")
+	}
+
+	if _, err := NewKeySet(HMACKey("k1", "a"), HMACKey("k1", "b")); err == nil {
+		t.Error("duplicate key IDs accepted")
+	}
+}
+
+func TestAuthenticator(t *testing.T) {
+	tokens := newTestTokens(t, HMACKey("k1", "secret-1"))
+	activeSession := func(ctx context.Context, jti string) bool { return jti == "session-1" }
+	apiKeys := func(ctx context.Context, key string) (*Principal, error) {
+		if key != "crm_valid" {
+			return nil, errors.New("unknown key")
+		}
+		return &Principal{UserID: 5, Method: MethodAPIKey, Scopes: []models.APIKeyScope{models.APIKeyScopeRead}}, nil
+	}
+	authenticator := NewAuthenticator(tokens, activeSession, apiKeys)
+
+	active, _ := tokens.Issue(testClaims(), time.Now().Add(time.Minute))
+	revokedClaims := testClaims()
+	revokedClaims.ID = "session-2"
+	revoked, _ := tokens.Issue(revokedClaims, time.Now().Add(time.Minute))
+
+	var seen *Principal
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		seen, _ = FromContext(r.Context())
+	})
+	serve := func(h http.Handler, authorization string) int {
+		seen = nil
+		req := httptest.NewRequest(http.MethodPost, "/graphql", nil)
+		if authorization != "" {
+			req.Header.Set("Authorization", authorization)
+		}
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+		return rec.Code
+	}
+
+	tests := []struct {
+		name          string
+		authorization string
+		wantUser      uint
+	}{
+		{"no credentials", "", 0},
+		{"session token", "Bearer " + active, 3},
+		{"revoked session", "Bearer " + revoked, 0},
+		{"malformed token", "Bearer nonsense", 0},
+		{"API key", "ApiKey crm_valid", 5},
+		{"unknown API key", "ApiKey crm_unknown", 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			code := serve(authenticator.Require(handler), tt.authorization)
+			if tt.wantUser == 0 && code != http.StatusUnauthorized {
+				t.Errorf("Require: status %d, want 401", code)
+			}
+			if tt.wantUser != 0 && (code != http.StatusOK || seen == nil || seen.UserID != tt.wantUser) {
+				t.Errorf("Require: status %d, principal %+v, want user %d", code, seen, tt.wantUser)
+			}
+
+			code = serve(authenticator.Optional(handler), tt.authorization)
+			if code != http.StatusOK {
+				t.Errorf("Optional: status %d, want 200", code)
+			}
+			got := uint(0)
+			if seen != nil {
+				got = seen.UserID
+			}
+			if got != tt.wantUser {
+				t.Errorf("Optional: user %d, want %d", got, tt.wantUser)
+			}
+		})
+	}
+}
+
+func TestPrincipalScopes(t *testing.T) {
+	session := &Principal{UserID: 1, Method: MethodSession}
+	key := &Principal{UserID: 1, Method: MethodAPIKey, Scopes: []models.APIKeyScope{models.APIKeyScopeRead}}
+
+	if !session.HasScope(models.APIKeyScopeAdmin) {
+		t.Error("sessions should not be limited by scopes")
+	}
+	if !key.HasScope(models.APIKeyScopeRead) || key.HasScope(models.APIKeyScopeWrite) {
+		t.Error("API key scopes not applied")
+	}
+
+	ctx := WithPrincipal(context.Background(), key)
+	if p, ok := FromContext(ctx); !ok || p != key {
+		t.Error("principal not found in context")
+	}
+	if _, ok := FromContext(context.Background()); ok {
+		t.Error("principal found in empty context")
+	}
+}
+
+func TestClientIP(t *testing.T) {
+	ctx := WithClientIP(context.Background(), "203.0.113.7")
+	if ip := ClientIP(ctx); ip != "203.0.113.7" {
+		t.Errorf("client IP %q, want 203.0.113.7", ip)
+	}
+	if ip := ClientIP(context.WithValue(context.Background(), "clientIp", "203.0.113.7")); ip != "" {
+		t.Errorf("client IP %q read from an untyped key", ip)
+	}
+}
+
+// writePEM writes a PEM file into a temporary directory and returns its path
+func writePEM(t *testing.T, name, blockType string, der []byte) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(path, pem.EncodeToMemory(&pem.Block{Type: blockType, Bytes: der}), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestAsymmetricKeys(t *testing.T) {
+	rsaPrivate, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	edPublic, edPrivate, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	edPKCS8, _ := x509.MarshalPKCS8PrivateKey(edPrivate)
+	rsaPKIX, _ := x509.MarshalPKIXPublicKey(&rsaPrivate.PublicKey)
+	edPKIX, _ := x509.MarshalPKIXPublicKey(edPublic)
+
+	load := func(id, path string) *Key {
+		t.Helper()
+		key, err := LoadKeyFile(id, path)
+		if err != nil {
+			t.Fatalf("LoadKeyFile(%s): %v", id, err)
+		}
+		return key
+	}
+	rsaKey := load("rsa", writePEM(t, "rsa.pem", "RSA PRIVATE KEY", x509.MarshalPKCS1PrivateKey(rsaPrivate)))
+	edKey := load("ed", writePEM(t, "ed.pem", "PRIVATE KEY", edPKCS8))
+	rsaPublicKey := load("rsa", writePEM(t, "rsa.pub", "PUBLIC KEY", rsaPKIX))
+	edPublicKey := load("ed", writePEM(t, "ed.pub", "PUBLIC KEY", edPKIX))
+
+	for _, tt := range []struct {
+		signing, public *Key
+		alg             string
+	}{
+		{rsaKey, rsaPublicKey, "RS256"},
+		{edKey, edPublicKey, "EdDSA"},
+	} {
+		t.Run(tt.alg, func(t *testing.T) {
+			raw, err := newTestTokens(t, tt.signing).Issue(testClaims(), time.Now().Add(time.Minute))
+			if err != nil {
+				t.Fatalf("Issue: %v", err)
+			}
+			token, _, _ := jwt.NewParser().ParseUnverified(raw, jwt.MapClaims{})
+			if token.Method.Alg() != tt.alg || token.Header["kid"] != tt.signing.ID {
+				t.Errorf("header %v, want alg %s and kid %s", token.Header, tt.alg, tt.signing.ID)
+			}
+
+			// A server holding only the public key accepts the token
+			verifier := newTestTokens(t, HMACKey("local", "secret"), tt.public)
+			if _, err := verifier.Verify(raw); err != nil {
+				t.Errorf("Verify with public key: %v", err)
+			}
+
+			// but cannot sign with it
+			if _, err := NewKeySet(tt.public); err == nil {
+				t.Error("public key accepted as the signing key")
+			}
+		})
+	}
+
+	// An HMAC token keyed with the public key must not pass as RS256
+	verifier := newTestTokens(t, rsaKey)
+	forged := sign(t, jwt.SigningMethodHS256, "rsa", string(pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: rsaPKIX})), jwt.MapClaims{
+		"id":  3,
+		"iss": testIssuer,
+		"aud": testAudience,
+		"exp": time.Now().Add(time.Minute).Unix(),
+	})
+	if _, err := verifier.Verify(forged); !errors.Is(err, ErrInvalidToken) {
+		t.Errorf("HMAC token for an RSA key: got %v, want ErrInvalidToken", err)
+	}
+
+	weak, _ := rsa.GenerateKey(rand.Reader, 1024)
+	if _, err := LoadKeyFile("weak", writePEM(t, "weak.pem", "RSA PRIVATE KEY", x509.MarshalPKCS1PrivateKey(weak))); err == nil {
+		t.Error("1024-bit RSA key accepted")
+	}
+}
+
+func TestJWKS(t *testing.T) {
+	rsaPrivate, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	edPublic, edPrivate, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tokens := newTestTokens(t,
+		RSAKey("rsa-2", &rsaPrivate.PublicKey, rsaPrivate),
+		EdDSAKey("ed-1", edPublic, edPrivate),
+		HMACKey("hmac-1", "never-published"),
+	)
+
+	rec := httptest.NewRecorder()
+	tokens.JWKSHandler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/.well-known/jwks.json", nil))
+	if rec.Code != http.StatusOK || rec.Header().Get("Content-Type") != "application/json" {
+		t.Fatalf("status %d, content type %q", rec.Code, rec.Header().Get("Content-Type"))
+	}
+
+	var set JSONWebKeySet
+	if err := json.Unmarshal(rec.Body.Bytes(), &set); err != nil {
+		t.Fatal(err)
+	}
+	if len(set.Keys) != 2 || set.Keys[0].Kid != "ed-1" || set.Keys[1].Kid != "rsa-2" {
+		t.Fatalf("published keys %+v, want ed-1 and rsa-2 only", set.Keys)
+	}
+
+	// Another service can verify our tokens from the published key alone
+	jwk := set.Keys[1]
+	n, _ := base64.RawURLEncoding.DecodeString(jwk.N)
+	e, _ := base64.RawURLEncoding.DecodeString(jwk.E)
+	published := &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(new(big.Int).SetBytes(e).Int64())}
+
+	raw, err := tokens.Issue(testClaims(), time.Now().Add(time.Minute))
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = jwt.Parse(raw, func(token *jwt.Token) (interface{}, error) {
+		return published, nil
+	}, jwt.WithValidMethods([]string{jwk.Alg}))
+	if err != nil {
+		t.Errorf("token does not verify with the published key: %v", err)
+	}
+}
@@ -0,0 +1,151 @@
+package auth
+
+import (
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+	"os"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// minRSABits is the smallest RSA modulus accepted for signing keys
+const minRSABits = 2048
+
+// Key is a token signing key. Its ID travels in the kid header of every
+// token it signs, so that tokens keep verifying after the signing key has
+// been rotated.
+type Key struct {
+	ID     string
+	Method jwt.SigningMethod
+
+	signKey   interface{}
+	verifyKey interface{}
+}
+
+// HMACKey returns an HS256 key for a shared secret
+func HMACKey(id, secret string) *Key {
+	return &Key{ID: id, Method: jwt.SigningMethodHS256, signKey: []byte(secret), verifyKey: []byte(secret)}
+}
+
+// RSAKey returns an RS256 key. A key built from a public key only verifies.
+func RSAKey(id string, key *rsa.PublicKey, private *rsa.PrivateKey) *Key {
+	k := &Key{ID: id, Method: jwt.SigningMethodRS256, verifyKey: key}
+	if private != nil {
+		k.signKey = private
+	}
+	return k
+}
+
+// EdDSAKey returns an Ed25519 key. A key built from a public key only verifies.
+func EdDSAKey(id string, key ed25519.PublicKey, private ed25519.PrivateKey) *Key {
+	k := &Key{ID: id, Method: jwt.SigningMethodEdDSA, verifyKey: key}
+	if private != nil {
+		k.signKey = private
+	}
+	return k
+}
+
+// LoadKeyFile reads an RSA or Ed25519 key from a PEM file holding a PKCS #1
+// or PKCS #8 private key, or a public key. Public keys only verify tokens,
+// which lets a server accept a key whose private half it does not hold.
+func LoadKeyFile(id, path string) (*Key, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("signing key %q: %w", id, err)
+	}
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, fmt.Errorf("signing key %q: %s is not a PEM file", id, path)
+	}
+
+	var parsed interface{}
+	switch block.Type {
+	case "RSA PRIVATE KEY":
+		parsed, err = x509.ParsePKCS1PrivateKey(block.Bytes)
+	case "PRIVATE KEY":
+		parsed, err = x509.ParsePKCS8PrivateKey(block.Bytes)
+	case "RSA PUBLIC KEY":
+		parsed, err = x509.ParsePKCS1PublicKey(block.Bytes)
+	case "PUBLIC KEY":
+		parsed, err = x509.ParsePKIXPublicKey(block.Bytes)
+	default:
+		return nil, fmt.Errorf("signing key %q: unsupported PEM block %q in %s", id, block.Type, path)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("signing key %q: %w", id, err)
+	}
+
+	switch key := parsed.(type) {
+	case *rsa.PrivateKey:
+		if key.N.BitLen() < minRSABits {
+			return nil, fmt.Errorf("signing key %q: RSA keys need at least %d bits", id, minRSABits)
+		}
+		return RSAKey(id, &key.PublicKey, key), nil
+	case *rsa.PublicKey:
+		if key.N.BitLen() < minRSABits {
+			return nil, fmt.Errorf("signing key %q: RSA keys need at least %d bits", id, minRSABits)
+		}
+		return RSAKey(id, key, nil), nil
+	case ed25519.PrivateKey:
+		return EdDSAKey(id, key.Public().(ed25519.PublicKey), key), nil
+	case ed25519.PublicKey:
+		return EdDSAKey(id, key, nil), nil
+	default:
+		return nil, fmt.Errorf("signing key %q: only RSA and Ed25519 keys are supported", id)
+	}
+}
+
+// KeySet is the key new tokens are signed with together with other keys
+// whose tokens are accepted, such as retired keys until their tokens expire
+// or keys of other servers mid-rotation
+type KeySet struct {
+	signing *Key
+	keys    map[string]*Key
+}
+
+// NewKeySet returns a key set signing with signing and also verifying with
+// others. Key IDs must be unique.
+func NewKeySet(signing *Key, others ...*Key) (*KeySet, error) {
+	if signing.signKey == nil {
+		return nil, fmt.Errorf("signing key %q is a public key and cannot sign", signing.ID)
+	}
+
+	set := &KeySet{signing: signing, keys: make(map[string]*Key)}
+	for _, key := range append([]*Key{signing}, others...) {
+		if key.ID == "" {
+			return nil, fmt.Errorf("signing keys need a key ID")
+		}
+		if _, ok := set.keys[key.ID]; ok {
+			return nil, fmt.Errorf("duplicate signing key ID %q", key.ID)
+		}
+		set.keys[key.ID] = key
+	}
+	return set, nil
+}
+
+// Signing returns the key new tokens are signed with
+func (s *KeySet) Signing() *Key {
+	return s.signing
+}
+
+// Lookup returns the key with the given ID
+func (s *KeySet) Lookup(id string) (*Key, bool) {
+	key, ok := s.keys[id]
+	return key, ok
+}
+
+// algorithms lists the signing algorithms of the set's keys
+func (s *KeySet) algorithms() []string {
+	seen := make(map[string]bool)
+	var algs []string
+	for _, key := range s.keys {
+		if alg := key.Method.Alg(); !seen[alg] {
+			seen[alg] = true
+			algs = append(algs, alg)
+		}
+	}
+	return algs
+}
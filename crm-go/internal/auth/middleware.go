@@ -0,0 +1,105 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+)
+
+// Authentication failures, reported to clients by Require
+var (
+	ErrNoCredentials  = errors.New("Authentication required")
+	ErrInvalidAPIKey  = errors.New("Invalid API key")
+	ErrSessionRevoked = errors.New("Session has been revoked")
+)
+
+// SessionValidator reports whether the session with the given JTI is still active
+type SessionValidator func(ctx context.Context, jti string) bool
+
+// APIKeyAuthenticator looks up the caller behind a personal API key
+type APIKeyAuthenticator func(ctx context.Context, key string) (*Principal, error)
+
+// Authenticator authenticates HTTP requests from their Authorization header,
+// which holds either "Bearer <access token>" or "ApiKey <key>"
+type Authenticator struct {
+	tokens        *Tokens
+	activeSession SessionValidator
+	apiKeys       APIKeyAuthenticator
+}
+
+// NewAuthenticator returns an authenticator accepting access tokens issued by
+// tokens whose session activeSession reports as neither revoked nor expired,
+// and API keys that apiKeys accepts
+func NewAuthenticator(tokens *Tokens, activeSession SessionValidator, apiKeys APIKeyAuthenticator) *Authenticator {
+	return &Authenticator{tokens: tokens, activeSession: activeSession, apiKeys: apiKeys}
+}
+
+// Authenticate returns the caller of r
+func (a *Authenticator) Authenticate(r *http.Request) (*Principal, error) {
+	authHeader := r.Header.Get("Authorization")
+
+	// API keys act as the user who created them, within the key's scopes
+	if key, ok := strings.CutPrefix(authHeader, "ApiKey "); ok {
+		principal, err := a.apiKeys(r.Context(), key)
+		if err != nil {
+			return nil, ErrInvalidAPIKey
+		}
+		return principal, nil
+	}
+
+	tokenString, ok := strings.CutPrefix(authHeader, "Bearer ")
+	if !ok {
+		return nil, ErrNoCredentials
+	}
+
+	claims, err := a.tokens.Verify(tokenString)
+	if err != nil {
+		return nil, err
+	}
+
+	// Reject tokens of sessions that have been logged out
+	if !a.activeSession(r.Context(), claims.ID) {
+		return nil, ErrSessionRevoked
+	}
+	return claims.Principal(), nil
+}
+
+// Require adds the caller to the request context and refuses requests
+// without valid credentials
+func (a *Authenticator) Require(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		principal, err := a.Authenticate(r)
+		if err != nil {
+			message := err.Error()
+			if errors.Is(err, ErrInvalidToken) {
+				message = "Invalid token"
+			}
+			http.Error(w, fmt.Sprintf(`{"error":%q}`, message), http.StatusUnauthorized)
+			return
+		}
+
+		next.ServeHTTP(w, r.WithContext(WithPrincipal(r.Context(), principal)))
+	})
+}
+
+// Optional adds the caller to the request context when valid credentials are
+// sent, and otherwise lets the request through anonymously. Invalid
+// credentials are ignored rather than refused, so that a stale token left in
+// the browser does not stop its owner signing in again.
+func (a *Authenticator) Optional(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		principal, err := a.Authenticate(r)
+		if err != nil {
+			if !errors.Is(err, ErrNoCredentials) {
+				log.Printf("Ignoring credentials for %s: %v", r.URL.Path, err)
+			}
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		next.ServeHTTP(w, r.WithContext(WithPrincipal(r.Context(), principal)))
+	})
+}
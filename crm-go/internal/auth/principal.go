@@ -0,0 +1,82 @@
+// Package auth authenticates requests. It issues and verifies access tokens,
+// accepts personal API keys through a callback, and carries the caller's
+// identity through the request context as a Principal.
+package auth
+
+import (
+	"context"
+
+	"crmgo/internal/models"
+)
+
+// Method is how a request was authenticated
+type Method string
+
+const (
+	MethodSession Method = "session" // An access token of a signed-in session
+	MethodAPIKey  Method = "api_key" // A personal API key
+)
+
+// Principal is the authenticated caller of a request
+type Principal struct {
+	UserID         uint
+	Email          string
+	OrganisationID uint // Zero until the user has joined an organisation
+	Role           models.Role
+	TeamMemberID   uint // Zero when the user has no team member profile
+	Method         Method
+
+	SessionID string               // JTI of the session, for MethodSession
+	APIKeyID  uint                 // For MethodAPIKey
+	Scopes    []models.APIKeyScope // What the API key may do, for MethodAPIKey
+}
+
+// UsingAPIKey reports whether the caller authenticated with an API key rather
+// than a session
+func (p *Principal) UsingAPIKey() bool {
+	return p.Method == MethodAPIKey
+}
+
+// HasScope reports whether the caller may act within scope. Sessions are not
+// limited by scopes.
+func (p *Principal) HasScope(scope models.APIKeyScope) bool {
+	if !p.UsingAPIKey() {
+		return true
+	}
+	for _, s := range p.Scopes {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
+
+type contextKey struct{}
+
+// WithPrincipal returns ctx carrying p as the authenticated caller
+func WithPrincipal(ctx context.Context, p *Principal) context.Context {
+	return context.WithValue(ctx, contextKey{}, p)
+}
+
+// FromContext returns the authenticated caller, if any
+func FromContext(ctx context.Context) (*Principal, bool) {
+	p, ok := ctx.Value(contextKey{}).(*Principal)
+	if !ok || p == nil || p.UserID == 0 {
+		return nil, false
+	}
+	return p, true
+}
+
+type clientIPKey struct{}
+
+// WithClientIP returns ctx carrying the IP address the request came from
+func WithClientIP(ctx context.Context, ip string) context.Context {
+	return context.WithValue(ctx, clientIPKey{}, ip)
+}
+
+// ClientIP returns the IP address the request came from, or "" if the HTTP
+// layer did not record one
+func ClientIP(ctx context.Context) string {
+	ip, _ := ctx.Value(clientIPKey{}).(string)
+	return ip
+}
@@ -0,0 +1,146 @@
+package auth
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"crmgo/internal/config"
+	"crmgo/internal/models"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// clockSkew is the leeway allowed between the clocks of servers issuing and
+// verifying tokens
+const clockSkew = 30 * time.Second
+
+// ErrInvalidToken is returned for access tokens that fail verification
+var ErrInvalidToken = errors.New("invalid token")
+
+// Claims is the payload of an access token
+type Claims struct {
+	jwt.RegisteredClaims
+	UserID         uint        `json:"id"`
+	Email          string      `json:"email"`
+	Role           models.Role `json:"role"`
+	OrganisationID *uint       `json:"organisation_id,omitempty"`
+	TeamMemberID   *uint       `json:"team_member_id,omitempty"`
+}
+
+// Principal returns the caller the token was issued to
+func (c *Claims) Principal() *Principal {
+	p := &Principal{
+		UserID:    c.UserID,
+		Email:     c.Email,
+		Role:      c.Role,
+		Method:    MethodSession,
+		SessionID: c.ID,
+	}
+	if c.OrganisationID != nil {
+		p.OrganisationID = *c.OrganisationID
+	}
+	if c.TeamMemberID != nil {
+		p.TeamMemberID = *c.TeamMemberID
+	}
+	return p
+}
+
+// Tokens issues and verifies access tokens
+type Tokens struct {
+	keys     *KeySet
+	issuer   string
+	audience string
+}
+
+// NewTokens returns a token issuer for keys, stamping tokens with issuer and
+// audience and accepting only tokens that carry both
+func NewTokens(keys *KeySet, issuer, audience string) *Tokens {
+	return &Tokens{keys: keys, issuer: issuer, audience: audience}
+}
+
+// NewTokensFromConfig returns a token issuer for the configured keys. Tokens
+// are signed with the key in JWTSigningKeyFile, or with JWTSecret when no
+// key file is configured.
+func NewTokensFromConfig(cfg *config.Config) (*Tokens, error) {
+	var signing *Key
+	if cfg.JWTSigningKeyFile != "" {
+		key, err := LoadKeyFile(cfg.JWTKeyID, cfg.JWTSigningKeyFile)
+		if err != nil {
+			return nil, err
+		}
+		signing = key
+	} else {
+		if cfg.JWTSecret == "" {
+			return nil, fmt.Errorf("JWT_SECRET is not set")
+		}
+		signing = HMACKey(cfg.JWTKeyID, cfg.JWTSecret)
+	}
+
+	others := make([]*Key, 0, len(cfg.JWTVerificationKeyFiles)+len(cfg.JWTRetiredSecrets))
+	for id, path := range cfg.JWTVerificationKeyFiles {
+		key, err := LoadKeyFile(id, path)
+		if err != nil {
+			return nil, err
+		}
+		others = append(others, key)
+	}
+	for id, secret := range cfg.JWTRetiredSecrets {
+		others = append(others, HMACKey(id, secret))
+	}
+
+	keys, err := NewKeySet(signing, others...)
+	if err != nil {
+		return nil, err
+	}
+	return NewTokens(keys, cfg.JWTIssuer, cfg.JWTAudience), nil
+}
+
+// Issue signs an access token for claims, valid until expiresAt
+func (t *Tokens) Issue(claims Claims, expiresAt time.Time) (string, error) {
+	key := t.keys.Signing()
+
+	claims.Issuer = t.issuer
+	claims.Audience = jwt.ClaimStrings{t.audience}
+	claims.IssuedAt = jwt.NewNumericDate(time.Now())
+	claims.ExpiresAt = jwt.NewNumericDate(expiresAt)
+
+	token := jwt.NewWithClaims(key.Method, claims)
+	token.Header["kid"] = key.ID
+	return token.SignedString(key.signKey)
+}
+
+// Verify checks an access token's signature, issuer, audience and expiry and
+// returns its claims. The algorithm is pinned to the one of the key named by
+// the token's kid, so a token cannot choose how it is checked.
+func (t *Tokens) Verify(raw string) (*Claims, error) {
+	var claims Claims
+	_, err := jwt.ParseWithClaims(raw, &claims, func(token *jwt.Token) (interface{}, error) {
+		kid, _ := token.Header["kid"].(string)
+		key, ok := t.keys.Lookup(kid)
+		if !ok {
+			return nil, fmt.Errorf("unknown signing key %q", kid)
+		}
+		if token.Method.Alg() != key.Method.Alg() {
+			return nil, fmt.Errorf("unexpected signing method %q", token.Method.Alg())
+		}
+		return key.verifyKey, nil
+	},
+		jwt.WithValidMethods(t.keys.algorithms()),
+		jwt.WithIssuer(t.issuer),
+		jwt.WithAudience(t.audience),
+		jwt.WithLeeway(clockSkew),
+		jwt.WithIssuedAt(),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidToken, err)
+	}
+
+	if claims.ExpiresAt == nil {
+		return nil, fmt.Errorf("%w: missing expiry", ErrInvalidToken)
+	}
+	if claims.UserID == 0 {
+		return nil, fmt.Errorf("%w: missing user", ErrInvalidToken)
+	}
+	return &claims, nil
+}
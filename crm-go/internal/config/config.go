@@ -1,11 +1,17 @@
 package config
 
 import (
+	"fmt"
 	"os"
+	"strconv"
 	"strings"
 	"time"
 )
 
+// defaultJWTSecret is the placeholder secret used when JWT_SECRET is unset.
+// It is public, so production refuses to start with it.
+const defaultJWTSecret = "your-secret-key-should-be-in-env-file"
+
 // Config stores the application configuration
 type Config struct {
 	Environment      string
@@ -16,6 +22,48 @@ type Config struct {
 	EmailAPIKey      string
 	EmailSender      string
 	FrontendURL      string
+	UploadDir        string // Root directory of the local storage backend
+	MaxUploadSize    int64  // Maximum document upload size in bytes
+	MaxPageSize      int    // Most items a paginated list query returns at once
+
+	// Organisations
+	OrganisationDeletionGrace time.Duration // How long a deleted organisation can still be restored by its owner
+
+	// Authentication
+	AccessTokenTTL           time.Duration     // Lifetime of access tokens
+	RefreshTokenTTL          time.Duration     // How long a session survives without being refreshed
+	RequireEmailVerification bool              // Refuse to sign in users who have not verified their email address
+	JWTIssuer                string            // iss claim of access tokens
+	JWTAudience              string            // aud claim of access tokens
+	JWTKeyID                 string            // kid of the key new tokens are signed with
+	JWTSigningKeyFile        string            // PEM RSA or Ed25519 private key to sign tokens with; JWTSecret signs when empty
+	JWTVerificationKeyFiles  map[string]string // Further PEM keys by kid whose tokens are accepted, for rotation
+	JWTRetiredSecrets        map[string]string // Previous secrets by kid, still accepted until their tokens expire
+
+	// Login protection
+	LoginMaxFailures   int           // Consecutive failures that lock an account
+	LoginLockout       time.Duration // How long a locked account stays locked
+	LoginIPMaxFailures int           // Failures from one IP address within LoginFailureWindow before it is refused
+	LoginFailureWindow time.Duration // Period over which failures are counted
+	LoginDelayBase     time.Duration // Delay after the first failure, doubled for each further one
+	TrustProxyHeaders  bool          // Take the client IP from X-Forwarded-For / X-Real-IP
+
+	// Single sign-on (OpenID Connect); disabled unless OIDCIssuerURL is set
+	OIDCIssuerURL           string
+	OIDCClientID            string
+	OIDCClientSecret        string
+	OIDCRedirectURL         string          // Our /auth/oidc/callback URL as registered with the provider
+	OIDCDomainOrganisations map[string]uint // Email domain to the organisation its users are provisioned into
+
+	// Document storage
+	StorageBackend    string        // "local" or "s3"
+	SignedURLExpiry   time.Duration // Lifetime of direct download links handed out by the storage backend
+	S3Endpoint        string
+	S3Region          string
+	S3Bucket          string
+	S3AccessKeyID     string
+	S3SecretAccessKey string
+	S3PathStyle       bool // Path-style bucket addressing, needed for MinIO and most self-hosted stores
 }
 
 // LoadConfig loads the configuration from environment variables
@@ -23,12 +71,49 @@ func LoadConfig() *Config {
 	config := &Config{
 		Environment:      getEnv("GO_ENV", "development"),
 		DatabasePath:     getEnv("DATABASE_PATH", "./data/crmdash.db"),
-		JWTSecret:        getEnv("JWT_SECRET", "your-secret-key-should-be-in-env-file"),
+		JWTSecret:        getEnv("JWT_SECRET", defaultJWTSecret),
 		CORSAllowOrigins: getEnv("CORS_ALLOW_ORIGINS", "*"),
 		StartTime:        time.Now(),
 		EmailAPIKey:      getEnv("EMAIL_API_KEY", ""),
 		EmailSender:      getEnv("EMAIL_SENDER", "noreply@example.com"),
 		FrontendURL:      getEnv("FRONTEND_URL", "http://localhost:3000"),
+		UploadDir:        getEnv("UPLOAD_DIR", "./data/uploads"),
+		MaxUploadSize:    int64(getEnvInt("MAX_UPLOAD_SIZE_MB", 25)) << 20,
+		MaxPageSize:      getEnvInt("MAX_PAGE_SIZE", 100),
+
+		OrganisationDeletionGrace: time.Duration(getEnvInt("ORGANISATION_DELETION_GRACE_DAYS", 30)) * 24 * time.Hour,
+
+		AccessTokenTTL:           time.Duration(getEnvInt("ACCESS_TOKEN_TTL_MINUTES", 15)) * time.Minute,
+		RefreshTokenTTL:          time.Duration(getEnvInt("REFRESH_TOKEN_TTL_DAYS", 30)) * 24 * time.Hour,
+		RequireEmailVerification: getEnv("REQUIRE_EMAIL_VERIFICATION", "false") == "true",
+		JWTIssuer:                getEnv("JWT_ISSUER", "crm-go"),
+		JWTAudience:              getEnv("JWT_AUDIENCE", "crm-dashboard"),
+		JWTKeyID:                 getEnv("JWT_KEY_ID", "primary"),
+		JWTSigningKeyFile:        getEnv("JWT_SIGNING_KEY_FILE", ""),
+		JWTVerificationKeyFiles:  getEnvKeyMap("JWT_VERIFICATION_KEY_FILES"),
+		JWTRetiredSecrets:        getEnvKeyMap("JWT_RETIRED_SECRETS"),
+
+		LoginMaxFailures:   getEnvInt("LOGIN_MAX_FAILURES", 5),
+		LoginLockout:       time.Duration(getEnvInt("LOGIN_LOCKOUT_MINUTES", 15)) * time.Minute,
+		LoginIPMaxFailures: getEnvInt("LOGIN_IP_MAX_FAILURES", 20),
+		LoginFailureWindow: time.Duration(getEnvInt("LOGIN_FAILURE_WINDOW_MINUTES", 15)) * time.Minute,
+		LoginDelayBase:     time.Duration(getEnvInt("LOGIN_DELAY_BASE_MS", 250)) * time.Millisecond,
+		TrustProxyHeaders:  getEnv("TRUST_PROXY_HEADERS", "false") == "true",
+
+		OIDCIssuerURL:           getEnv("OIDC_ISSUER_URL", ""),
+		OIDCClientID:            getEnv("OIDC_CLIENT_ID", ""),
+		OIDCClientSecret:        getEnv("OIDC_CLIENT_SECRET", ""),
+		OIDCRedirectURL:         getEnv("OIDC_REDIRECT_URL", "http://localhost:3001/auth/oidc/callback"),
+		OIDCDomainOrganisations: getEnvDomainMap("OIDC_DOMAIN_ORGANISATIONS"),
+
+		StorageBackend:    getEnv("STORAGE_BACKEND", "local"),
+		SignedURLExpiry:   time.Duration(getEnvInt("SIGNED_URL_EXPIRY_SECONDS", 300)) * time.Second,
+		S3Endpoint:        getEnv("S3_ENDPOINT", ""),
+		S3Region:          getEnv("S3_REGION", "us-east-1"),
+		S3Bucket:          getEnv("S3_BUCKET", ""),
+		S3AccessKeyID:     getEnv("S3_ACCESS_KEY_ID", ""),
+		S3SecretAccessKey: getEnv("S3_SECRET_ACCESS_KEY", ""),
+		S3PathStyle:       getEnv("S3_PATH_STYLE", "false") == "true",
 	}
 	return config
 }
@@ -42,6 +127,57 @@ func getEnv(key, defaultValue string) string {
 	return value
 }
 
+// getEnvInt retrieves an integer environment variable or returns a default value
+func getEnvInt(key string, defaultValue int) int {
+	value, err := strconv.Atoi(os.Getenv(key))
+	if err != nil {
+		return defaultValue
+	}
+	return value
+}
+
+// getEnvDomainMap parses a list of domain=organisationID pairs such as
+// "acme.com=1,example.org=2", skipping malformed entries
+func getEnvDomainMap(key string) map[string]uint {
+	domains := make(map[string]uint)
+	for _, pair := range strings.Split(os.Getenv(key), ",") {
+		domain, id, ok := strings.Cut(pair, "=")
+		if !ok {
+			continue
+		}
+		orgID, err := strconv.ParseUint(strings.TrimSpace(id), 10, 64)
+		if err != nil || orgID == 0 {
+			continue
+		}
+		domains[strings.ToLower(strings.TrimSpace(domain))] = uint(orgID)
+	}
+	return domains
+}
+
+// getEnvKeyMap parses a list of kid=value pairs such as
+// "2024-01=oldsecret,2024-06=newersecret", skipping malformed entries.
+// Values may contain "=" but not ",".
+func getEnvKeyMap(key string) map[string]string {
+	keys := make(map[string]string)
+	for _, pair := range strings.Split(os.Getenv(key), ",") {
+		id, secret, ok := strings.Cut(pair, "=")
+		id = strings.TrimSpace(id)
+		if !ok || id == "" || secret == "" {
+			continue
+		}
+		keys[id] = secret
+	}
+	return keys
+}
+
+// Validate refuses configurations that are unsafe to run with
+func (c *Config) Validate() error {
+	if c.Environment == "production" && (c.JWTSecret == "" || c.JWTSecret == defaultJWTSecret) {
+		return fmt.Errorf("JWT_SECRET must be set to a secret of your own in production")
+	}
+	return nil
+}
+
 // GetAllowedOrigins returns a slice of allowed origins for CORS
 func (c *Config) GetAllowedOrigins() []string {
 	return strings.Split(c.CORSAllowOrigins, ",")
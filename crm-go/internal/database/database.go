@@ -1,12 +1,16 @@
 package database
 
 import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
 	"log"
 	"os"
 	"path/filepath"
 	"time"
 
 	"crmgo/internal/models"
+	"crmgo/internal/tenant"
 	"gorm.io/driver/sqlite"
 	"gorm.io/gorm"
 	"gorm.io/gorm/logger"
@@ -53,8 +57,13 @@ func InitDB(dbPath string) (*gorm.DB, error) {
 	sqlDB.SetMaxOpenConns(1)
 	sqlDB.SetConnMaxLifetime(time.Hour)
 
-	// Auto-migrate the database
-	err = migrateDatabase(db)
+	// Scope tenant-owned models to the organisation in each statement's context
+	if err := tenant.Register(db); err != nil {
+		return nil, err
+	}
+
+	// Auto-migrate the database; migrations work across all organisations
+	err = migrateDatabase(db.WithContext(tenant.WithoutScope(context.Background())))
 	if err != nil {
 		return nil, err
 	}
@@ -65,6 +74,15 @@ func InitDB(dbPath string) (*gorm.DB, error) {
 // migrateDatabase runs auto-migrations for all models
 func migrateDatabase(db *gorm.DB) error {
 	log.Println("Running database migrations...")
+
+	if err := hashInvitationTokens(db); err != nil {
+		log.Printf("Database migration error: %v", err)
+		return err
+	}
+
+	// Until memberships, a user's role was their role in their only
+	// organisation; since, it is only their default one
+	singleOrganisation := !db.Migrator().HasTable(&models.Membership{})
 	
 	// Auto-migrate all models
 	err := db.AutoMigrate(
@@ -80,13 +98,145 @@ func migrateDatabase(db *gorm.DB) error {
 		&models.Task{},
 		&models.Document{},
 		&models.Invitation{},
+		&models.Session{},
+		&models.UserToken{},
+		&models.LoginEvent{},
+		&models.RecoveryCode{},
+		&models.APIKey{},
+		&models.UserIdentity{},
+		&models.Membership{},
 	)
 	
 	if err != nil {
 		log.Printf("Database migration error: %v", err)
 		return err
 	}
+
+	if err := runBackfills(db, organisationBackfills); err != nil {
+		log.Printf("Database migration error: %v", err)
+		return err
+	}
+
+	if err := runBackfills(db, roleBackfills); err != nil {
+		log.Printf("Database migration error: %v", err)
+		return err
+	}
+
+	if singleOrganisation {
+		if err := runBackfills(db, ownerBackfills); err != nil {
+			log.Printf("Database migration error: %v", err)
+			return err
+		}
+	}
+
+	if err := runBackfills(db, emailVerificationBackfills); err != nil {
+		log.Printf("Database migration error: %v", err)
+		return err
+	}
+
+	if err := runBackfills(db, membershipBackfills); err != nil {
+		log.Printf("Database migration error: %v", err)
+		return err
+	}
 	
 	log.Println("Database migrations completed successfully")
 	return nil
-}
\ No newline at end of file
+}
+
+// organisationBackfills derive the owning organisation of deals and documents
+// created before they carried one, from the records they are linked to
+var organisationBackfills = []string{
+	`UPDATE deals SET organisation_id = (SELECT organisation_id FROM properties WHERE properties.id = deals.property_id)
+		WHERE (organisation_id IS NULL OR organisation_id = 0) AND property_id IS NOT NULL`,
+	`UPDATE deals SET organisation_id = (SELECT organisation_id FROM team_members WHERE team_members.id = deals.assigned_to)
+		WHERE (organisation_id IS NULL OR organisation_id = 0) AND assigned_to IS NOT NULL`,
+	`UPDATE documents SET organisation_id = (SELECT organisation_id FROM properties WHERE properties.id = documents.property_id)
+		WHERE (organisation_id IS NULL OR organisation_id = 0) AND property_id IS NOT NULL`,
+	`UPDATE documents SET organisation_id = (SELECT organisation_id FROM deals WHERE deals.id = documents.deal_id)
+		WHERE (organisation_id IS NULL OR organisation_id = 0) AND deal_id IS NOT NULL`,
+	`UPDATE documents SET organisation_id = (SELECT organisation_id FROM team_members WHERE team_members.id = documents.uploaded_by)
+		WHERE (organisation_id IS NULL OR organisation_id = 0) AND uploaded_by IS NOT NULL`,
+}
+
+// roleBackfills map roles from before role-based access control onto the
+// current set: free-form roles such as "user" become agents
+var roleBackfills = []string{
+	`UPDATE users SET role = 'agent' WHERE role NOT IN ('owner', 'admin', 'agent', 'read_only')`,
+	`UPDATE invitations SET role = 'agent' WHERE role NOT IN ('owner', 'admin', 'agent', 'read_only')`,
+}
+
+// ownerBackfills make the earliest user of an organisation without an owner
+// its owner, taking them to be its creator. They only hold while users.role
+// is the role in the user's only organisation, so they run once, before
+// memberships are created; after that an organisation can look ownerless
+// here merely because its owner acts in another organisation by default.
+var ownerBackfills = []string{
+	`UPDATE users SET role = 'owner' WHERE id IN (
+		SELECT MIN(id) FROM users WHERE organisation_id IS NOT NULL AND deleted_at IS NULL
+		GROUP BY organisation_id HAVING SUM(CASE WHEN role = 'owner' THEN 1 ELSE 0 END) = 0)`,
+}
+
+// emailVerificationBackfills mark users who joined through an emailed
+// invitation as verified, since following the link proved they own the address
+var emailVerificationBackfills = []string{
+	`UPDATE users SET email_verified = true WHERE email_verified = false AND EXISTS (
+		SELECT 1 FROM invitations WHERE LOWER(invitations.email) = LOWER(users.email) AND invitations.status = 'accepted')`,
+}
+
+// membershipBackfills give every user from before multi-organisation
+// membership a membership of their organisation, with their role there and
+// deactivated if their team member is, and tie their existing sessions and
+// API keys to it
+var membershipBackfills = []string{
+	`INSERT INTO memberships (user_id, organisation_id, role, deactivated_at, created_at, updated_at)
+		SELECT users.id, users.organisation_id, users.role,
+			(SELECT team_members.deactivated_at FROM team_members
+				WHERE team_members.user_id = users.id AND team_members.organisation_id = users.organisation_id),
+			users.created_at, CURRENT_TIMESTAMP
+		FROM users WHERE users.organisation_id IS NOT NULL AND users.deleted_at IS NULL AND NOT EXISTS (
+			SELECT 1 FROM memberships WHERE memberships.user_id = users.id AND memberships.organisation_id = users.organisation_id)`,
+	`UPDATE sessions SET organisation_id = (SELECT users.organisation_id FROM users WHERE users.id = sessions.user_id)
+		WHERE organisation_id IS NULL AND revoked_at IS NULL`,
+	`UPDATE api_keys SET organisation_id = (SELECT users.organisation_id FROM users WHERE users.id = api_keys.user_id)
+		WHERE organisation_id IS NULL AND revoked_at IS NULL`,
+}
+
+// hashInvitationTokens replaces the tokens of invitations from before only
+// their hash was stored with that hash, so links already sent keep working
+func hashInvitationTokens(db *gorm.DB) error {
+	migrator := db.Migrator()
+	if !migrator.HasTable(&models.Invitation{}) || !migrator.HasColumn(&models.Invitation{}, "token") {
+		return nil
+	}
+
+	return db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Migrator().RenameColumn(&models.Invitation{}, "token", "token_hash"); err != nil {
+			return err
+		}
+
+		var invitations []models.Invitation
+		if err := tx.Unscoped().Select("id", "token_hash").Find(&invitations).Error; err != nil {
+			return err
+		}
+		for _, invitation := range invitations {
+			sum := sha256.Sum256([]byte(invitation.TokenHash))
+			err := tx.Unscoped().Model(&models.Invitation{}).Where("id = ?", invitation.ID).
+				Update("token_hash", hex.EncodeToString(sum[:])).Error
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// runBackfills fixes up rows that predate a schema change. Each statement
+// must be safe to run on every start.
+func runBackfills(db *gorm.DB, statements []string) error {
+	for _, statement := range statements {
+		if err := db.Exec(statement).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
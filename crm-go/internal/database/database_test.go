@@ -0,0 +1,93 @@
+package database
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+
+	"gorm.io/gorm"
+
+	"crmgo/internal/models"
+	"crmgo/internal/tenant"
+)
+
+// openDB opens the database at path as the server does on start
+func openDB(t *testing.T, path string) *gorm.DB {
+	t.Helper()
+
+	db, err := InitDB(path)
+	if err != nil {
+		t.Fatalf("init db: %v", err)
+	}
+	sqlDB, _ := db.DB()
+	t.Cleanup(func() { sqlDB.Close() })
+	return db.WithContext(tenant.WithoutScope(context.Background()))
+}
+
+func roleOf(t *testing.T, db *gorm.DB, userID uint) models.Role {
+	t.Helper()
+
+	var user models.User
+	if err := db.Unscoped().First(&user, userID).Error; err != nil {
+		t.Fatalf("load user %d: %v", userID, err)
+	}
+	return user.Role
+}
+
+func TestOwnerBackfillOnlyRunsBeforeMemberships(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "crm.db")
+	db := openDB(t, path)
+
+	// A database from before memberships, whose users' roles predate
+	// role-based access control
+	if err := db.Migrator().DropTable(&models.Membership{}); err != nil {
+		t.Fatalf("drop memberships: %v", err)
+	}
+	organisation := models.Organisation{OrganisationName: "Acme Realty"}
+	if err := db.Create(&organisation).Error; err != nil {
+		t.Fatalf("seed organisation: %v", err)
+	}
+	var users []models.User
+	for _, email := range []string{"founder@example.com", "agent@example.com"} {
+		user := models.User{Email: email, Password: "hash", Role: "user", OrganisationID: &organisation.ID}
+		if err := db.Create(&user).Error; err != nil {
+			t.Fatalf("seed user: %v", err)
+		}
+		users = append(users, user)
+	}
+
+	db = openDB(t, path)
+	if role := roleOf(t, db, users[0].ID); role != models.RoleOwner {
+		t.Errorf("earliest user has role %s, want owner", role)
+	}
+	if role := roleOf(t, db, users[1].ID); role != models.RoleAgent {
+		t.Errorf("second user has role %s, want agent", role)
+	}
+	var membership models.Membership
+	if err := db.Where("user_id = ? AND organisation_id = ?", users[0].ID, organisation.ID).First(&membership).Error; err != nil || membership.Role != models.RoleOwner {
+		t.Errorf("founder's membership %+v (%v), want owner", membership, err)
+	}
+
+	// The owner makes another organisation their default, which leaves no
+	// user of the first one with the owner role
+	other := models.Organisation{OrganisationName: "Other Realty"}
+	if err := db.Create(&other).Error; err != nil {
+		t.Fatalf("seed organisation: %v", err)
+	}
+	if err := db.Create(&models.Membership{UserID: users[0].ID, OrganisationID: other.ID, Role: models.RoleAgent}).Error; err != nil {
+		t.Fatalf("seed membership: %v", err)
+	}
+	if err := db.Model(&models.User{}).Where("id = ?", users[0].ID).
+		Updates(map[string]interface{}{"organisation_id": other.ID, "role": models.RoleAgent}).Error; err != nil {
+		t.Fatalf("switch default organisation: %v", err)
+	}
+
+	db = openDB(t, path)
+	if role := roleOf(t, db, users[1].ID); role != models.RoleAgent {
+		t.Errorf("after a restart the agent has role %s, want agent", role)
+	}
+	var owners int64
+	if err := db.Model(&models.Membership{}).Where("organisation_id = ? AND role = ?", organisation.ID, models.RoleOwner).Count(&owners).Error; err != nil || owners != 1 {
+		t.Errorf("first organisation has %d owner memberships (%v), want 1", owners, err)
+	}
+}
@@ -3,15 +3,66 @@
 package models
 
 import (
+	"bytes"
 	"crmgo/internal/models"
+	"fmt"
+	"io"
+	"strconv"
 	"time"
 )
 
+type AddMeetingNoteInput struct {
+	MeetingID string `json:"meetingId"`
+	Content   string `json:"content"`
+}
+
 type AuthResult struct {
-	Token         string       `json:"token"`
-	User          *models.User `json:"user"`
-	SetupRequired *bool        `json:"setupRequired,omitempty"`
-	NextStep      *string      `json:"nextStep,omitempty"`
+	Token             *string      `json:"token,omitempty"`
+	RefreshToken      *string      `json:"refreshToken,omitempty"`
+	ExpiresAt         *time.Time   `json:"expiresAt,omitempty"`
+	User              *models.User `json:"user"`
+	SetupRequired     *bool        `json:"setupRequired,omitempty"`
+	NextStep          *string      `json:"nextStep,omitempty"`
+	TwoFactorRequired *bool        `json:"twoFactorRequired,omitempty"`
+	ChallengeToken    *string      `json:"challengeToken,omitempty"`
+}
+
+type BusinessHoursInput struct {
+	Day    models.Weekday `json:"day"`
+	Opens  string         `json:"opens"`
+	Closes string         `json:"closes"`
+}
+
+type ContactConnection struct {
+	Edges      []*ContactEdge `json:"edges"`
+	PageInfo   *PageInfo      `json:"pageInfo"`
+	TotalCount int            `json:"totalCount"`
+}
+
+type ContactEdge struct {
+	Cursor string          `json:"cursor"`
+	Node   *models.Contact `json:"node"`
+}
+
+type ContactFilter struct {
+	And       []*ContactFilter `json:"and,omitempty"`
+	Or        []*ContactFilter `json:"or,omitempty"`
+	Not       *ContactFilter   `json:"not,omitempty"`
+	Name      *TextFilter      `json:"name,omitempty"`
+	Email     *TextFilter      `json:"email,omitempty"`
+	Phone     *TextFilter      `json:"phone,omitempty"`
+	CreatedAt *DateRange       `json:"createdAt,omitempty"`
+}
+
+type ContactOrder struct {
+	Field     ContactOrderField `json:"field"`
+	Direction OrderDirection    `json:"direction"`
+}
+
+type CreateAPIKeyInput struct {
+	Name      string               `json:"name"`
+	Scopes    []models.APIKeyScope `json:"scopes"`
+	ExpiresAt *time.Time           `json:"expiresAt,omitempty"`
 }
 
 type CreateContactInput struct {
@@ -44,11 +95,12 @@ type CreateDocumentInput struct {
 }
 
 type CreateMeetingInput struct {
-	DealID      string    `json:"dealId"`
-	Datetime    time.Time `json:"datetime"`
-	Title       *string   `json:"title,omitempty"`
-	Description *string   `json:"description,omitempty"`
-	Location    *string   `json:"location,omitempty"`
+	DealID       *string   `json:"dealId,omitempty"`
+	TeamMemberID *string   `json:"teamMemberId,omitempty"`
+	Datetime     time.Time `json:"datetime"`
+	Title        *string   `json:"title,omitempty"`
+	Description  *string   `json:"description,omitempty"`
+	Location     *string   `json:"location,omitempty"`
 }
 
 type CreateOrganisationInput struct {
@@ -73,9 +125,85 @@ type CreateTaskInput struct {
 }
 
 type CreateTeamMemberInput struct {
-	TeamMemberName    string  `json:"teamMemberName"`
-	TeamMemberEmailID string  `json:"teamMemberEmailId"`
-	Role              *string `json:"role,omitempty"`
+	TeamMemberName    string       `json:"teamMemberName"`
+	TeamMemberEmailID string       `json:"teamMemberEmailId"`
+	Role              *models.Role `json:"role,omitempty"`
+}
+
+type CreatedAPIKey struct {
+	APIKey *models.APIKey `json:"apiKey"`
+	Key    string         `json:"key"`
+}
+
+type DateRange struct {
+	From *time.Time `json:"from,omitempty"`
+	To   *time.Time `json:"to,omitempty"`
+}
+
+type DealConnection struct {
+	Edges      []*DealEdge `json:"edges"`
+	PageInfo   *PageInfo   `json:"pageInfo"`
+	TotalCount int         `json:"totalCount"`
+}
+
+type DealEdge struct {
+	Cursor string       `json:"cursor"`
+	Node   *models.Deal `json:"node"`
+}
+
+type DealFilter struct {
+	And        []*DealFilter   `json:"and,omitempty"`
+	Or         []*DealFilter   `json:"or,omitempty"`
+	Not        *DealFilter     `json:"not,omitempty"`
+	Name       *TextFilter     `json:"name,omitempty"`
+	Status     []string        `json:"status,omitempty"`
+	Value      *FloatRange     `json:"value,omitempty"`
+	CreatedAt  *DateRange      `json:"createdAt,omitempty"`
+	AssignedTo []string        `json:"assignedTo,omitempty"`
+	Property   *PropertyFilter `json:"property,omitempty"`
+}
+
+type DealOrder struct {
+	Field     DealOrderField `json:"field"`
+	Direction OrderDirection `json:"direction"`
+}
+
+type DealStageInput struct {
+	Name   string `json:"name"`
+	Closed *bool  `json:"closed,omitempty"`
+}
+
+type DocumentConnection struct {
+	Edges      []*DocumentEdge `json:"edges"`
+	PageInfo   *PageInfo       `json:"pageInfo"`
+	TotalCount int             `json:"totalCount"`
+}
+
+type DocumentEdge struct {
+	Cursor string           `json:"cursor"`
+	Node   *models.Document `json:"node"`
+}
+
+type DocumentFilter struct {
+	And        []*DocumentFilter `json:"and,omitempty"`
+	Or         []*DocumentFilter `json:"or,omitempty"`
+	Not        *DocumentFilter   `json:"not,omitempty"`
+	Title      *TextFilter       `json:"title,omitempty"`
+	FileType   []string          `json:"fileType,omitempty"`
+	CreatedAt  *DateRange        `json:"createdAt,omitempty"`
+	UploadedBy []string          `json:"uploadedBy,omitempty"`
+	Deal       *DealFilter       `json:"deal,omitempty"`
+	Property   *PropertyFilter   `json:"property,omitempty"`
+}
+
+type DocumentOrder struct {
+	Field     DocumentOrderField `json:"field"`
+	Direction OrderDirection     `json:"direction"`
+}
+
+type FloatRange struct {
+	Min *float64 `json:"min,omitempty"`
+	Max *float64 `json:"max,omitempty"`
 }
 
 type HealthStatus struct {
@@ -85,9 +213,9 @@ type HealthStatus struct {
 }
 
 type InviteTeamMemberInput struct {
-	TeamMemberName    string  `json:"teamMemberName"`
-	TeamMemberEmailID string  `json:"teamMemberEmailId"`
-	Role              *string `json:"role,omitempty"`
+	TeamMemberName    string       `json:"teamMemberName"`
+	TeamMemberEmailID string       `json:"teamMemberEmailId"`
+	Role              *models.Role `json:"role,omitempty"`
 }
 
 type JoinOrganisationInput struct {
@@ -103,24 +231,97 @@ type LoginInput struct {
 type Mutation struct {
 }
 
+type PageInfo struct {
+	HasNextPage     bool    `json:"hasNextPage"`
+	HasPreviousPage bool    `json:"hasPreviousPage"`
+	StartCursor     *string `json:"startCursor,omitempty"`
+	EndCursor       *string `json:"endCursor,omitempty"`
+}
+
+type PropertyConnection struct {
+	Edges      []*PropertyEdge `json:"edges"`
+	PageInfo   *PageInfo       `json:"pageInfo"`
+	TotalCount int             `json:"totalCount"`
+}
+
+type PropertyEdge struct {
+	Cursor string           `json:"cursor"`
+	Node   *models.Property `json:"node"`
+}
+
+type PropertyFilter struct {
+	And       []*PropertyFilter `json:"and,omitempty"`
+	Or        []*PropertyFilter `json:"or,omitempty"`
+	Not       *PropertyFilter   `json:"not,omitempty"`
+	Name      *TextFilter       `json:"name,omitempty"`
+	Address   *TextFilter       `json:"address,omitempty"`
+	Status    []string          `json:"status,omitempty"`
+	CreatedAt *DateRange        `json:"createdAt,omitempty"`
+	Owner     *ContactFilter    `json:"owner,omitempty"`
+}
+
+type PropertyOrder struct {
+	Field     PropertyOrderField `json:"field"`
+	Direction OrderDirection     `json:"direction"`
+}
+
 type Query struct {
 }
 
 type RegisterInput struct {
-	Email    string  `json:"email"`
-	Password string  `json:"password"`
-	Role     *string `json:"role,omitempty"`
+	Email    string `json:"email"`
+	Password string `json:"password"`
 }
 
 type ResendInvitationInput struct {
 	TeamMemberID string `json:"teamMemberId"`
 }
 
+type TaskConnection struct {
+	Edges      []*TaskEdge `json:"edges"`
+	PageInfo   *PageInfo   `json:"pageInfo"`
+	TotalCount int         `json:"totalCount"`
+}
+
+type TaskEdge struct {
+	Cursor string       `json:"cursor"`
+	Node   *models.Task `json:"node"`
+}
+
+type TaskFilter struct {
+	And        []*TaskFilter `json:"and,omitempty"`
+	Or         []*TaskFilter `json:"or,omitempty"`
+	Not        *TaskFilter   `json:"not,omitempty"`
+	Title      *TextFilter   `json:"title,omitempty"`
+	Status     []string      `json:"status,omitempty"`
+	DueDate    *DateRange    `json:"dueDate,omitempty"`
+	CreatedAt  *DateRange    `json:"createdAt,omitempty"`
+	AssignedTo []string      `json:"assignedTo,omitempty"`
+	Deal       *DealFilter   `json:"deal,omitempty"`
+}
+
+type TaskOrder struct {
+	Field     TaskOrderField `json:"field"`
+	Direction OrderDirection `json:"direction"`
+}
+
+type TextFilter struct {
+	Equals     *string `json:"equals,omitempty"`
+	Contains   *string `json:"contains,omitempty"`
+	StartsWith *string `json:"startsWith,omitempty"`
+}
+
 type TokenInfo struct {
-	Name             string `json:"name"`
-	Email            string `json:"email"`
-	OrganizationName string `json:"organizationName"`
-	Role             string `json:"role"`
+	Name             string      `json:"name"`
+	Email            string      `json:"email"`
+	OrganizationName string      `json:"organizationName"`
+	Role             models.Role `json:"role"`
+	ExistingAccount  bool        `json:"existingAccount"`
+}
+
+type TwoFactorEnrollment struct {
+	Secret          string `json:"secret"`
+	ProvisioningURI string `json:"provisioningUri"`
 }
 
 type UpdateContactInput struct {
@@ -138,10 +339,31 @@ type UpdateDealInput struct {
 	Value      *float64 `json:"value,omitempty"`
 }
 
+type UpdateMeetingInput struct {
+	DealID       *string    `json:"dealId,omitempty"`
+	TeamMemberID *string    `json:"teamMemberId,omitempty"`
+	Datetime     *time.Time `json:"datetime,omitempty"`
+	Title        *string    `json:"title,omitempty"`
+	Description  *string    `json:"description,omitempty"`
+	Location     *string    `json:"location,omitempty"`
+}
+
+type UpdateMeetingNoteInput struct {
+	Content string `json:"content"`
+}
+
 type UpdateOrganisationInput struct {
 	OrganisationName string `json:"organisationName"`
 }
 
+type UpdateOrganisationSettingsInput struct {
+	DefaultCurrency *string               `json:"defaultCurrency,omitempty"`
+	TimeZone        *string               `json:"timeZone,omitempty"`
+	Locale          *string               `json:"locale,omitempty"`
+	BusinessHours   []*BusinessHoursInput `json:"businessHours,omitempty"`
+	DealStages      []*DealStageInput     `json:"dealStages,omitempty"`
+}
+
 type UpdatePropertyInput struct {
 	Name    string  `json:"name"`
 	Address *string `json:"address,omitempty"`
@@ -162,3 +384,347 @@ type UpdateTeamMemberInput struct {
 	TeamMemberName    string `json:"teamMemberName"`
 	TeamMemberEmailID string `json:"teamMemberEmailId"`
 }
+
+type ContactOrderField string
+
+const (
+	ContactOrderFieldName      ContactOrderField = "NAME"
+	ContactOrderFieldEmail     ContactOrderField = "EMAIL"
+	ContactOrderFieldCreatedAt ContactOrderField = "CREATED_AT"
+)
+
+var AllContactOrderField = []ContactOrderField{
+	ContactOrderFieldName,
+	ContactOrderFieldEmail,
+	ContactOrderFieldCreatedAt,
+}
+
+func (e ContactOrderField) IsValid() bool {
+	switch e {
+	case ContactOrderFieldName, ContactOrderFieldEmail, ContactOrderFieldCreatedAt:
+		return true
+	}
+	return false
+}
+
+func (e ContactOrderField) String() string {
+	return string(e)
+}
+
+func (e *ContactOrderField) UnmarshalGQL(v any) error {
+	str, ok := v.(string)
+	if !ok {
+		return fmt.Errorf("enums must be strings")
+	}
+
+	*e = ContactOrderField(str)
+	if !e.IsValid() {
+		return fmt.Errorf("%s is not a valid ContactOrderField", str)
+	}
+	return nil
+}
+
+func (e ContactOrderField) MarshalGQL(w io.Writer) {
+	fmt.Fprint(w, strconv.Quote(e.String()))
+}
+
+func (e *ContactOrderField) UnmarshalJSON(b []byte) error {
+	s, err := strconv.Unquote(string(b))
+	if err != nil {
+		return err
+	}
+	return e.UnmarshalGQL(s)
+}
+
+func (e ContactOrderField) MarshalJSON() ([]byte, error) {
+	var buf bytes.Buffer
+	e.MarshalGQL(&buf)
+	return buf.Bytes(), nil
+}
+
+type DealOrderField string
+
+const (
+	DealOrderFieldName      DealOrderField = "NAME"
+	DealOrderFieldStatus    DealOrderField = "STATUS"
+	DealOrderFieldValue     DealOrderField = "VALUE"
+	DealOrderFieldCreatedAt DealOrderField = "CREATED_AT"
+)
+
+var AllDealOrderField = []DealOrderField{
+	DealOrderFieldName,
+	DealOrderFieldStatus,
+	DealOrderFieldValue,
+	DealOrderFieldCreatedAt,
+}
+
+func (e DealOrderField) IsValid() bool {
+	switch e {
+	case DealOrderFieldName, DealOrderFieldStatus, DealOrderFieldValue, DealOrderFieldCreatedAt:
+		return true
+	}
+	return false
+}
+
+func (e DealOrderField) String() string {
+	return string(e)
+}
+
+func (e *DealOrderField) UnmarshalGQL(v any) error {
+	str, ok := v.(string)
+	if !ok {
+		return fmt.Errorf("enums must be strings")
+	}
+
+	*e = DealOrderField(str)
+	if !e.IsValid() {
+		return fmt.Errorf("%s is not a valid DealOrderField", str)
+	}
+	return nil
+}
+
+func (e DealOrderField) MarshalGQL(w io.Writer) {
+	fmt.Fprint(w, strconv.Quote(e.String()))
+}
+
+func (e *DealOrderField) UnmarshalJSON(b []byte) error {
+	s, err := strconv.Unquote(string(b))
+	if err != nil {
+		return err
+	}
+	return e.UnmarshalGQL(s)
+}
+
+func (e DealOrderField) MarshalJSON() ([]byte, error) {
+	var buf bytes.Buffer
+	e.MarshalGQL(&buf)
+	return buf.Bytes(), nil
+}
+
+type DocumentOrderField string
+
+const (
+	DocumentOrderFieldTitle     DocumentOrderField = "TITLE"
+	DocumentOrderFieldFileSize  DocumentOrderField = "FILE_SIZE"
+	DocumentOrderFieldCreatedAt DocumentOrderField = "CREATED_AT"
+)
+
+var AllDocumentOrderField = []DocumentOrderField{
+	DocumentOrderFieldTitle,
+	DocumentOrderFieldFileSize,
+	DocumentOrderFieldCreatedAt,
+}
+
+func (e DocumentOrderField) IsValid() bool {
+	switch e {
+	case DocumentOrderFieldTitle, DocumentOrderFieldFileSize, DocumentOrderFieldCreatedAt:
+		return true
+	}
+	return false
+}
+
+func (e DocumentOrderField) String() string {
+	return string(e)
+}
+
+func (e *DocumentOrderField) UnmarshalGQL(v any) error {
+	str, ok := v.(string)
+	if !ok {
+		return fmt.Errorf("enums must be strings")
+	}
+
+	*e = DocumentOrderField(str)
+	if !e.IsValid() {
+		return fmt.Errorf("%s is not a valid DocumentOrderField", str)
+	}
+	return nil
+}
+
+func (e DocumentOrderField) MarshalGQL(w io.Writer) {
+	fmt.Fprint(w, strconv.Quote(e.String()))
+}
+
+func (e *DocumentOrderField) UnmarshalJSON(b []byte) error {
+	s, err := strconv.Unquote(string(b))
+	if err != nil {
+		return err
+	}
+	return e.UnmarshalGQL(s)
+}
+
+func (e DocumentOrderField) MarshalJSON() ([]byte, error) {
+	var buf bytes.Buffer
+	e.MarshalGQL(&buf)
+	return buf.Bytes(), nil
+}
+
+type OrderDirection string
+
+const (
+	OrderDirectionAsc  OrderDirection = "ASC"
+	OrderDirectionDesc OrderDirection = "DESC"
+)
+
+var AllOrderDirection = []OrderDirection{
+	OrderDirectionAsc,
+	OrderDirectionDesc,
+}
+
+func (e OrderDirection) IsValid() bool {
+	switch e {
+	case OrderDirectionAsc, OrderDirectionDesc:
+		return true
+	}
+	return false
+}
+
+func (e OrderDirection) String() string {
+	return string(e)
+}
+
+func (e *OrderDirection) UnmarshalGQL(v any) error {
+	str, ok := v.(string)
+	if !ok {
+		return fmt.Errorf("enums must be strings")
+	}
+
+	*e = OrderDirection(str)
+	if !e.IsValid() {
+		return fmt.Errorf("%s is not a valid OrderDirection", str)
+	}
+	return nil
+}
+
+func (e OrderDirection) MarshalGQL(w io.Writer) {
+	fmt.Fprint(w, strconv.Quote(e.String()))
+}
+
+func (e *OrderDirection) UnmarshalJSON(b []byte) error {
+	s, err := strconv.Unquote(string(b))
+	if err != nil {
+		return err
+	}
+	return e.UnmarshalGQL(s)
+}
+
+func (e OrderDirection) MarshalJSON() ([]byte, error) {
+	var buf bytes.Buffer
+	e.MarshalGQL(&buf)
+	return buf.Bytes(), nil
+}
+
+type PropertyOrderField string
+
+const (
+	PropertyOrderFieldName      PropertyOrderField = "NAME"
+	PropertyOrderFieldStatus    PropertyOrderField = "STATUS"
+	PropertyOrderFieldCreatedAt PropertyOrderField = "CREATED_AT"
+)
+
+var AllPropertyOrderField = []PropertyOrderField{
+	PropertyOrderFieldName,
+	PropertyOrderFieldStatus,
+	PropertyOrderFieldCreatedAt,
+}
+
+func (e PropertyOrderField) IsValid() bool {
+	switch e {
+	case PropertyOrderFieldName, PropertyOrderFieldStatus, PropertyOrderFieldCreatedAt:
+		return true
+	}
+	return false
+}
+
+func (e PropertyOrderField) String() string {
+	return string(e)
+}
+
+func (e *PropertyOrderField) UnmarshalGQL(v any) error {
+	str, ok := v.(string)
+	if !ok {
+		return fmt.Errorf("enums must be strings")
+	}
+
+	*e = PropertyOrderField(str)
+	if !e.IsValid() {
+		return fmt.Errorf("%s is not a valid PropertyOrderField", str)
+	}
+	return nil
+}
+
+func (e PropertyOrderField) MarshalGQL(w io.Writer) {
+	fmt.Fprint(w, strconv.Quote(e.String()))
+}
+
+func (e *PropertyOrderField) UnmarshalJSON(b []byte) error {
+	s, err := strconv.Unquote(string(b))
+	if err != nil {
+		return err
+	}
+	return e.UnmarshalGQL(s)
+}
+
+func (e PropertyOrderField) MarshalJSON() ([]byte, error) {
+	var buf bytes.Buffer
+	e.MarshalGQL(&buf)
+	return buf.Bytes(), nil
+}
+
+type TaskOrderField string
+
+const (
+	TaskOrderFieldTitle     TaskOrderField = "TITLE"
+	TaskOrderFieldStatus    TaskOrderField = "STATUS"
+	TaskOrderFieldDueDate   TaskOrderField = "DUE_DATE"
+	TaskOrderFieldCreatedAt TaskOrderField = "CREATED_AT"
+)
+
+var AllTaskOrderField = []TaskOrderField{
+	TaskOrderFieldTitle,
+	TaskOrderFieldStatus,
+	TaskOrderFieldDueDate,
+	TaskOrderFieldCreatedAt,
+}
+
+func (e TaskOrderField) IsValid() bool {
+	switch e {
+	case TaskOrderFieldTitle, TaskOrderFieldStatus, TaskOrderFieldDueDate, TaskOrderFieldCreatedAt:
+		return true
+	}
+	return false
+}
+
+func (e TaskOrderField) String() string {
+	return string(e)
+}
+
+func (e *TaskOrderField) UnmarshalGQL(v any) error {
+	str, ok := v.(string)
+	if !ok {
+		return fmt.Errorf("enums must be strings")
+	}
+
+	*e = TaskOrderField(str)
+	if !e.IsValid() {
+		return fmt.Errorf("%s is not a valid TaskOrderField", str)
+	}
+	return nil
+}
+
+func (e TaskOrderField) MarshalGQL(w io.Writer) {
+	fmt.Fprint(w, strconv.Quote(e.String()))
+}
+
+func (e *TaskOrderField) UnmarshalJSON(b []byte) error {
+	s, err := strconv.Unquote(string(b))
+	if err != nil {
+		return err
+	}
+	return e.UnmarshalGQL(s)
+}
+
+func (e TaskOrderField) MarshalJSON() ([]byte, error) {
+	var buf bytes.Buffer
+	e.MarshalGQL(&buf)
+	return buf.Bytes(), nil
+}
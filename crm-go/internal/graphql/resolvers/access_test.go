@@ -0,0 +1,207 @@
+package resolvers_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/99designs/gqlgen/client"
+	"github.com/99designs/gqlgen/graphql"
+	"github.com/vektah/gqlparser/v2/ast"
+
+	"crmgo/internal/auth"
+	"crmgo/internal/config"
+	"crmgo/internal/database"
+	"crmgo/internal/graphql/generated"
+	"crmgo/internal/graphql/resolvers"
+	"crmgo/internal/services"
+	"crmgo/internal/storage"
+)
+
+// newServer builds the GraphQL server the way the application does, with the
+// real access directives. Requests run as userID, or anonymously when it is 0.
+func newServer(t *testing.T, userID uint) (*client.Client, *resolvers.Resolver) {
+	t.Helper()
+
+	db, err := database.InitDB(":memory:")
+	if err != nil {
+		t.Fatalf("init db: %v", err)
+	}
+	store, err := storage.NewLocalStore(t.TempDir())
+	if err != nil {
+		t.Fatalf("init storage: %v", err)
+	}
+	cfg := &config.Config{
+		JWTSecret:     "test-secret",
+		JWTKeyID:      "test",
+		JWTIssuer:     "crm-go",
+		JWTAudience:   "crm-dashboard",
+		FrontendURL:   "http://localhost:3000",
+		MaxUploadSize: 1 << 20,
+		MaxPageSize:   100,
+	}
+	tokens, err := auth.NewTokensFromConfig(cfg)
+	if err != nil {
+		t.Fatalf("init tokens: %v", err)
+	}
+	resolver := resolvers.NewResolver(db, cfg, services.NewEmailService("", "crm@example.com", "CRM"), store, tokens)
+
+	withLoaders := resolver.DataLoaders(resolver.GraphQLServer())
+
+	return client.New(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if userID != 0 {
+			r = r.WithContext(auth.WithPrincipal(r.Context(), &auth.Principal{UserID: userID, Method: auth.MethodSession}))
+		}
+		withLoaders.ServeHTTP(w, r)
+	})), resolver
+}
+
+// graphqlError is an entry of a response's errors list
+type graphqlError struct {
+	Message string   `json:"message"`
+	Path    []string `json:"path"`
+}
+
+// post runs a query and returns its data and error messages
+func post(t *testing.T, c *client.Client, query string, options ...client.Option) (map[string]interface{}, []graphqlError) {
+	t.Helper()
+
+	resp, err := c.RawPost(query, options...)
+	if err != nil {
+		t.Fatalf("post %q: %v", query, err)
+	}
+
+	var data map[string]interface{}
+	if resp.Data != nil {
+		raw, _ := json.Marshal(resp.Data)
+		json.Unmarshal(raw, &data)
+	}
+	var errs []graphqlError
+	if len(resp.Errors) > 0 {
+		if err := json.Unmarshal(resp.Errors, &errs); err != nil {
+			t.Fatalf("decode errors %s: %v", resp.Errors, err)
+		}
+	}
+	return data, errs
+}
+
+func accessDenied(errs []graphqlError) bool {
+	for _, e := range errs {
+		if strings.HasPrefix(e.Message, "access denied") {
+			return true
+		}
+	}
+	return false
+}
+
+func TestRootFieldsDeclareAccess(t *testing.T) {
+	schema := generated.NewExecutableSchema(generated.Config{}).Schema()
+
+	for _, object := range []*ast.Definition{schema.Query, schema.Mutation} {
+		for _, field := range object.Fields {
+			if strings.HasPrefix(field.Name, "__") {
+				continue
+			}
+			declared := 0
+			for _, name := range []string{"public", "auth", "hasRole"} {
+				if field.Directives.ForName(name) != nil {
+					declared++
+				}
+			}
+			if declared != 1 {
+				t.Errorf("%s.%s declares %d access directives, want exactly one of @public, @auth or @hasRole", object.Name, field.Name, declared)
+			}
+		}
+	}
+}
+
+func TestPublicOperationsWorkAnonymously(t *testing.T) {
+	c, _ := newServer(t, 0)
+
+	data, errs := post(t, c, `query Health { health { status } }`)
+	if len(errs) > 0 || data["health"] == nil {
+		t.Errorf("health: data %v, errors %v", data, errs)
+	}
+
+	data, errs = post(t, c, `{ __schema { queryType { name } } }`)
+	if len(errs) > 0 || data["__schema"] == nil {
+		t.Errorf("introspection: data %v, errors %v", data, errs)
+	}
+
+	data, errs = post(t, c, `mutation($input: RegisterInput!) { register(input: $input) { token user { email } } }`,
+		client.Var("input", map[string]interface{}{"email": "jane@example.com", "password": "correct-horse"}))
+	if len(errs) > 0 || data["register"] == nil {
+		t.Fatalf("register: data %v, errors %v", data, errs)
+	}
+
+	data, errs = post(t, c, `mutation($input: LoginInput!) { login(input: $input) { token } }`,
+		client.Var("input", map[string]interface{}{"email": "jane@example.com", "password": "correct-horse"}))
+	if len(errs) > 0 || data["login"] == nil {
+		t.Errorf("login: data %v, errors %v", data, errs)
+	}
+
+	// Public operations that reject their input must do so on their own
+	// merits, not for want of a signed-in user
+	for _, query := range []string{
+		`{ verifyInvitationToken(token: "unknown") { email } }`,
+		`mutation { requestPasswordReset(email: "nobody@example.com") }`,
+		`mutation { resetPassword(token: "unknown", newPassword: "correct-horse") }`,
+		`mutation { verifyEmail(token: "unknown") }`,
+		`mutation { refreshToken(refreshToken: "unknown") { token } }`,
+		`mutation { verifyTwoFactor(challengeToken: "unknown", code: "123456") { token } }`,
+		`mutation { completeSsoLogin(code: "unknown") { token } }`,
+		`mutation { joinOrganisation(input: {token: "unknown", password: "correct-horse"}) { token } }`,
+	} {
+		if _, errs := post(t, c, query); accessDenied(errs) {
+			t.Errorf("%s was refused to an anonymous caller: %v", query, errs)
+		}
+	}
+}
+
+func TestProtectedOperationsRequireAuthentication(t *testing.T) {
+	c, _ := newServer(t, 0)
+
+	for _, query := range []string{
+		`{ me { id } }`,
+		`{ deals { id } }`,
+		`mutation { logout }`,
+		`mutation { createContact(input: {name: "Sam"}) { id } }`,
+	} {
+		if _, errs := post(t, c, query); !accessDenied(errs) {
+			t.Errorf("%s was allowed for an anonymous caller: %v", query, errs)
+		}
+	}
+
+	// Mentioning a public field no longer opens up the rest of the query
+	data, errs := post(t, c, `query Health { health { status } deal(id: "1") { id } }`)
+	if data["health"] == nil || !accessDenied(errs) {
+		t.Errorf("mixed query: data %v, errors %v", data, errs)
+	}
+}
+
+func TestFieldsWithoutAccessDirectiveAreRefused(t *testing.T) {
+	_, resolver := newServer(t, 1)
+
+	resolve := func(object string, definition *ast.FieldDefinition) error {
+		ctx := graphql.WithFieldContext(context.Background(), &graphql.FieldContext{
+			Object: object,
+			Field:  graphql.CollectedField{Field: &ast.Field{Name: definition.Name, Definition: definition}},
+		})
+		_, err := resolver.RequireAccessDirective(ctx, func(ctx context.Context) (interface{}, error) {
+			return true, nil
+		})
+		return err
+	}
+
+	if err := resolve("Query", &ast.FieldDefinition{Name: "secrets"}); err == nil {
+		t.Error("root field without an access directive was resolved")
+	}
+	if err := resolve("Mutation", &ast.FieldDefinition{Name: "login", Directives: ast.DirectiveList{{Name: "public"}}}); err != nil {
+		t.Errorf("public root field refused: %v", err)
+	}
+	if err := resolve("Deal", &ast.FieldDefinition{Name: "name"}); err != nil {
+		t.Errorf("non-root field refused: %v", err)
+	}
+}
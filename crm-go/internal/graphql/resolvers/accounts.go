@@ -0,0 +1,143 @@
+package resolvers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+
+	"crmgo/internal/models"
+
+	"gorm.io/gorm"
+)
+
+// errInvalidUserToken is returned for password reset and verification
+// tokens that are unknown, expired or already used
+var errInvalidUserToken = errors.New("invalid or expired link")
+
+// issueUserToken creates a single-use token for user, replacing any unused
+// token with the same purpose, and returns the plain token to email
+func (r *Resolver) issueUserToken(ctx context.Context, userID uint, purpose string, ttl time.Duration) (string, error) {
+	token, err := generateSecureToken(32)
+	if err != nil {
+		return "", err
+	}
+
+	// Start DB transaction
+	tx := r.db(ctx).Begin()
+	defer func() {
+		if r := recover(); r != nil {
+			tx.Rollback()
+		}
+	}()
+
+	if err := tx.Model(&models.UserToken{}).
+		Where("user_id = ? AND purpose = ? AND used_at IS NULL", userID, purpose).
+		Update("used_at", time.Now()).Error; err != nil {
+		tx.Rollback()
+		return "", err
+	}
+
+	userToken := models.UserToken{
+		UserID:    userID,
+		Purpose:   purpose,
+		TokenHash: hashToken(token),
+		ExpiresAt: time.Now().Add(ttl),
+	}
+	if err := tx.Create(&userToken).Error; err != nil {
+		tx.Rollback()
+		return "", err
+	}
+
+	if err := tx.Commit().Error; err != nil {
+		return "", err
+	}
+
+	return token, nil
+}
+
+// findUserToken returns a token that is still unused and unexpired
+func findUserToken(tx *gorm.DB, token, purpose string) (*models.UserToken, error) {
+	var userToken models.UserToken
+	err := tx.Where("token_hash = ? AND purpose = ?", hashToken(token), purpose).First(&userToken).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, errInvalidUserToken
+		}
+		return nil, err
+	}
+	if userToken.UsedAt != nil || time.Now().After(userToken.ExpiresAt) {
+		return nil, errInvalidUserToken
+	}
+	return &userToken, nil
+}
+
+// consumeUserToken marks a token as used and returns it. Marking it used is
+// conditional on it still being unused, so two concurrent requests cannot
+// both redeem the same link.
+func consumeUserToken(tx *gorm.DB, token, purpose string) (*models.UserToken, error) {
+	userToken, err := findUserToken(tx, token, purpose)
+	if err != nil {
+		return nil, err
+	}
+
+	result := tx.Model(&models.UserToken{}).
+		Where("id = ? AND used_at IS NULL", userToken.ID).
+		Update("used_at", time.Now())
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	if result.RowsAffected == 0 {
+		return nil, errInvalidUserToken
+	}
+
+	return userToken, nil
+}
+
+// markEmailVerified records that user has proved they own their email address
+func markEmailVerified(tx *gorm.DB, userID uint) error {
+	return tx.Model(&models.User{}).
+		Where("id = ? AND email_verified = ?", userID, false).
+		Updates(map[string]interface{}{"email_verified": true, "email_verified_at": time.Now()}).Error
+}
+
+// sendVerificationEmail emails user a link to verify their address
+func (r *Resolver) sendVerificationEmail(ctx context.Context, user *models.User) error {
+	if r.EmailService == nil {
+		return fmt.Errorf("email service is not configured")
+	}
+
+	token, err := r.issueUserToken(ctx, user.ID, models.UserTokenEmailVerification, models.EmailVerificationTTL)
+	if err != nil {
+		return err
+	}
+
+	return r.EmailService.SendVerificationEmail(user.Email, r.frontendLink("/verify-email", token))
+}
+
+// sendPasswordResetEmail emails user a link to choose a new password
+func (r *Resolver) sendPasswordResetEmail(ctx context.Context, user *models.User) error {
+	if r.EmailService == nil {
+		return fmt.Errorf("email service is not configured")
+	}
+
+	token, err := r.issueUserToken(ctx, user.ID, models.UserTokenPasswordReset, models.PasswordResetTTL)
+	if err != nil {
+		return err
+	}
+
+	return r.EmailService.SendPasswordResetEmail(user.Email, r.frontendLink("/reset-password", token))
+}
+
+// frontendLink builds a link to a frontend page carrying a token
+func (r *Resolver) frontendLink(path, token string) string {
+	return fmt.Sprintf("%s%s?token=%s", strings.TrimRight(r.Config.FrontendURL, "/"), path, url.QueryEscape(token))
+}
+
+// mustVerifyEmail reports whether user has to verify their email address
+// before they may sign in
+func (r *Resolver) mustVerifyEmail(user *models.User) bool {
+	return r.Config.RequireEmailVerification && !user.EmailVerified
+}
@@ -0,0 +1,172 @@
+package resolvers_test
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/99designs/gqlgen/client"
+
+	"crmgo/internal/auth"
+	"crmgo/internal/graphql/resolvers"
+	"crmgo/internal/models"
+	"crmgo/internal/tenant"
+)
+
+// seedUserToken stores a token for userID the way links are emailed, as a
+// SHA-256 digest, and returns the token to redeem
+func seedUserToken(t *testing.T, resolver *resolvers.Resolver, userID uint, purpose string, ttl time.Duration) string {
+	t.Helper()
+
+	token := fmt.Sprintf("%s-%d-%d", purpose, userID, time.Now().UnixNano())
+	sum := sha256.Sum256([]byte(token))
+	userToken := models.UserToken{UserID: userID, Purpose: purpose, TokenHash: hex.EncodeToString(sum[:]), ExpiresAt: time.Now().Add(ttl)}
+	db := resolver.DB.WithContext(tenant.WithoutScope(context.Background()))
+	if err := db.Create(&userToken).Error; err != nil {
+		t.Fatalf("seed %s token: %v", purpose, err)
+	}
+	return token
+}
+
+func resetPassword(t *testing.T, c *client.Client, token, password string) []graphqlError {
+	t.Helper()
+
+	_, errs := post(t, c, `mutation($token: String!, $password: String!) { resetPassword(token: $token, newPassword: $password) }`,
+		client.Var("token", token), client.Var("password", password))
+	return errs
+}
+
+func verifyEmail(t *testing.T, c *client.Client, token string) []graphqlError {
+	t.Helper()
+
+	_, errs := post(t, c, `mutation($token: String!) { verifyEmail(token: $token) }`, client.Var("token", token))
+	return errs
+}
+
+func invalidLink(errs []graphqlError) bool {
+	return len(errs) > 0 && strings.Contains(errs[0].Message, "invalid or expired link")
+}
+
+func TestPasswordResetLinksWorkOnce(t *testing.T) {
+	_, resolver := newServer(t, 0)
+	seedDeals(t, resolver, 0)
+	authenticator := withSessions(resolver)
+	c := tokenClient(resolver, authenticator)
+	sam := seedMember(t, resolver, "sam@example.com", "correct-horse")
+
+	token, _ := signIn(t, c, sam.Email, "correct-horse")
+	link := seedUserToken(t, resolver, sam.ID, models.UserTokenPasswordReset, models.PasswordResetTTL)
+	if errs := resetPassword(t, c, link, "battery-staple"); len(errs) > 0 {
+		t.Fatalf("reset password: %v", errs)
+	}
+	if msg := login(t, c, sam.Email, "correct-horse"); msg != "invalid email or password" {
+		t.Errorf("login with the old password: %q, want it refused", msg)
+	}
+	if msg := login(t, c, sam.Email, "battery-staple"); msg != "" {
+		t.Errorf("login with the new password: %q", msg)
+	}
+
+	// Whoever knew the old password is signed out
+	if err := authenticate(authenticator, "Bearer "+token); !errors.Is(err, auth.ErrSessionRevoked) {
+		t.Errorf("session from before the reset: %v, want it revoked", err)
+	}
+
+	if errs := resetPassword(t, c, link, "tr0ub4dor"); !invalidLink(errs) {
+		t.Errorf("reusing the reset link: %v, want a refusal", errs)
+	}
+
+	expired := seedUserToken(t, resolver, sam.ID, models.UserTokenPasswordReset, -time.Minute)
+	if errs := resetPassword(t, c, expired, "tr0ub4dor"); !invalidLink(errs) {
+		t.Errorf("expired reset link: %v, want a refusal", errs)
+	}
+
+	// Links only work for what they were sent for
+	verification := seedUserToken(t, resolver, sam.ID, models.UserTokenEmailVerification, models.EmailVerificationTTL)
+	if errs := resetPassword(t, c, verification, "tr0ub4dor"); !invalidLink(errs) {
+		t.Errorf("verification link used to reset the password: %v, want a refusal", errs)
+	}
+	if msg := login(t, c, sam.Email, "battery-staple"); msg != "" {
+		t.Errorf("refused resets changed the password: %q", msg)
+	}
+}
+
+func TestRequestingAResetRevealsNoAccounts(t *testing.T) {
+	c, resolver := newServer(t, 0)
+	seedDeals(t, resolver, 0)
+	sam := seedMember(t, resolver, "sam@example.com", "correct-horse")
+	db := resolver.DB.WithContext(tenant.WithoutScope(context.Background()))
+
+	earlier := seedUserToken(t, resolver, sam.ID, models.UserTokenPasswordReset, models.PasswordResetTTL)
+
+	for _, email := range []string{" Sam@Example.com ", "nobody@example.com"} {
+		data, errs := post(t, c, `mutation($email: String!) { requestPasswordReset(email: $email) }`, client.Var("email", email))
+		if len(errs) > 0 || data["requestPasswordReset"] != true {
+			t.Errorf("reset requested for %q: %v %v, want true without errors", email, data, errs)
+		}
+	}
+
+	var tokens []models.UserToken
+	if err := db.Where("purpose = ? AND used_at IS NULL", models.UserTokenPasswordReset).Find(&tokens).Error; err != nil {
+		t.Fatalf("load tokens: %v", err)
+	}
+	if len(tokens) != 1 || tokens[0].UserID != sam.ID {
+		t.Fatalf("unused reset tokens %+v, want one for sam", tokens)
+	}
+	if !regexp.MustCompile(`^[0-9a-f]{64}$`).MatchString(tokens[0].TokenHash) {
+		t.Errorf("reset token stored as %q, want a SHA-256 digest", tokens[0].TokenHash)
+	}
+
+	// A new link replaces the one sent before it
+	if errs := resetPassword(t, c, earlier, "battery-staple"); !invalidLink(errs) {
+		t.Errorf("link sent before the latest one: %v, want a refusal", errs)
+	}
+}
+
+func TestUnverifiedUsersCannotSignIn(t *testing.T) {
+	c, resolver := newServer(t, 0)
+	seedDeals(t, resolver, 0)
+	withSessions(resolver)
+	sam := seedMember(t, resolver, "sam@example.com", "correct-horse")
+	db := resolver.DB.WithContext(tenant.WithoutScope(context.Background()))
+
+	if msg := login(t, c, sam.Email, "correct-horse"); msg != "" {
+		t.Fatalf("login without verification required: %q", msg)
+	}
+
+	resolver.Config.RequireEmailVerification = true
+	if msg := login(t, c, sam.Email, "correct-horse"); !strings.Contains(msg, "verify your email address") {
+		t.Errorf("unverified login: %q, want it refused", msg)
+	}
+	if n := countLoginEvents(t, db, sam.ID, models.LoginEventRefused); n != 1 {
+		t.Errorf("%d refused sign-ins recorded, want 1", n)
+	}
+
+	expired := seedUserToken(t, resolver, sam.ID, models.UserTokenEmailVerification, -time.Minute)
+	if errs := verifyEmail(t, c, expired); !invalidLink(errs) {
+		t.Errorf("expired verification link: %v, want a refusal", errs)
+	}
+	reset := seedUserToken(t, resolver, sam.ID, models.UserTokenPasswordReset, models.PasswordResetTTL)
+	if errs := verifyEmail(t, c, reset); !invalidLink(errs) {
+		t.Errorf("reset link used to verify: %v, want a refusal", errs)
+	}
+	if msg := login(t, c, sam.Email, "correct-horse"); !strings.Contains(msg, "verify your email address") {
+		t.Errorf("login after refused verifications: %q, want it refused", msg)
+	}
+
+	link := seedUserToken(t, resolver, sam.ID, models.UserTokenEmailVerification, models.EmailVerificationTTL)
+	if errs := verifyEmail(t, c, link); len(errs) > 0 {
+		t.Fatalf("verify email: %v", errs)
+	}
+	if msg := login(t, c, sam.Email, "correct-horse"); msg != "" {
+		t.Errorf("verified login: %q", msg)
+	}
+	if errs := verifyEmail(t, c, link); !invalidLink(errs) {
+		t.Errorf("reusing the verification link: %v, want a refusal", errs)
+	}
+}
@@ -0,0 +1,139 @@
+package resolvers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"crmgo/internal/auth"
+	"crmgo/internal/models"
+	"crmgo/internal/tenant"
+
+	"github.com/99designs/gqlgen/graphql"
+	"github.com/vektah/gqlparser/v2/ast"
+	"gorm.io/gorm"
+)
+
+// apiKeyPrefix marks API keys so they are easy to recognise, for example by
+// secret scanners
+const apiKeyPrefix = "crm_"
+
+// apiKeyDisplayLength is how much of a key is kept in plain text to tell
+// keys apart
+const apiKeyDisplayLength = len(apiKeyPrefix) + 8
+
+// apiKeyTouchInterval limits how often a key's last-used time is written, so
+// busy scripts do not cause a write on every request
+const apiKeyTouchInterval = time.Minute
+
+// errInvalidAPIKey is returned for API keys that are unknown, expired or revoked
+var errInvalidAPIKey = errors.New("invalid or expired API key")
+
+// AuthenticateAPIKey returns the caller behind an active API key. The auth
+// middleware uses it for requests sent with an ApiKey authorization header.
+func (r *Resolver) AuthenticateAPIKey(ctx context.Context, key string) (*auth.Principal, error) {
+	key = strings.TrimSpace(key)
+	if !strings.HasPrefix(key, apiKeyPrefix) {
+		return nil, errInvalidAPIKey
+	}
+
+	var apiKey models.APIKey
+	if err := r.db(ctx).Preload("User").Where("key_hash = ?", hashToken(key)).First(&apiKey).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, errInvalidAPIKey
+		}
+		return nil, err
+	}
+
+	// Keys stop working once revoked, expired or their user is deleted
+	if !apiKey.IsActive() || apiKey.User.ID == 0 {
+		return nil, errInvalidAPIKey
+	}
+
+	now := time.Now()
+	if apiKey.LastUsedAt == nil || now.Sub(*apiKey.LastUsedAt) > apiKeyTouchInterval {
+		if err := r.db(ctx).Model(&models.APIKey{}).Where("id = ?", apiKey.ID).Update("last_used_at", now).Error; err != nil {
+			return nil, err
+		}
+	}
+
+	principal := &auth.Principal{
+		UserID:   apiKey.UserID,
+		Email:    apiKey.User.Email,
+		Role:     apiKey.User.Role,
+		Method:   auth.MethodAPIKey,
+		APIKeyID: apiKey.ID,
+		Scopes:   apiKey.ScopeList(),
+	}
+	// Keys act in the organisation they were created in, and stop working
+	// while the user is deactivated there
+	if apiKey.OrganisationID != nil {
+		principal.OrganisationID = *apiKey.OrganisationID
+		membership, err := checkMembership(r.db(ctx), apiKey.UserID, principal.OrganisationID)
+		if errors.Is(err, errNotMember) || errors.Is(err, errAccountDeactivated) {
+			return nil, errInvalidAPIKey
+		}
+		if err != nil {
+			return nil, err
+		}
+		principal.Role = membership.Role
+
+		teamMember, err := findUserTeamMember(r.db(tenant.WithOrganisation(ctx, principal.OrganisationID)), apiKey.UserID, principal.OrganisationID)
+		if err != nil {
+			return nil, err
+		}
+		if teamMember != nil {
+			principal.TeamMemberID = teamMember.ID
+		}
+	}
+
+	return principal, nil
+}
+
+// APIKeyScopes is a gqlgen operation middleware that limits requests made
+// with an API key to its scopes: queries need READ and mutations need WRITE
+func (r *Resolver) APIKeyScopes(ctx context.Context, next graphql.OperationHandler) graphql.ResponseHandler {
+	scope := models.APIKeyScopeRead
+	if graphql.GetOperationContext(ctx).Operation.Operation == ast.Mutation {
+		scope = models.APIKeyScopeWrite
+	}
+
+	if !hasAPIKeyScope(ctx, scope) {
+		return graphql.OneShot(graphql.ErrorResponse(ctx, "access denied: this API key does not have the %s scope", strings.ToUpper(string(scope))))
+	}
+	return next(ctx)
+}
+
+// usingAPIKey reports whether the request was authenticated with an API key
+// rather than a session
+func usingAPIKey(ctx context.Context) bool {
+	principal, ok := auth.FromContext(ctx)
+	return ok && principal.UsingAPIKey()
+}
+
+// hasAPIKeyScope reports whether the request may act within scope. Requests
+// authenticated with a session are not limited by scopes.
+func hasAPIKeyScope(ctx context.Context, scope models.APIKeyScope) bool {
+	principal, ok := auth.FromContext(ctx)
+	return !ok || principal.HasScope(scope)
+}
+
+// generateAPIKey returns a new random API key
+func generateAPIKey() (string, error) {
+	secret, err := generateSecureToken(32)
+	if err != nil {
+		return "", err
+	}
+	return apiKeyPrefix + secret, nil
+}
+
+// checkAPIKeyManagement stops API keys from being used to mint or revoke
+// other keys, which would let a narrowly scoped key widen its own access
+func checkAPIKeyManagement(ctx context.Context) error {
+	if usingAPIKey(ctx) {
+		return fmt.Errorf("API keys can only be managed when signed in")
+	}
+	return nil
+}
@@ -0,0 +1,221 @@
+package resolvers_test
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/99designs/gqlgen/client"
+
+	"crmgo/internal/auth"
+	"crmgo/internal/models"
+	"crmgo/internal/tenant"
+)
+
+// createAPIKey creates a key for the caller of options and returns it along
+// with its ID
+func createAPIKey(t *testing.T, c *client.Client, scopes []string, options ...client.Option) (string, string) {
+	t.Helper()
+
+	data, errs := post(t, c, `mutation($scopes: [ApiKeyScope!]!) { createApiKey(input: {name: "Import script", scopes: $scopes}) { key apiKey { id } } }`,
+		append(options, client.Var("scopes", scopes))...)
+	if len(errs) > 0 {
+		t.Fatalf("create %v API key: %v", scopes, errs)
+	}
+	created := data["createApiKey"].(map[string]interface{})
+	return created["key"].(string), created["apiKey"].(map[string]interface{})["id"].(string)
+}
+
+// withAPIKey sends key as the request's credentials
+func withAPIKey(key string) client.Option {
+	return client.AddHeader("Authorization", "ApiKey "+key)
+}
+
+func TestAPIKeysAreOnlyShownOnce(t *testing.T) {
+	c, resolver := newServer(t, 1)
+	seedDeals(t, resolver, 1)
+	authenticator := withSessions(resolver)
+	db := resolver.DB.WithContext(tenant.WithoutScope(context.Background()))
+
+	key, id := createAPIKey(t, c, []string{"READ"})
+	if !strings.HasPrefix(key, "crm_") {
+		t.Errorf("key %q, want the crm_ prefix", key)
+	}
+
+	var apiKey models.APIKey
+	if err := db.First(&apiKey, id).Error; err != nil {
+		t.Fatalf("load API key: %v", err)
+	}
+	sum := sha256.Sum256([]byte(key))
+	if apiKey.KeyHash != hex.EncodeToString(sum[:]) || strings.Contains(apiKey.KeyHash, key) {
+		t.Errorf("key stored as %q, want its SHA-256 digest", apiKey.KeyHash)
+	}
+	if !strings.HasPrefix(key, apiKey.Prefix) || len(apiKey.Prefix) >= len(key)/2 {
+		t.Errorf("prefix %q kept of key %q, want only its start", apiKey.Prefix, key)
+	}
+
+	data, errs := post(t, c, `query { apiKeys { id prefix scopes } }`)
+	if len(errs) > 0 {
+		t.Fatalf("list API keys: %v", errs)
+	}
+	keys := data["apiKeys"].([]interface{})
+	if len(keys) != 1 || keys[0].(map[string]interface{})["prefix"] != apiKey.Prefix {
+		t.Errorf("listed API keys %v, want only the prefix of %s", keys, id)
+	}
+
+	principal, err := resolver.AuthenticateAPIKey(context.Background(), key)
+	if err != nil {
+		t.Fatalf("authenticate with the key: %v", err)
+	}
+	if principal.UserID != 1 || principal.OrganisationID != 1 || principal.Method != auth.MethodAPIKey || principal.Role != models.RoleAdmin {
+		t.Errorf("key acts as %+v, want user 1 as an admin of organisation 1", *principal)
+	}
+	if err := authenticate(authenticator, "ApiKey "+key[:len(key)-1]); !errors.Is(err, auth.ErrInvalidAPIKey) {
+		t.Errorf("mistyped key: %v, want it refused", err)
+	}
+}
+
+func TestAPIKeysAreLimitedToTheirScopes(t *testing.T) {
+	admin, resolver := newServer(t, 1)
+	seedDeals(t, resolver, 1)
+	c := tokenClient(resolver, withSessions(resolver))
+
+	readOnly, _ := createAPIKey(t, admin, []string{"READ"})
+	writeOnly, _ := createAPIKey(t, admin, []string{"WRITE"})
+	readWrite, _ := createAPIKey(t, admin, []string{"READ", "WRITE"})
+	missing := func(errs []graphqlError, scope string) bool {
+		return len(errs) > 0 && strings.Contains(errs[0].Message, "does not have the "+scope+" scope")
+	}
+
+	if _, errs := post(t, c, `query { deals { id } }`, withAPIKey(readOnly)); len(errs) > 0 {
+		t.Errorf("query with a READ key: %v", errs)
+	}
+	if _, errs := post(t, c, `mutation { createContact(input: {name: "Pat"}) { id } }`, withAPIKey(readOnly)); !missing(errs, "WRITE") {
+		t.Errorf("mutation with a READ key: %v, want it refused", errs)
+	}
+	if _, errs := post(t, c, `query { deals { id } }`, withAPIKey(writeOnly)); !missing(errs, "READ") {
+		t.Errorf("query with a WRITE key: %v, want it refused", errs)
+	}
+	if _, errs := post(t, c, `mutation { createContact(input: {name: "Pat"}) { id } }`, withAPIKey(readWrite)); len(errs) > 0 {
+		t.Errorf("mutation with a READ and WRITE key: %v", errs)
+	}
+
+	// Keys cannot mint wider keys or revoke others, whatever their scopes
+	managed := func(errs []graphqlError) bool {
+		return len(errs) > 0 && strings.Contains(errs[0].Message, "API keys can only be managed when signed in")
+	}
+	if _, errs := post(t, c, `mutation { createApiKey(input: {name: "Wider", scopes: [READ, WRITE, ADMIN]}) { key } }`, withAPIKey(readWrite)); !managed(errs) {
+		t.Errorf("creating a key with a key: %v, want it refused", errs)
+	}
+	if _, errs := post(t, c, `mutation { revokeApiKey(id: "1") }`, withAPIKey(readWrite)); !managed(errs) {
+		t.Errorf("revoking a key with a key: %v, want it refused", errs)
+	}
+}
+
+func TestAPIKeysStopWorking(t *testing.T) {
+	admin, resolver := newServer(t, 1)
+	seedDeals(t, resolver, 0)
+	authenticator := withSessions(resolver)
+	c := tokenClient(resolver, authenticator)
+	db := resolver.DB.WithContext(tenant.WithoutScope(context.Background()))
+	refused := func(key string) bool {
+		return errors.Is(authenticate(authenticator, "ApiKey "+key), auth.ErrInvalidAPIKey)
+	}
+
+	expiring, expiringID := createAPIKey(t, admin, []string{"READ"})
+	if err := db.Model(&models.APIKey{}).Where("id = ?", expiringID).Update("expires_at", time.Now().Add(-time.Minute)).Error; err != nil {
+		t.Fatalf("expire key: %v", err)
+	}
+	if !refused(expiring) {
+		t.Error("expired key accepted")
+	}
+
+	revoked, revokedID := createAPIKey(t, admin, []string{"READ"})
+	if refused(revoked) {
+		t.Fatal("new key refused")
+	}
+	if _, errs := post(t, admin, `mutation($id: ID!) { revokeApiKey(id: $id) }`, client.Var("id", revokedID)); len(errs) > 0 {
+		t.Fatalf("revoke key: %v", errs)
+	}
+	if !refused(revoked) {
+		t.Error("revoked key accepted")
+	}
+
+	// Another user's keys are not theirs to revoke
+	sam := seedMember(t, resolver, "sam@example.com", "correct-horse")
+	token, _ := signIn(t, c, sam.Email, "correct-horse")
+	samsKey, samsKeyID := createAPIKey(t, c, []string{"READ"}, bearer(token))
+	if data, errs := post(t, admin, `mutation($id: ID!) { revokeApiKey(id: $id) }`, client.Var("id", samsKeyID)); len(errs) == 0 && data["revokeApiKey"] == true {
+		t.Error("revoked another user's key")
+	}
+	if refused(samsKey) {
+		t.Error("key refused after someone else tried to revoke it")
+	}
+
+	if err := db.Model(&models.Membership{}).Where("user_id = ?", sam.ID).Update("deactivated_at", time.Now()).Error; err != nil {
+		t.Fatalf("deactivate membership: %v", err)
+	}
+	if !refused(samsKey) {
+		t.Error("key of a deactivated member accepted")
+	}
+
+	for _, key := range []string{"crm_unknown", strings.TrimPrefix(samsKey, "crm_"), ""} {
+		if !refused(key) {
+			t.Errorf("key %q accepted", key)
+		}
+	}
+}
+
+func TestAPIKeyUseIsRecordedSparingly(t *testing.T) {
+	c, resolver := newServer(t, 1)
+	seedDeals(t, resolver, 0)
+	db := resolver.DB.WithContext(tenant.WithoutScope(context.Background()))
+
+	key, id := createAPIKey(t, c, []string{"READ"})
+	lastUsed := func() *time.Time {
+		t.Helper()
+		var apiKey models.APIKey
+		if err := db.First(&apiKey, id).Error; err != nil {
+			t.Fatalf("load API key: %v", err)
+		}
+		return apiKey.LastUsedAt
+	}
+	use := func() {
+		t.Helper()
+		if _, err := resolver.AuthenticateAPIKey(context.Background(), key); err != nil {
+			t.Fatalf("authenticate with the key: %v", err)
+		}
+	}
+	usedAt := func(at time.Time) {
+		t.Helper()
+		if err := db.Model(&models.APIKey{}).Where("id = ?", id).Update("last_used_at", at).Error; err != nil {
+			t.Fatalf("set last use: %v", err)
+		}
+	}
+
+	if lastUsed() != nil {
+		t.Fatal("new key already used")
+	}
+	use()
+	if lastUsed() == nil {
+		t.Fatal("first use not recorded")
+	}
+
+	recently := time.Now().Add(-30 * time.Second).Truncate(time.Second)
+	usedAt(recently)
+	use()
+	if got := lastUsed(); !got.Equal(recently) {
+		t.Errorf("use within a minute of the last moved it from %s to %s", recently, got)
+	}
+
+	earlier := time.Now().Add(-2 * time.Minute)
+	usedAt(earlier)
+	use()
+	if got := lastUsed(); !got.After(earlier.Add(time.Minute)) {
+		t.Errorf("use two minutes after the last recorded as %s", got)
+	}
+}
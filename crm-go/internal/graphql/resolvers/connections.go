@@ -0,0 +1,442 @@
+package resolvers
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	models1 "crmgo/internal/graphql/models"
+	"crmgo/internal/models"
+
+	"gorm.io/gorm"
+)
+
+// pageArgs are the Relay arguments of a connection field: first/after page
+// forwards, last/before page backwards
+type pageArgs struct {
+	First  *int
+	After  *string
+	Last   *int
+	Before *string
+}
+
+// sortKind is the type of a column a list can be sorted by, which decides
+// how its values are read back from a cursor
+type sortKind int
+
+const (
+	sortText sortKind = iota
+	sortNumber
+	sortTime
+)
+
+// sortField is a column a list can be sorted by. value reads the column from
+// a loaded row, returning nil when a nullable column has no value.
+type sortField[T any] struct {
+	column   string
+	kind     sortKind
+	nullable bool
+	value    func(T) interface{}
+}
+
+// sortKey is a sortField in one direction
+type sortKey[T any] struct {
+	sortField[T]
+	desc bool
+}
+
+// sortKeys completes the keys a list was asked to be sorted by: ties are
+// broken newest first and finally by ID, so every row has its own position.
+// Keys repeating an earlier column are dropped.
+func sortKeys[T any](keys []sortKey[T], createdAt, id sortField[T]) []sortKey[T] {
+	keys = append(keys, sortKey[T]{createdAt, true}, sortKey[T]{id, true})
+
+	seen := make(map[string]bool)
+	unique := keys[:0]
+	for _, key := range keys {
+		if !seen[key.column] {
+			seen[key.column] = true
+			unique = append(unique, key)
+		}
+	}
+	return unique
+}
+
+// orderString describes the order keys sort by. Cursors carry it so a
+// cursor is only used with the order it was made for.
+func orderString[T any](keys []sortKey[T]) string {
+	parts := make([]string, len(keys))
+	for i, key := range keys {
+		parts[i] = key.column
+		if key.desc {
+			parts[i] += " desc"
+		}
+	}
+	return strings.Join(parts, ",")
+}
+
+// pageCursor is the position of a row in a connection: the values of the
+// columns it is sorted by, so a position stays valid as rows are added
+type pageCursor struct {
+	Order  string        `json:"o"`
+	Values []interface{} `json:"v"`
+}
+
+// encodeCursor returns the opaque cursor of a row
+func encodeCursor[T any](keys []sortKey[T], node T) (string, error) {
+	cursor := pageCursor{Order: orderString(keys), Values: make([]interface{}, len(keys))}
+	for i, key := range keys {
+		cursor.Values[i] = key.value(node)
+	}
+
+	raw, err := json.Marshal(cursor)
+	if err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(raw), nil
+}
+
+// decodeCursor reads the position in a cursor made by encodeCursor for the
+// same keys
+func decodeCursor[T any](keys []sortKey[T], cursor string) ([]interface{}, error) {
+	invalid := fmt.Errorf("invalid cursor %q", cursor)
+
+	raw, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return nil, invalid
+	}
+	var position pageCursor
+	if err := json.Unmarshal(raw, &position); err != nil {
+		return nil, invalid
+	}
+	if position.Order != orderString(keys) || len(position.Values) != len(keys) {
+		return nil, fmt.Errorf("cursor %q belongs to a different order", cursor)
+	}
+
+	for i, key := range keys {
+		value := position.Values[i]
+		if value == nil {
+			if !key.nullable {
+				return nil, invalid
+			}
+			continue
+		}
+
+		ok := false
+		switch key.kind {
+		case sortText:
+			_, ok = value.(string)
+		case sortNumber:
+			_, ok = value.(float64)
+		case sortTime:
+			var text string
+			if text, ok = value.(string); ok {
+				var at time.Time
+				at, err = time.Parse(time.RFC3339Nano, text)
+				ok = err == nil
+				// Times are compared as they are stored, in local time
+				position.Values[i] = at.Local()
+			}
+		}
+		if !ok {
+			return nil, invalid
+		}
+	}
+
+	return position.Values, nil
+}
+
+// keyset returns the condition matching the rows that sort after position
+// in keys' order, or before it when backward is set. Rows missing a value
+// sort after every row that has one. The condition is never NULL, so it can
+// be negated.
+func keyset[T any](keys []sortKey[T], position []interface{}, backward bool) (string, []interface{}) {
+	var terms []string
+	var vars []interface{}
+
+	// level holds the conditions placing a row level with the position on
+	// the keys before the current one
+	var level []string
+	var levelVars []interface{}
+
+	for i, key := range keys {
+		value := position[i]
+
+		op := ">"
+		if key.desc != backward {
+			op = "<"
+		}
+
+		var beyond string
+		var beyondVars []interface{}
+		switch {
+		case !key.nullable:
+			beyond, beyondVars = fmt.Sprintf("%s %s ?", key.column, op), []interface{}{value}
+		case value == nil && backward:
+			beyond = key.column + " IS NOT NULL"
+		case value == nil:
+			// Nothing sorts after a missing value on this key
+		case backward:
+			beyond, beyondVars = fmt.Sprintf("(%s IS NOT NULL AND %s %s ?)", key.column, key.column, op), []interface{}{value}
+		default:
+			beyond, beyondVars = fmt.Sprintf("(%s IS NULL OR %s %s ?)", key.column, key.column, op), []interface{}{value}
+		}
+
+		if beyond != "" {
+			terms = append(terms, "("+strings.Join(append(append([]string{}, level...), beyond), " AND ")+")")
+			vars = append(append(vars, levelVars...), beyondVars...)
+		}
+
+		switch {
+		case !key.nullable:
+			level = append(level, key.column+" = ?")
+			levelVars = append(levelVars, value)
+		case value == nil:
+			level = append(level, key.column+" IS NULL")
+		default:
+			level = append(level, fmt.Sprintf("(%s IS NOT NULL AND %s = ?)", key.column, key.column))
+			levelVars = append(levelVars, value)
+		}
+	}
+
+	if len(terms) == 0 {
+		return "1 = 0", nil
+	}
+	return "(" + strings.Join(terms, " OR ") + ")", vars
+}
+
+// orderClause returns the ORDER BY clause for keys, reversed when backward
+func orderClause[T any](keys []sortKey[T], backward bool) string {
+	parts := make([]string, 0, 2*len(keys))
+	for _, key := range keys {
+		if key.nullable {
+			if backward {
+				parts = append(parts, key.column+" IS NULL DESC")
+			} else {
+				parts = append(parts, key.column+" IS NULL")
+			}
+		}
+		if key.desc != backward {
+			parts = append(parts, key.column+" DESC")
+		} else {
+			parts = append(parts, key.column+" ASC")
+		}
+	}
+	return strings.Join(parts, ", ")
+}
+
+// page is one page of a connection, with the cursor of each node
+type page[T any] struct {
+	nodes    []T
+	cursors  []string
+	pageInfo *models1.PageInfo
+	total    int
+}
+
+// paginate loads the page of query selected by args, sorted by keys, the
+// last of which must be the row ID. Pages hold at most maxPageSize rows,
+// however many are asked for; totalCount counts every row query matches.
+func paginate[T any](query *gorm.DB, args pageArgs, maxPageSize int, keys []sortKey[T]) (*page[T], error) {
+	if args.First != nil && args.Last != nil {
+		return nil, fmt.Errorf("first and last cannot be used together")
+	}
+
+	backward := args.Last != nil
+	name, size := "first", args.First
+	if backward {
+		name, size = "last", args.Last
+	}
+	limit := maxPageSize
+	if size != nil {
+		if *size < 0 {
+			return nil, fmt.Errorf("%s must not be negative", name)
+		}
+		limit = min(*size, maxPageSize)
+	}
+
+	// Each use below starts again from the filtered query
+	query = query.Session(&gorm.Session{})
+
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		return nil, err
+	}
+
+	var after, before []interface{}
+	rows := query
+	if args.After != nil {
+		position, err := decodeCursor(keys, *args.After)
+		if err != nil {
+			return nil, err
+		}
+		after = position
+		sql, vars := keyset(keys, position, false)
+		rows = rows.Where(sql, vars...)
+	}
+	if args.Before != nil {
+		position, err := decodeCursor(keys, *args.Before)
+		if err != nil {
+			return nil, err
+		}
+		before = position
+		sql, vars := keyset(keys, position, true)
+		rows = rows.Where(sql, vars...)
+	}
+
+	// Paging backwards reads the rows nearest the cursor first, in reverse.
+	// One extra row tells whether there is more beyond this page.
+	var nodes []T
+	if err := rows.Order(orderClause(keys, backward)).Limit(limit + 1).Find(&nodes).Error; err != nil {
+		return nil, err
+	}
+	more := len(nodes) > limit
+	if more {
+		nodes = nodes[:limit]
+	}
+	if backward {
+		for i, j := 0, len(nodes)-1; i < j; i, j = i+1, j-1 {
+			nodes[i], nodes[j] = nodes[j], nodes[i]
+		}
+	}
+
+	pageInfo := &models1.PageInfo{
+		HasNextPage:     !backward && more,
+		HasPreviousPage: backward && more,
+	}
+
+	// Whether there is anything on the other side of the cursor the page
+	// started from
+	id := keys[len(keys)-1].column
+	var err error
+	if !backward && after != nil {
+		sql, vars := keyset(keys, after, false)
+		pageInfo.HasPreviousPage, err = exists(query.Where("NOT "+sql, vars...), id)
+	} else if backward && before != nil {
+		sql, vars := keyset(keys, before, true)
+		pageInfo.HasNextPage, err = exists(query.Where("NOT "+sql, vars...), id)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	cursors := make([]string, len(nodes))
+	for i, node := range nodes {
+		if cursors[i], err = encodeCursor(keys, node); err != nil {
+			return nil, err
+		}
+	}
+	if len(cursors) > 0 {
+		pageInfo.StartCursor = &cursors[0]
+		pageInfo.EndCursor = &cursors[len(cursors)-1]
+	}
+
+	return &page[T]{nodes: nodes, cursors: cursors, pageInfo: pageInfo, total: int(total)}, nil
+}
+
+// exists reports whether query matches any row; column is its ID column
+func exists(query *gorm.DB, column string) (bool, error) {
+	var ids []uint
+	if err := query.Limit(1).Pluck(column, &ids).Error; err != nil {
+		return false, err
+	}
+	return len(ids) > 0, nil
+}
+
+// optional returns the value p points to, or nil, for sortField values
+func optional[V any](p *V) interface{} {
+	if p == nil {
+		return nil
+	}
+	return *p
+}
+
+// The columns each connection can be sorted by
+
+var contactSortFields = map[models1.ContactOrderField]sortField[*models.Contact]{
+	models1.ContactOrderFieldName:      {"contacts.name", sortText, false, func(c *models.Contact) interface{} { return c.Name }},
+	models1.ContactOrderFieldEmail:     {"contacts.email", sortText, true, func(c *models.Contact) interface{} { return optional(c.Email) }},
+	models1.ContactOrderFieldCreatedAt: {"contacts.created_at", sortTime, false, func(c *models.Contact) interface{} { return c.CreatedAt }},
+}
+
+var contactIDField = sortField[*models.Contact]{"contacts.id", sortNumber, false, func(c *models.Contact) interface{} { return c.ID }}
+
+// contactSortKeys returns the keys to sort contacts by for orderBy
+func contactSortKeys(orderBy []*models1.ContactOrder) []sortKey[*models.Contact] {
+	keys := make([]sortKey[*models.Contact], 0, len(orderBy))
+	for _, order := range orderBy {
+		keys = append(keys, sortKey[*models.Contact]{contactSortFields[order.Field], order.Direction == models1.OrderDirectionDesc})
+	}
+	return sortKeys(keys, contactSortFields[models1.ContactOrderFieldCreatedAt], contactIDField)
+}
+
+var propertySortFields = map[models1.PropertyOrderField]sortField[*models.Property]{
+	models1.PropertyOrderFieldName:      {"properties.name", sortText, false, func(p *models.Property) interface{} { return p.Name }},
+	models1.PropertyOrderFieldStatus:    {"properties.status", sortText, true, func(p *models.Property) interface{} { return optional(p.Status) }},
+	models1.PropertyOrderFieldCreatedAt: {"properties.created_at", sortTime, false, func(p *models.Property) interface{} { return p.CreatedAt }},
+}
+
+var propertyIDField = sortField[*models.Property]{"properties.id", sortNumber, false, func(p *models.Property) interface{} { return p.ID }}
+
+// propertySortKeys returns the keys to sort properties by for orderBy
+func propertySortKeys(orderBy []*models1.PropertyOrder) []sortKey[*models.Property] {
+	keys := make([]sortKey[*models.Property], 0, len(orderBy))
+	for _, order := range orderBy {
+		keys = append(keys, sortKey[*models.Property]{propertySortFields[order.Field], order.Direction == models1.OrderDirectionDesc})
+	}
+	return sortKeys(keys, propertySortFields[models1.PropertyOrderFieldCreatedAt], propertyIDField)
+}
+
+var dealSortFields = map[models1.DealOrderField]sortField[*models.Deal]{
+	models1.DealOrderFieldName:      {"deals.name", sortText, false, func(d *models.Deal) interface{} { return d.Name }},
+	models1.DealOrderFieldStatus:    {"deals.status", sortText, false, func(d *models.Deal) interface{} { return d.Status }},
+	models1.DealOrderFieldValue:     {"deals.value", sortNumber, true, func(d *models.Deal) interface{} { return optional(d.Value) }},
+	models1.DealOrderFieldCreatedAt: {"deals.created_at", sortTime, false, func(d *models.Deal) interface{} { return d.CreatedAt }},
+}
+
+var dealIDField = sortField[*models.Deal]{"deals.id", sortNumber, false, func(d *models.Deal) interface{} { return d.ID }}
+
+// dealSortKeys returns the keys to sort deals by for orderBy
+func dealSortKeys(orderBy []*models1.DealOrder) []sortKey[*models.Deal] {
+	keys := make([]sortKey[*models.Deal], 0, len(orderBy))
+	for _, order := range orderBy {
+		keys = append(keys, sortKey[*models.Deal]{dealSortFields[order.Field], order.Direction == models1.OrderDirectionDesc})
+	}
+	return sortKeys(keys, dealSortFields[models1.DealOrderFieldCreatedAt], dealIDField)
+}
+
+var taskSortFields = map[models1.TaskOrderField]sortField[*models.Task]{
+	models1.TaskOrderFieldTitle:     {"tasks.title", sortText, false, func(t *models.Task) interface{} { return t.Title }},
+	models1.TaskOrderFieldStatus:    {"tasks.status", sortText, false, func(t *models.Task) interface{} { return t.Status }},
+	models1.TaskOrderFieldDueDate:   {"tasks.due_date", sortTime, true, func(t *models.Task) interface{} { return optional(t.DueDate) }},
+	models1.TaskOrderFieldCreatedAt: {"tasks.created_at", sortTime, false, func(t *models.Task) interface{} { return t.CreatedAt }},
+}
+
+var taskIDField = sortField[*models.Task]{"tasks.id", sortNumber, false, func(t *models.Task) interface{} { return t.ID }}
+
+// taskSortKeys returns the keys to sort tasks by for orderBy
+func taskSortKeys(orderBy []*models1.TaskOrder) []sortKey[*models.Task] {
+	keys := make([]sortKey[*models.Task], 0, len(orderBy))
+	for _, order := range orderBy {
+		keys = append(keys, sortKey[*models.Task]{taskSortFields[order.Field], order.Direction == models1.OrderDirectionDesc})
+	}
+	return sortKeys(keys, taskSortFields[models1.TaskOrderFieldCreatedAt], taskIDField)
+}
+
+var documentSortFields = map[models1.DocumentOrderField]sortField[*models.Document]{
+	models1.DocumentOrderFieldTitle:     {"documents.title", sortText, false, func(d *models.Document) interface{} { return d.Title }},
+	models1.DocumentOrderFieldFileSize:  {"documents.file_size", sortNumber, true, func(d *models.Document) interface{} { return optional(d.FileSize) }},
+	models1.DocumentOrderFieldCreatedAt: {"documents.created_at", sortTime, false, func(d *models.Document) interface{} { return d.CreatedAt }},
+}
+
+var documentIDField = sortField[*models.Document]{"documents.id", sortNumber, false, func(d *models.Document) interface{} { return d.ID }}
+
+// documentSortKeys returns the keys to sort documents by for orderBy
+func documentSortKeys(orderBy []*models1.DocumentOrder) []sortKey[*models.Document] {
+	keys := make([]sortKey[*models.Document], 0, len(orderBy))
+	for _, order := range orderBy {
+		keys = append(keys, sortKey[*models.Document]{documentSortFields[order.Field], order.Direction == models1.OrderDirectionDesc})
+	}
+	return sortKeys(keys, documentSortFields[models1.DocumentOrderFieldCreatedAt], documentIDField)
+}
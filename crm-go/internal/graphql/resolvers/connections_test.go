@@ -0,0 +1,248 @@
+package resolvers_test
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/99designs/gqlgen/client"
+
+	"crmgo/internal/graphql/resolvers"
+	"crmgo/internal/models"
+	"crmgo/internal/tenant"
+)
+
+// seedValuedDeals adds deals worth values, nil for a deal without a value,
+// all created at the same moment so ties fall back to the ID
+func seedValuedDeals(t *testing.T, resolver *resolvers.Resolver, values ...*float64) []models.Deal {
+	t.Helper()
+
+	db := resolver.DB.WithContext(tenant.WithoutScope(context.Background()))
+	createdAt := time.Date(2026, 3, 1, 9, 0, 0, 0, time.Local)
+	deals := make([]models.Deal, len(values))
+	for i, value := range values {
+		deals[i] = models.Deal{Name: fmt.Sprintf("Valued %d", i), OrganisationID: 1, Value: value, CreatedAt: createdAt}
+		if err := db.Create(&deals[i]).Error; err != nil {
+			t.Fatalf("seed deal: %v", err)
+		}
+	}
+	return deals
+}
+
+func worth(v float64) *float64 {
+	return &v
+}
+
+// dealPage is a page of dealsConnection
+type dealPage struct {
+	ids             []string
+	startCursor     string
+	endCursor       string
+	hasNextPage     bool
+	hasPreviousPage bool
+}
+
+// fetchDeals loads a page of dealsConnection sorted by orderBy
+func fetchDeals(t *testing.T, c *client.Client, orderBy string, args map[string]interface{}) (*dealPage, []graphqlError) {
+	t.Helper()
+
+	options := []client.Option{}
+	for _, name := range []string{"first", "after", "last", "before"} {
+		options = append(options, client.Var(name, args[name]))
+	}
+	query := `query($first: Int, $after: String, $last: Int, $before: String) {
+		dealsConnection(orderBy: ` + orderBy + `, first: $first, after: $after, last: $last, before: $before) {
+			edges { cursor node { id } }
+			pageInfo { hasNextPage hasPreviousPage startCursor endCursor }
+		}
+	}`
+	data, errs := post(t, c, query, options...)
+	if len(errs) > 0 {
+		return nil, errs
+	}
+
+	connection := data["dealsConnection"].(map[string]interface{})
+	pageInfo := connection["pageInfo"].(map[string]interface{})
+	page := &dealPage{
+		hasNextPage:     pageInfo["hasNextPage"].(bool),
+		hasPreviousPage: pageInfo["hasPreviousPage"].(bool),
+	}
+	page.startCursor, _ = pageInfo["startCursor"].(string)
+	page.endCursor, _ = pageInfo["endCursor"].(string)
+	for _, edge := range connection["edges"].([]interface{}) {
+		page.ids = append(page.ids, edge.(map[string]interface{})["node"].(map[string]interface{})["id"].(string))
+	}
+	return page, nil
+}
+
+// walkDeals pages through every deal, forwards with first/after or
+// backwards with last/before, and returns their IDs in order
+func walkDeals(t *testing.T, c *client.Client, orderBy string, size int, backward bool) []string {
+	t.Helper()
+
+	var ids []string
+	var cursor interface{}
+	for pages := 0; ; pages++ {
+		if pages > 50 {
+			t.Fatalf("paging %s by %d never ended: %v", orderBy, size, ids)
+		}
+
+		args := map[string]interface{}{"first": size, "after": cursor}
+		if backward {
+			args = map[string]interface{}{"last": size, "before": cursor}
+		}
+		page, errs := fetchDeals(t, c, orderBy, args)
+		if len(errs) > 0 {
+			t.Fatalf("page %d of %s: %v", pages+1, orderBy, errs)
+		}
+		if len(page.ids) > size {
+			t.Fatalf("page of %d deals, asked for %d", len(page.ids), size)
+		}
+
+		// Only the first page has nothing on the side it started from
+		if backward {
+			if page.hasNextPage != (cursor != nil) {
+				t.Errorf("page %d of %s backwards: hasNextPage %v", pages+1, orderBy, page.hasNextPage)
+			}
+			ids = append(append([]string{}, page.ids...), ids...)
+			if !page.hasPreviousPage {
+				return ids
+			}
+			cursor = page.startCursor
+		} else {
+			if page.hasPreviousPage != (cursor != nil) {
+				t.Errorf("page %d of %s: hasPreviousPage %v", pages+1, orderBy, page.hasPreviousPage)
+			}
+			ids = append(ids, page.ids...)
+			if !page.hasNextPage {
+				return ids
+			}
+			cursor = page.endCursor
+		}
+	}
+}
+
+// dealIDsByValue returns the IDs of deals sorted by value, deals without one
+// last, and newest first among equals
+func dealIDsByValue(deals []models.Deal, desc bool) []string {
+	sorted := append([]models.Deal{}, deals...)
+	sort.Slice(sorted, func(i, j int) bool {
+		a, b := sorted[i].Value, sorted[j].Value
+		switch {
+		case a == nil || b == nil:
+			if (a == nil) != (b == nil) {
+				return b == nil
+			}
+		case *a != *b:
+			return (*a < *b) != desc
+		}
+		return sorted[i].ID > sorted[j].ID
+	})
+
+	ids := make([]string, len(sorted))
+	for i, deal := range sorted {
+		ids[i] = fmt.Sprint(deal.ID)
+	}
+	return ids
+}
+
+func TestDealPagesCoverEveryDealOnce(t *testing.T) {
+	c, resolver := newServer(t, 1)
+	seedDeals(t, resolver, 0)
+	deals := seedValuedDeals(t, resolver, worth(300), nil, worth(100), worth(200), nil, worth(100), worth(500), nil, worth(200))
+
+	tests := []struct {
+		orderBy string
+		desc    bool
+	}{
+		{`[{field: VALUE, direction: ASC}]`, false},
+		{`[{field: VALUE, direction: DESC}]`, true},
+	}
+	for _, tt := range tests {
+		want := dealIDsByValue(deals, tt.desc)
+		for _, size := range []int{1, 2, 4, len(deals), len(deals) + 1} {
+			for _, backward := range []bool{false, true} {
+				t.Run(fmt.Sprintf("%s size %d backward %v", tt.orderBy, size, backward), func(t *testing.T) {
+					got := walkDeals(t, c, tt.orderBy, size, backward)
+					if strings.Join(got, ",") != strings.Join(want, ",") {
+						t.Errorf("deals in order %v, want %v", got, want)
+					}
+				})
+			}
+		}
+	}
+}
+
+func TestDealCursorsSurviveInserts(t *testing.T) {
+	c, resolver := newServer(t, 1)
+	seedDeals(t, resolver, 0)
+	deals := seedValuedDeals(t, resolver, worth(100), worth(200), nil, worth(300), worth(400))
+	orderBy := `[{field: VALUE, direction: ASC}]`
+
+	first, errs := fetchDeals(t, c, orderBy, map[string]interface{}{"first": 2})
+	if len(errs) > 0 {
+		t.Fatalf("first page: %v", errs)
+	}
+
+	// A deal sorting before the cursor, one in the middle of what is left,
+	// and one without a value, which sorts last
+	added := seedValuedDeals(t, resolver, worth(50), worth(250), nil)
+
+	var rest []string
+	cursor := first.endCursor
+	for {
+		page, errs := fetchDeals(t, c, orderBy, map[string]interface{}{"first": 2, "after": cursor})
+		if len(errs) > 0 {
+			t.Fatalf("next page: %v", errs)
+		}
+		if !page.hasPreviousPage {
+			t.Error("a page after the first reports nothing before it")
+		}
+		rest = append(rest, page.ids...)
+		if !page.hasNextPage {
+			break
+		}
+		cursor = page.endCursor
+	}
+
+	id := func(deal models.Deal) string { return fmt.Sprint(deal.ID) }
+	want := []string{id(added[1]), id(deals[3]), id(deals[4]), id(added[2]), id(deals[2])}
+	if strings.Join(rest, ",") != strings.Join(want, ",") {
+		t.Errorf("pages after the inserts hold %v, want %v", rest, want)
+	}
+
+	// Paging back from the end now reaches the deal added at the front
+	back, errs := fetchDeals(t, c, orderBy, map[string]interface{}{"last": 10, "before": first.endCursor})
+	if len(errs) > 0 {
+		t.Fatalf("previous page: %v", errs)
+	}
+	if want := []string{id(added[0]), id(deals[0])}; strings.Join(back.ids, ",") != strings.Join(want, ",") || back.hasPreviousPage || !back.hasNextPage {
+		t.Errorf("page before the first page's end holds %v (previous %v, next %v), want %v with only a next page",
+			back.ids, back.hasPreviousPage, back.hasNextPage, want)
+	}
+}
+
+func TestDealCursorsOnlyWorkWithTheirOrder(t *testing.T) {
+	c, resolver := newServer(t, 1)
+	seedDeals(t, resolver, 3)
+
+	page, errs := fetchDeals(t, c, `[{field: VALUE, direction: ASC}]`, map[string]interface{}{"first": 1})
+	if len(errs) > 0 {
+		t.Fatalf("first page: %v", errs)
+	}
+
+	for _, orderBy := range []string{`[{field: VALUE, direction: DESC}]`, `[{field: NAME, direction: ASC}]`, `[]`} {
+		for _, args := range []map[string]interface{}{{"first": 1, "after": page.endCursor}, {"last": 1, "before": page.endCursor}} {
+			if _, errs := fetchDeals(t, c, orderBy, args); len(errs) == 0 || !strings.Contains(errs[0].Message, "belongs to a different order") {
+				t.Errorf("cursor for VALUE ASC used with %s %v: %v, want a refusal", orderBy, args, errs)
+			}
+		}
+	}
+
+	if _, errs := fetchDeals(t, c, `[{field: VALUE, direction: ASC}]`, map[string]interface{}{"first": 1, "after": "not-a-cursor"}); len(errs) == 0 || !strings.Contains(errs[0].Message, "invalid cursor") {
+		t.Errorf("made-up cursor: %v, want a refusal", errs)
+	}
+}
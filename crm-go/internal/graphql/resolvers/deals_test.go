@@ -0,0 +1,73 @@
+package resolvers_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/99designs/gqlgen/client"
+
+	"crmgo/internal/models"
+)
+
+func TestDealStatusesFollowThePipeline(t *testing.T) {
+	c, resolver := newServer(t, 1)
+	seedDeals(t, resolver, 1)
+
+	create := func(status interface{}) (string, []graphqlError) {
+		t.Helper()
+		data, errs := post(t, c, `mutation($status: String) { createDeal(input: {name: "Flat 2", propertyId: "1", status: $status}) { status } }`,
+			client.Var("status", status))
+		if len(errs) > 0 {
+			return "", errs
+		}
+		return data["createDeal"].(map[string]interface{})["status"].(string), nil
+	}
+	update := func(status string) (string, []graphqlError) {
+		t.Helper()
+		data, errs := post(t, c, `mutation($status: String) { updateDeal(id: "1", input: {name: "Deal 0", status: $status}) { status } }`,
+			client.Var("status", status))
+		if len(errs) > 0 {
+			return "", errs
+		}
+		return data["updateDeal"].(map[string]interface{})["status"].(string), nil
+	}
+	refused := func(errs []graphqlError) bool {
+		return len(errs) > 0 && strings.Contains(errs[0].Message, "not a stage of the organisation's deal pipeline")
+	}
+
+	// The default pipeline, matched regardless of case
+	if status, errs := create(nil); status != models.DefaultDealStatus {
+		t.Errorf("new deal without a status: %q %v, want %s", status, errs, models.DefaultDealStatus)
+	}
+	if status, errs := create("negotiation"); status != "Negotiation" {
+		t.Errorf("new deal in negotiation: %q %v, want Negotiation", status, errs)
+	}
+	if _, errs := create("Archived"); !refused(errs) {
+		t.Errorf("new deal in an unknown stage: %v, want a refusal", errs)
+	}
+	if _, errs := update("Sold"); !refused(errs) {
+		t.Errorf("moving a deal to an unknown stage: %v, want a refusal", errs)
+	}
+
+	// A pipeline of the organisation's own
+	if _, errs := post(t, c, `mutation { updateOrganisationSettings(input: {dealStages: [{name: "Lead"}, {name: "Offer"}, {name: "Completed", closed: true}]}) { dealStages { name } } }`); len(errs) > 0 {
+		t.Fatalf("set deal stages: %v", errs)
+	}
+	if status, errs := create(nil); status != "Lead" {
+		t.Errorf("new deal without a status: %q %v, want the first open stage", status, errs)
+	}
+	if _, errs := create("Negotiation"); !refused(errs) {
+		t.Errorf("new deal in a stage the pipeline dropped: %v, want a refusal", errs)
+	}
+
+	// Deal 1 is still New, which the pipeline no longer has
+	if status, errs := update(models.DefaultDealStatus); status != models.DefaultDealStatus {
+		t.Errorf("editing a deal left in a dropped stage: %q %v", status, errs)
+	}
+	if status, errs := update("completed"); status != "Completed" {
+		t.Errorf("moving a deal to completed: %q %v, want Completed", status, errs)
+	}
+	if _, errs := update(models.DefaultDealStatus); !refused(errs) {
+		t.Errorf("moving a deal back to a dropped stage: %v, want a refusal", errs)
+	}
+}
@@ -0,0 +1,224 @@
+package resolvers
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"mime"
+	"net/http"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"crmgo/internal/models"
+	"crmgo/internal/storage"
+)
+
+// sniffLength is how many leading bytes are used to detect a file's MIME type
+const sniffLength = 512
+
+// unsafeFileNameChars matches characters not allowed in stored file names
+var unsafeFileNameChars = regexp.MustCompile(`[^A-Za-z0-9._-]+`)
+
+// storedFile describes a file written to blob storage
+type storedFile struct {
+	Key      string
+	Size     int64
+	MimeType string
+	Checksum string
+}
+
+// countingWriter counts the bytes written through it
+type countingWriter struct {
+	n int64
+}
+
+func (w *countingWriter) Write(p []byte) (int, error) {
+	w.n += int64(len(p))
+	return len(p), nil
+}
+
+// storeUpload streams an uploaded file into blob storage, sniffing its MIME
+// type from the content and computing its size and SHA-256 checksum on the way
+func (r *Resolver) storeUpload(ctx context.Context, orgID uint, fileName string, file io.Reader) (*storedFile, error) {
+	if r.Storage == nil {
+		return nil, fmt.Errorf("file storage is not configured")
+	}
+
+	head := make([]byte, sniffLength)
+	n, err := io.ReadFull(file, head)
+	if err != nil && !errors.Is(err, io.EOF) && !errors.Is(err, io.ErrUnexpectedEOF) {
+		return nil, fmt.Errorf("failed to read upload: %v", err)
+	}
+	head = head[:n]
+
+	if n == 0 {
+		return nil, fmt.Errorf("uploaded file is empty")
+	}
+
+	token, err := generateSecureToken(16)
+	if err != nil {
+		return nil, err
+	}
+	key := fmt.Sprintf("documents/%d/%s/%s", orgID, token, sanitizeFileName(fileName))
+
+	// Read one byte past the limit so oversized uploads can be detected
+	maxSize := r.Config.MaxUploadSize
+	mimeType := http.DetectContentType(head)
+	hasher := sha256.New()
+	counter := &countingWriter{}
+	body := io.LimitReader(io.MultiReader(bytes.NewReader(head), file), maxSize+1)
+
+	if err := r.Storage.Put(ctx, key, io.TeeReader(body, io.MultiWriter(hasher, counter)), mimeType); err != nil {
+		return nil, fmt.Errorf("failed to store file: %v", err)
+	}
+
+	if counter.n > maxSize {
+		r.deleteStoredFile(ctx, key)
+		return nil, fmt.Errorf("file exceeds the maximum upload size of %d MB", maxSize>>20)
+	}
+
+	return &storedFile{
+		Key:      key,
+		Size:     counter.n,
+		MimeType: mimeType,
+		Checksum: hex.EncodeToString(hasher.Sum(nil)),
+	}, nil
+}
+
+// deleteStoredFile removes a file from storage, logging rather than failing
+func (r *Resolver) deleteStoredFile(ctx context.Context, key string) {
+	if err := r.Storage.Delete(ctx, key); err != nil {
+		log.Printf("Failed to delete stored file %s: %v", key, err)
+	}
+}
+
+// sanitizeFileName reduces an uploaded file name to a safe storage path segment
+func sanitizeFileName(name string) string {
+	name = filepath.Base(strings.ReplaceAll(name, `\`, "/"))
+	name = unsafeFileNameChars.ReplaceAllString(name, "_")
+	name = strings.Trim(name, "._")
+	if len(name) > 100 {
+		name = name[len(name)-100:]
+	}
+	if name == "" {
+		return "file"
+	}
+	return name
+}
+
+// documentDownloadPath returns the API path that serves an uploaded document
+func documentDownloadPath(id uint) string {
+	return fmt.Sprintf("/documents/%d/download", id)
+}
+
+// DocumentDownloadHandler serves uploaded document files to members of the
+// organisation that owns them. It must be wrapped in auth.Authenticator's
+// Require, which puts the caller's Principal in the request context.
+func (r *Resolver) DocumentDownloadHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if req.Method != http.MethodGet && req.Method != http.MethodHead {
+			http.Error(w, `{"error":"Method not allowed"}`, http.StatusMethodNotAllowed)
+			return
+		}
+
+		orgID, err := r.currentOrganisationID(req.Context())
+		if err != nil {
+			http.Error(w, `{"error":"Authentication required"}`, http.StatusUnauthorized)
+			return
+		}
+		// Files of an organisation scheduled for deletion are as out of reach
+		// as the rest of its records
+		if r.organisationPendingDeletion(req.Context()) {
+			http.Error(w, `{"error":"This organisation has been deleted, only its owner can restore it"}`, http.StatusForbidden)
+			return
+		}
+		// Members who still have to set up two-factor authentication are held
+		// back here as they are by TwoFactorGate
+		if userID, err := currentUserID(req.Context()); err == nil && r.twoFactorSetupRequired(req.Context(), userID, orgID) {
+			http.Error(w, `{"error":"Your organisation requires two-factor authentication, please set it up to continue"}`, http.StatusForbidden)
+			return
+		}
+		if !hasAPIKeyScope(req.Context(), models.APIKeyScopeRead) {
+			http.Error(w, `{"error":"API key does not have the READ scope"}`, http.StatusForbidden)
+			return
+		}
+		ctx := r.withTenant(req.Context())
+
+		// Documents from other organisations are reported as missing
+		document, err := r.findDocument(ctx, req.PathValue("id"))
+		if err != nil || document.StorageKey == nil {
+			http.Error(w, `{"error":"Document not found"}`, http.StatusNotFound)
+			return
+		}
+
+		// Backends that can hand out direct links serve the file themselves
+		signedURL, err := r.Storage.SignedURL(ctx, *document.StorageKey, r.Config.SignedURLExpiry)
+		if err == nil {
+			w.Header().Set("Cache-Control", "private, no-store")
+			http.Redirect(w, req, signedURL, http.StatusFound)
+			return
+		}
+		if !errors.Is(err, storage.ErrSignedURLNotSupported) {
+			log.Printf("Failed to sign URL for document %d: %v", document.ID, err)
+		}
+
+		file, err := r.Storage.Get(ctx, *document.StorageKey)
+		if errors.Is(err, storage.ErrNotFound) {
+			http.Error(w, `{"error":"Document not found"}`, http.StatusNotFound)
+			return
+		}
+		if err != nil {
+			log.Printf("Failed to open document %d: %v", document.ID, err)
+			http.Error(w, `{"error":"Failed to read document"}`, http.StatusInternalServerError)
+			return
+		}
+		defer file.Close()
+
+		contentType := "application/octet-stream"
+		if document.FileType != nil && *document.FileType != "" {
+			contentType = *document.FileType
+		}
+		fileName := document.Title
+		if document.FileName != nil && *document.FileName != "" {
+			fileName = *document.FileName
+		}
+
+		w.Header().Set("Content-Type", contentType)
+		w.Header().Set("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": fileName}))
+		w.Header().Set("X-Content-Type-Options", "nosniff")
+		w.Header().Set("Cache-Control", "private, no-store")
+		if document.FileSize != nil {
+			w.Header().Set("Content-Length", strconv.FormatInt(*document.FileSize, 10))
+		}
+		if document.Checksum != nil {
+			w.Header().Set("ETag", `"`+*document.Checksum+`"`)
+		}
+
+		if req.Method == http.MethodHead {
+			return
+		}
+
+		if _, err := io.Copy(w, file); err != nil {
+			log.Printf("Failed to stream document %d: %v", document.ID, err)
+		}
+	})
+}
+
+// uploadedDocument builds the document record for a stored file
+func uploadedDocument(title, fileName string, stored *storedFile) models.Document {
+	return models.Document{
+		Title:      title,
+		FileType:   &stored.MimeType,
+		FileName:   &fileName,
+		FileSize:   &stored.Size,
+		Checksum:   &stored.Checksum,
+		StorageKey: &stored.Key,
+	}
+}
@@ -0,0 +1,304 @@
+package resolvers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	models1 "crmgo/internal/graphql/models"
+	"crmgo/internal/models"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// maxFilterDepth bounds how deeply filters may nest through and, or, not and
+// the filters of related items, so one request cannot build an arbitrarily
+// large query
+const maxFilterDepth = 8
+
+// errFilterTooDeep is returned for filters nested beyond maxFilterDepth
+var errFilterTooDeep = errors.New("filter is nested too deeply")
+
+// conditions collects the conditions a list filter sets, all of which a row
+// must meet. Column names only ever come from the code; values from the
+// filter are always bound as parameters. Every condition is true or false,
+// never NULL, so not inverts it exactly: a row missing a value does not
+// match a condition on it.
+type conditions struct {
+	sql  []string
+	vars []interface{}
+}
+
+// add adds a condition on no particular column
+func (c *conditions) add(sql string, vars ...interface{}) {
+	c.sql = append(c.sql, "("+sql+")")
+	c.vars = append(c.vars, vars...)
+}
+
+// column adds a condition on column, which rows missing a value never meet.
+// format has a %s for each mention of the column.
+func (c *conditions) column(column, format string, vars ...interface{}) {
+	mentions := make([]interface{}, strings.Count(format, "%s"))
+	for i := range mentions {
+		mentions[i] = column
+	}
+	c.add(column+" IS NOT NULL AND "+fmt.Sprintf(format, mentions...), vars...)
+}
+
+// text adds the conditions of a TextFilter, ignoring case
+func (c *conditions) text(column string, filter *models1.TextFilter) {
+	if filter == nil {
+		return
+	}
+	if filter.Equals != nil {
+		c.column(column, "LOWER(%s) = ?", strings.ToLower(*filter.Equals))
+	}
+	if filter.Contains != nil {
+		c.column(column, `LOWER(%s) LIKE ? ESCAPE '\'`, likePattern(*filter.Contains))
+	}
+	if filter.StartsWith != nil {
+		c.column(column, `LOWER(%s) LIKE ? ESCAPE '\'`, prefixPattern(*filter.StartsWith))
+	}
+}
+
+// oneOf adds a condition matching any of values; an empty list is ignored
+func (c *conditions) oneOf(column string, values []string) {
+	if len(values) > 0 {
+		c.column(column, "%s IN ?", values)
+	}
+}
+
+// ids adds a condition matching any of the IDs of what kind of item
+func (c *conditions) ids(column string, ids []string, what string) error {
+	if len(ids) == 0 {
+		return nil
+	}
+
+	values := make([]uint, len(ids))
+	for i, id := range ids {
+		value, err := stringToID(id)
+		if err != nil {
+			return fmt.Errorf("invalid %s ID", what)
+		}
+		values[i] = value
+	}
+	c.column(column, "%s IN ?", values)
+	return nil
+}
+
+// floatRange adds the conditions of a FloatRange, including both ends
+func (c *conditions) floatRange(column string, r *models1.FloatRange) {
+	if r == nil {
+		return
+	}
+	if r.Min != nil {
+		c.column(column, "%s >= ?", *r.Min)
+	}
+	if r.Max != nil {
+		c.column(column, "%s <= ?", *r.Max)
+	}
+}
+
+// dateRange adds the conditions of a DateRange, including both ends. The
+// ends are compared as times are stored, whatever offset the client sent.
+func (c *conditions) dateRange(column string, r *models1.DateRange) {
+	if r == nil {
+		return
+	}
+	if r.From != nil {
+		c.column(column, "%s >= ?", storedTime(*r.From))
+	}
+	if r.To != nil {
+		c.column(column, "%s <= ?", storedTime(*r.To))
+	}
+}
+
+// related adds a condition matching rows whose foreign key column refers to
+// one of the items query selects
+func (c *conditions) related(column string, query *gorm.DB) {
+	c.column(column, "%s IN (?)", query)
+}
+
+// combine adds the filters of and, or and not to c and returns the condition
+// c has built. compile builds the condition of one nested filter.
+func combine[F any](c *conditions, and, or []*F, not *F, compile func(*F) (clause.Expr, error)) (clause.Expr, error) {
+	for _, filter := range and {
+		condition, err := compile(filter)
+		if err != nil {
+			return clause.Expr{}, err
+		}
+		c.add(condition.SQL, condition.Vars...)
+	}
+
+	if len(or) > 0 {
+		alternatives := make([]string, len(or))
+		var vars []interface{}
+		for i, filter := range or {
+			condition, err := compile(filter)
+			if err != nil {
+				return clause.Expr{}, err
+			}
+			alternatives[i] = "(" + condition.SQL + ")"
+			vars = append(vars, condition.Vars...)
+		}
+		c.add(strings.Join(alternatives, " OR "), vars...)
+	}
+
+	if not != nil {
+		condition, err := compile(not)
+		if err != nil {
+			return clause.Expr{}, err
+		}
+		c.add("NOT ("+condition.SQL+")", condition.Vars...)
+	}
+
+	if len(c.sql) == 0 {
+		return clause.Expr{SQL: "1 = 1"}, nil
+	}
+	return clause.Expr{SQL: strings.Join(c.sql, " AND "), Vars: c.vars}, nil
+}
+
+// contactCondition compiles a ContactFilter into a condition on contacts
+func (r *Resolver) contactCondition(ctx context.Context, filter *models1.ContactFilter, depth int) (clause.Expr, error) {
+	if depth > maxFilterDepth {
+		return clause.Expr{}, errFilterTooDeep
+	}
+
+	var c conditions
+	c.text("contacts.name", filter.Name)
+	c.text("contacts.email", filter.Email)
+	c.text("contacts.phone", filter.Phone)
+	c.dateRange("contacts.created_at", filter.CreatedAt)
+
+	return combine(&c, filter.And, filter.Or, filter.Not, func(nested *models1.ContactFilter) (clause.Expr, error) {
+		return r.contactCondition(ctx, nested, depth+1)
+	})
+}
+
+// propertyCondition compiles a PropertyFilter into a condition on properties
+func (r *Resolver) propertyCondition(ctx context.Context, filter *models1.PropertyFilter, depth int) (clause.Expr, error) {
+	if depth > maxFilterDepth {
+		return clause.Expr{}, errFilterTooDeep
+	}
+
+	var c conditions
+	c.text("properties.name", filter.Name)
+	c.text("properties.address", filter.Address)
+	for _, status := range filter.Status {
+		if !models.IsValidPropertyStatus(status) {
+			return clause.Expr{}, invalidPropertyStatusError(status)
+		}
+	}
+	c.oneOf("properties.status", filter.Status)
+	c.dateRange("properties.created_at", filter.CreatedAt)
+
+	if filter.Owner != nil {
+		owner, err := r.contactCondition(ctx, filter.Owner, depth+1)
+		if err != nil {
+			return clause.Expr{}, err
+		}
+		c.related("properties.owner_id", r.db(ctx).Model(&models.Contact{}).Select("contacts.id").Where(owner))
+	}
+
+	return combine(&c, filter.And, filter.Or, filter.Not, func(nested *models1.PropertyFilter) (clause.Expr, error) {
+		return r.propertyCondition(ctx, nested, depth+1)
+	})
+}
+
+// dealCondition compiles a DealFilter into a condition on deals
+func (r *Resolver) dealCondition(ctx context.Context, filter *models1.DealFilter, depth int) (clause.Expr, error) {
+	if depth > maxFilterDepth {
+		return clause.Expr{}, errFilterTooDeep
+	}
+
+	var c conditions
+	c.text("deals.name", filter.Name)
+	c.oneOf("deals.status", filter.Status)
+	c.floatRange("deals.value", filter.Value)
+	c.dateRange("deals.created_at", filter.CreatedAt)
+	if err := c.ids("deals.assigned_to", filter.AssignedTo, "team member"); err != nil {
+		return clause.Expr{}, err
+	}
+
+	if filter.Property != nil {
+		property, err := r.propertyCondition(ctx, filter.Property, depth+1)
+		if err != nil {
+			return clause.Expr{}, err
+		}
+		c.related("deals.property_id", r.db(ctx).Model(&models.Property{}).Select("properties.id").Where(property))
+	}
+
+	return combine(&c, filter.And, filter.Or, filter.Not, func(nested *models1.DealFilter) (clause.Expr, error) {
+		return r.dealCondition(ctx, nested, depth+1)
+	})
+}
+
+// taskCondition compiles a TaskFilter into a condition on tasks
+func (r *Resolver) taskCondition(ctx context.Context, filter *models1.TaskFilter, depth int) (clause.Expr, error) {
+	if depth > maxFilterDepth {
+		return clause.Expr{}, errFilterTooDeep
+	}
+
+	var c conditions
+	c.text("tasks.title", filter.Title)
+	for _, status := range filter.Status {
+		if !models.IsValidTaskStatus(status) {
+			return clause.Expr{}, invalidTaskStatusError(status)
+		}
+	}
+	c.oneOf("tasks.status", filter.Status)
+	c.dateRange("tasks.due_date", filter.DueDate)
+	c.dateRange("tasks.created_at", filter.CreatedAt)
+	if err := c.ids("tasks.assigned_to", filter.AssignedTo, "team member"); err != nil {
+		return clause.Expr{}, err
+	}
+
+	if filter.Deal != nil {
+		deal, err := r.dealCondition(ctx, filter.Deal, depth+1)
+		if err != nil {
+			return clause.Expr{}, err
+		}
+		c.related("tasks.deal_id", r.db(ctx).Model(&models.Deal{}).Select("deals.id").Where(deal))
+	}
+
+	return combine(&c, filter.And, filter.Or, filter.Not, func(nested *models1.TaskFilter) (clause.Expr, error) {
+		return r.taskCondition(ctx, nested, depth+1)
+	})
+}
+
+// documentCondition compiles a DocumentFilter into a condition on documents
+func (r *Resolver) documentCondition(ctx context.Context, filter *models1.DocumentFilter, depth int) (clause.Expr, error) {
+	if depth > maxFilterDepth {
+		return clause.Expr{}, errFilterTooDeep
+	}
+
+	var c conditions
+	c.text("documents.title", filter.Title)
+	c.oneOf("documents.file_type", filter.FileType)
+	c.dateRange("documents.created_at", filter.CreatedAt)
+	if err := c.ids("documents.uploaded_by", filter.UploadedBy, "team member"); err != nil {
+		return clause.Expr{}, err
+	}
+
+	if filter.Deal != nil {
+		deal, err := r.dealCondition(ctx, filter.Deal, depth+1)
+		if err != nil {
+			return clause.Expr{}, err
+		}
+		c.related("documents.deal_id", r.db(ctx).Model(&models.Deal{}).Select("deals.id").Where(deal))
+	}
+
+	if filter.Property != nil {
+		property, err := r.propertyCondition(ctx, filter.Property, depth+1)
+		if err != nil {
+			return clause.Expr{}, err
+		}
+		c.related("documents.property_id", r.db(ctx).Model(&models.Property{}).Select("properties.id").Where(property))
+	}
+
+	return combine(&c, filter.And, filter.Or, filter.Not, func(nested *models1.DocumentFilter) (clause.Expr, error) {
+		return r.documentCondition(ctx, nested, depth+1)
+	})
+}
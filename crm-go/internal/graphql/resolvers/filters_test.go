@@ -0,0 +1,197 @@
+package resolvers_test
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/99designs/gqlgen/client"
+
+	"crmgo/internal/models"
+	"crmgo/internal/tenant"
+)
+
+// filterIDs runs a connection query with filter and returns the IDs of the
+// nodes it matched, sorted
+func filterIDs(t *testing.T, c *client.Client, connection, filter string) ([]string, []graphqlError) {
+	t.Helper()
+
+	data, errs := post(t, c, fmt.Sprintf(`query { %s(filter: %s, first: 100) { edges { node { id } } } }`, connection, filter))
+	if len(errs) > 0 {
+		return nil, errs
+	}
+	return edgeIDs(data, connection), nil
+}
+
+// edgeIDs returns the sorted IDs of the nodes of a connection in data
+func edgeIDs(data map[string]interface{}, connection string) []string {
+	var ids []string
+	for _, edge := range data[connection].(map[string]interface{})["edges"].([]interface{}) {
+		ids = append(ids, edge.(map[string]interface{})["node"].(map[string]interface{})["id"].(string))
+	}
+	sort.Strings(ids)
+	return ids
+}
+
+func TestNotMatchesRowsMissingTheValue(t *testing.T) {
+	c, resolver := newServer(t, 1)
+	seedDeals(t, resolver, 0)
+	deals := seedValuedDeals(t, resolver, worth(100), nil, worth(300))
+	id := func(i int) string { return fmt.Sprint(deals[i].ID) }
+
+	tests := []struct {
+		filter string
+		want   []string
+	}{
+		{`{value: {min: 200}}`, []string{id(2)}},
+		{`{not: {value: {min: 200}}}`, []string{id(0), id(1)}},
+		{`{not: {not: {value: {min: 200}}}}`, []string{id(2)}},
+		{`{or: [{value: {max: 150}}, {not: {value: {min: 0}}}]}`, []string{id(0), id(1)}},
+	}
+	for _, tt := range tests {
+		got, errs := filterIDs(t, c, "dealsConnection", tt.filter)
+		if len(errs) > 0 {
+			t.Errorf("%s: %v", tt.filter, errs)
+			continue
+		}
+		if strings.Join(got, ",") != strings.Join(tt.want, ",") {
+			t.Errorf("%s matched deals %v, want %v", tt.filter, got, tt.want)
+		}
+	}
+}
+
+func TestFiltersFollowRelatedItems(t *testing.T) {
+	c, resolver := newServer(t, 1)
+	seedDeals(t, resolver, 6) // Deal i+1 is on property i%4, owned by Owner i%4
+
+	tests := []struct {
+		filter string
+		want   []string
+	}{
+		{`{property: {owner: {name: {equals: "owner 1"}}}}`, []string{"2", "6"}},
+		{`{property: {owner: {not: {name: {startsWith: "Owner 1"}}}}}`, []string{"1", "3", "4", "5"}},
+		{`{property: {name: {equals: "Property 2"}, owner: {name: {equals: "Owner 1"}}}}`, nil},
+		{`{or: [{property: {owner: {name: {equals: "Owner 0"}}}}, {property: {name: {equals: "Property 3"}}}]}`, []string{"1", "4", "5"}},
+	}
+	for _, tt := range tests {
+		got, errs := filterIDs(t, c, "dealsConnection", tt.filter)
+		if len(errs) > 0 {
+			t.Errorf("%s: %v", tt.filter, errs)
+			continue
+		}
+		if strings.Join(got, ",") != strings.Join(tt.want, ",") {
+			t.Errorf("%s matched deals %v, want %v", tt.filter, got, tt.want)
+		}
+	}
+
+	// Tasks reach through their deal to its property's owner
+	got, errs := filterIDs(t, c, "tasksConnection", `{deal: {property: {owner: {name: {equals: "Owner 3"}}}}}`)
+	if len(errs) > 0 || strings.Join(got, ",") != "7,8" {
+		t.Errorf("tasks on deals of Owner 3's property: %v %v, want 7,8", got, errs)
+	}
+}
+
+func TestDeeplyNestedFiltersAreRefused(t *testing.T) {
+	c, resolver := newServer(t, 1)
+	seedDeals(t, resolver, 1)
+
+	nested := func(depth int) string {
+		return strings.Repeat(`{not: `, depth) + `{name: {contains: "Deal"}}` + strings.Repeat(`}`, depth)
+	}
+
+	if _, errs := filterIDs(t, c, "dealsConnection", nested(4)); len(errs) > 0 {
+		t.Errorf("filter nested 4 deep: %v", errs)
+	}
+	if _, errs := filterIDs(t, c, "dealsConnection", nested(20)); len(errs) == 0 || !strings.Contains(errs[0].Message, "nested too deeply") {
+		t.Errorf("filter nested 20 deep: %v, want a refusal", errs)
+	}
+
+	// Related items' filters count towards the depth too
+	related := `{property: {owner: ` + nested(10) + `}}`
+	if _, errs := filterIDs(t, c, "dealsConnection", related); len(errs) == 0 || !strings.Contains(errs[0].Message, "nested too deeply") {
+		t.Errorf("owner filter nested 10 deep: %v, want a refusal", errs)
+	}
+}
+
+func TestTextFiltersMatchWildcardsLiterally(t *testing.T) {
+	c, resolver := newServer(t, 1)
+	seedDeals(t, resolver, 0)
+	db := resolver.DB.WithContext(tenant.WithoutScope(context.Background()))
+
+	orgID := uint(1)
+	ids := make(map[string]string)
+	for _, name := range []string{"50% off", "500 offers", "a_b", "axb", `c\d`, "cd"} {
+		contact := models.Contact{Name: name, OrganisationID: &orgID}
+		if err := db.Create(&contact).Error; err != nil {
+			t.Fatalf("seed contact: %v", err)
+		}
+		ids[name] = fmt.Sprint(contact.ID)
+	}
+
+	tests := []struct {
+		filter string
+		want   []string
+	}{
+		{`{name: {contains: "50%"}}`, []string{"50% off"}},
+		{`{name: {startsWith: "50%"}}`, []string{"50% off"}},
+		{`{name: {contains: "a_b"}}`, []string{"a_b"}},
+		{`{name: {startsWith: "A_"}}`, []string{"a_b"}},
+		{`{name: {contains: "c\\d"}}`, []string{`c\d`}},
+		{`{name: {startsWith: "50"}, not: {name: {contains: "%"}}}`, []string{"500 offers"}},
+	}
+	for _, tt := range tests {
+		got, errs := filterIDs(t, c, "contactsConnection", tt.filter)
+		if len(errs) > 0 {
+			t.Errorf("%s: %v", tt.filter, errs)
+			continue
+		}
+		var want []string
+		for _, name := range tt.want {
+			want = append(want, ids[name])
+		}
+		sort.Strings(want)
+		if strings.Join(got, ",") != strings.Join(want, ",") {
+			t.Errorf("%s matched contacts %v, want %v (%v)", tt.filter, got, want, tt.want)
+		}
+	}
+}
+
+func TestDateRangeFiltersIgnoreTheClientsOffset(t *testing.T) {
+	c, resolver := newServer(t, 1)
+	seedDeals(t, resolver, 1)
+
+	due := time.Now().Add(48 * time.Hour).Truncate(time.Second)
+	data, errs := post(t, c, `mutation($due: DateTime) { createTask(input: {title: "Call the buyer", dealId: "1", dueDate: $due}) { id } }`,
+		client.Var("due", due.In(awayFromLocal(3)).Format(time.RFC3339)))
+	if len(errs) > 0 {
+		t.Fatalf("create task: %v", errs)
+	}
+	taskID := data["createTask"].(map[string]interface{})["id"].(string)
+
+	for _, tc := range []struct {
+		from, to time.Time
+		match    bool
+	}{
+		{due, due, true},
+		{due.Add(-time.Minute), due.Add(time.Minute), true},
+		{due.Add(time.Minute), due.Add(time.Hour), false},
+		{due.Add(-time.Hour), due.Add(-time.Minute), false},
+	} {
+		filter := map[string]interface{}{"dueDate": map[string]interface{}{
+			"from": tc.from.In(awayFromLocal(-8)).Format(time.RFC3339),
+			"to":   tc.to.In(awayFromLocal(-8)).Format(time.RFC3339),
+		}}
+		data, errs := post(t, c, `query($filter: TaskFilter) { tasksConnection(filter: $filter) { edges { node { id } } } }`, client.Var("filter", filter))
+		if len(errs) > 0 {
+			t.Fatalf("filter: %v", errs)
+		}
+		got := edgeIDs(data, "tasksConnection")
+		if matched := strings.Join(got, ",") == taskID; matched != tc.match {
+			t.Errorf("due date between %s and %s matched %v, want the task matched %v",
+				tc.from.Format(time.RFC3339), tc.to.Format(time.RFC3339), got, tc.match)
+		}
+	}
+}
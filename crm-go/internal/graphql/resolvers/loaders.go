@@ -0,0 +1,220 @@
+package resolvers
+
+import (
+	"context"
+	"net/http"
+	"sync"
+	"time"
+
+	"crmgo/internal/models"
+)
+
+// loaderWait is how long a loader waits for another key before loading
+// those it has, long enough for the sibling fields of a list to ask for
+// theirs. A batch waits at most loaderMaxWait in all, however many keys
+// keep arriving.
+const (
+	loaderWait    = 10 * time.Millisecond
+	loaderMaxWait = 100 * time.Millisecond
+)
+
+// loaderMaxBatch caps the keys loaded by one query, keeping it within
+// SQLite's limit on bound parameters
+const loaderMaxBatch = 500
+
+// loader batches the loads of one kind of item that a request's field
+// resolvers make at about the same time into a single query, and caches
+// what it loaded for the rest of the request
+type loader[K comparable, V any] struct {
+	fetch func(ctx context.Context, keys []K) (map[K]V, error)
+
+	mu      sync.Mutex
+	pending *loaderBatch[K, V]
+	loaded  map[K]*loaderBatch[K, V]
+}
+
+// loaderBatch is a set of keys loaded together
+type loaderBatch[K comparable, V any] struct {
+	keys    []K
+	added   chan struct{}
+	full    chan struct{}
+	done    chan struct{}
+	results map[K]V
+	err     error
+}
+
+// newLoader returns a loader that loads its keys with fetch. Keys fetch
+// finds nothing for load as V's zero value.
+func newLoader[K comparable, V any](fetch func(ctx context.Context, keys []K) (map[K]V, error)) *loader[K, V] {
+	return &loader[K, V]{fetch: fetch, loaded: make(map[K]*loaderBatch[K, V])}
+}
+
+// load returns the item for key, waiting for the batch it joins
+func (l *loader[K, V]) load(ctx context.Context, key K) (V, error) {
+	l.mu.Lock()
+	batch, ok := l.loaded[key]
+	if !ok {
+		batch = l.pending
+		if batch == nil {
+			batch = &loaderBatch[K, V]{added: make(chan struct{}, 1), full: make(chan struct{}), done: make(chan struct{})}
+			l.pending = batch
+			go l.run(ctx, batch)
+		}
+		batch.keys = append(batch.keys, key)
+		l.loaded[key] = batch
+		if len(batch.keys) == loaderMaxBatch {
+			l.pending = nil
+			close(batch.full)
+		} else {
+			select {
+			case batch.added <- struct{}{}:
+			default:
+			}
+		}
+	}
+	l.mu.Unlock()
+
+	<-batch.done
+	return batch.results[key], batch.err
+}
+
+// run loads batch once it is full or no more keys are coming
+func (l *loader[K, V]) run(ctx context.Context, batch *loaderBatch[K, V]) {
+	deadline := time.NewTimer(loaderMaxWait)
+	defer deadline.Stop()
+	wait := time.NewTimer(loaderWait)
+	defer wait.Stop()
+
+collect:
+	for {
+		select {
+		case <-batch.full:
+			break collect
+		case <-batch.added:
+			if !wait.Stop() {
+				<-wait.C
+			}
+			wait.Reset(loaderWait)
+		case <-wait.C:
+			break collect
+		case <-deadline.C:
+			break collect
+		}
+	}
+
+	l.mu.Lock()
+	if l.pending == batch {
+		l.pending = nil
+	}
+	l.mu.Unlock()
+
+	batch.results, batch.err = l.fetch(ctx, batch.keys)
+	close(batch.done)
+}
+
+// Loaders batch the queries of the relational field resolvers over one
+// request, so listing many items costs a query per related kind of item
+// rather than one per item. Items are loaded by ID or, for lists of related
+// items, by the foreign key pointing back at their parent.
+type Loaders struct {
+	contacts    *loader[uint, *models.Contact]
+	deals       *loader[uint, *models.Deal]
+	meetings    *loader[uint, *models.Meeting]
+	properties  *loader[uint, *models.Property]
+	teamMembers *loader[uint, *models.TeamMember]
+
+	dealsByProperty     *loader[uint, []*models.Deal]
+	discussionsByDeal   *loader[uint, []*models.Discussion]
+	documentsByDeal     *loader[uint, []*models.Document]
+	documentsByProperty *loader[uint, []*models.Document]
+	meetingsByDeal      *loader[uint, []*models.Meeting]
+	notesByMeeting      *loader[uint, []*models.MeetingNotes]
+	propertiesByOwner   *loader[uint, []*models.Property]
+	tasksByDeal         *loader[uint, []*models.Task]
+}
+
+// newLoaders returns a fresh set of loaders for one request
+func (r *Resolver) newLoaders() *Loaders {
+	return &Loaders{
+		contacts:    newLoader(byID(r, func(c *models.Contact) uint { return c.ID })),
+		deals:       newLoader(byID(r, func(d *models.Deal) uint { return d.ID })),
+		meetings:    newLoader(byID(r, func(m *models.Meeting) uint { return m.ID })),
+		properties:  newLoader(byID(r, func(p *models.Property) uint { return p.ID })),
+		teamMembers: newLoader(byID(r, func(t *models.TeamMember) uint { return t.ID })),
+
+		dealsByProperty:     newLoader(byForeignKey(r, "property_id", "created_at DESC", func(d *models.Deal) uint { return *d.PropertyID })),
+		discussionsByDeal:   newLoader(byForeignKey(r, "deal_id", "timestamp ASC", func(d *models.Discussion) uint { return *d.DealID })),
+		documentsByDeal:     newLoader(byForeignKey(r, "deal_id", "uploaded_at DESC", func(d *models.Document) uint { return *d.DealID })),
+		documentsByProperty: newLoader(byForeignKey(r, "property_id", "uploaded_at DESC", func(d *models.Document) uint { return *d.PropertyID })),
+		meetingsByDeal:      newLoader(byForeignKey(r, "deal_id", "datetime ASC", func(m *models.Meeting) uint { return *m.DealID })),
+		notesByMeeting:      newLoader(byForeignKey(r, "meeting_id", "timestamp ASC", func(n *models.MeetingNotes) uint { return n.MeetingID })),
+		propertiesByOwner:   newLoader(byForeignKey(r, "owner_id", "created_at DESC", func(p *models.Property) uint { return *p.OwnerID })),
+		tasksByDeal:         newLoader(byForeignKey(r, "deal_id", "created_at ASC", func(t *models.Task) uint { return *t.DealID })),
+	}
+}
+
+// byID returns the fetch of a loader of items by ID
+func byID[T any](r *Resolver, id func(*T) uint) func(ctx context.Context, ids []uint) (map[uint]*T, error) {
+	return func(ctx context.Context, ids []uint) (map[uint]*T, error) {
+		var items []*T
+		if err := r.db(ctx).Where("id IN ?", ids).Find(&items).Error; err != nil {
+			return nil, err
+		}
+
+		byID := make(map[uint]*T, len(items))
+		for _, item := range items {
+			byID[id(item)] = item
+		}
+		return byID, nil
+	}
+}
+
+// byForeignKey returns the fetch of a loader of the items whose column
+// refers to each key, in order
+func byForeignKey[T any](r *Resolver, column, order string, key func(*T) uint) func(ctx context.Context, keys []uint) (map[uint][]*T, error) {
+	return func(ctx context.Context, keys []uint) (map[uint][]*T, error) {
+		var items []*T
+		if err := r.db(ctx).Where(column+" IN ?", keys).Order(order).Find(&items).Error; err != nil {
+			return nil, err
+		}
+
+		// Keys with nothing referring to them load an empty list, not nil
+		byKey := make(map[uint][]*T, len(keys))
+		for _, key := range keys {
+			byKey[key] = []*T{}
+		}
+		for _, item := range items {
+			byKey[key(item)] = append(byKey[key(item)], item)
+		}
+		return byKey, nil
+	}
+}
+
+// loadersKey is the context key of a request's loaders
+type loadersKey struct{}
+
+// DataLoaders is HTTP middleware giving each request around the GraphQL
+// handler its own loaders
+func (r *Resolver) DataLoaders(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		ctx := context.WithValue(req.Context(), loadersKey{}, r.newLoaders())
+		next.ServeHTTP(w, req.WithContext(ctx))
+	})
+}
+
+// loaders returns the request's loaders. Outside a request served through
+// DataLoaders each call gets fresh loaders, which load without batching.
+func (r *Resolver) loaders(ctx context.Context) *Loaders {
+	if loaders, ok := ctx.Value(loadersKey{}).(*Loaders); ok {
+		return loaders
+	}
+	return r.newLoaders()
+}
+
+// loadOptional loads the item an optional foreign key refers to, or nil
+func loadOptional[V any](ctx context.Context, l *loader[uint, *V], id *uint) (*V, error) {
+	if id == nil {
+		return nil, nil
+	}
+	return l.load(ctx, *id)
+}
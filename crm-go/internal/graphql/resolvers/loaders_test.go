@@ -0,0 +1,144 @@
+package resolvers_test
+
+import (
+	"context"
+	"fmt"
+	"sync/atomic"
+	"testing"
+
+	"github.com/99designs/gqlgen/client"
+	"gorm.io/gorm"
+
+	"crmgo/internal/graphql/resolvers"
+	"crmgo/internal/models"
+	"crmgo/internal/tenant"
+)
+
+// seedDeals gives user 1 an organisation holding deals, each with a
+// property, an assignee, and tasks and a document of the assignee's
+func seedDeals(t *testing.T, resolver *resolvers.Resolver, deals int) {
+	t.Helper()
+
+	db := resolver.DB.WithContext(tenant.WithoutScope(context.Background()))
+	create := func(value interface{}) {
+		if err := db.Create(value).Error; err != nil {
+			t.Fatalf("seed %T: %v", value, err)
+		}
+	}
+
+	organisation := models.Organisation{OrganisationName: "Acme Realty"}
+	create(&organisation)
+	orgID := organisation.ID
+	user := models.User{Email: "jane@example.com", Password: "hash", Role: models.RoleAdmin, OrganisationID: &orgID}
+	create(&user)
+	create(&models.Membership{UserID: user.ID, OrganisationID: orgID, Role: models.RoleAdmin})
+
+	var agents []models.TeamMember
+	for i := 0; i < 3; i++ {
+		agent := models.TeamMember{OrganisationID: orgID, TeamMemberName: fmt.Sprintf("Agent %d", i), TeamMemberEmailID: fmt.Sprintf("agent%d@example.com", i)}
+		create(&agent)
+		agents = append(agents, agent)
+	}
+
+	var properties []models.Property
+	for i := 0; i < 4; i++ {
+		owner := models.Contact{Name: fmt.Sprintf("Owner %d", i), OrganisationID: &orgID}
+		create(&owner)
+		property := models.Property{Name: fmt.Sprintf("Property %d", i), OrganisationID: orgID, OwnerID: &owner.ID}
+		create(&property)
+		properties = append(properties, property)
+	}
+
+	for i := 0; i < deals; i++ {
+		deal := models.Deal{
+			Name:           fmt.Sprintf("Deal %d", i),
+			OrganisationID: orgID,
+			PropertyID:     &properties[i%len(properties)].ID,
+			AssignedTo:     &agents[i%len(agents)].ID,
+		}
+		create(&deal)
+		for j := 0; j < 2; j++ {
+			create(&models.Task{Title: fmt.Sprintf("Task %d.%d", i, j), DealID: &deal.ID, AssignedTo: deal.AssignedTo})
+		}
+		create(&models.Document{Title: fmt.Sprintf("Document %d", i), OrganisationID: orgID, DealID: &deal.ID, UploadedBy: deal.AssignedTo})
+	}
+}
+
+// countQueries counts the queries run on db from now on
+func countQueries(t *testing.T, db *gorm.DB) *int64 {
+	t.Helper()
+
+	var queries int64
+	err := db.Callback().Query().After("gorm:query").Register("test:count_queries", func(*gorm.DB) {
+		atomic.AddInt64(&queries, 1)
+	})
+	if err != nil {
+		t.Fatalf("register query counter: %v", err)
+	}
+	return &queries
+}
+
+func TestNestedDealsListingBatchesQueries(t *testing.T) {
+	c, resolver := newServer(t, 1)
+	seedDeals(t, resolver, 24)
+	queries := countQueries(t, resolver.DB)
+
+	const listing = `query($first: Int) {
+		dealsConnection(first: $first) {
+			edges { node {
+				name
+				property { name owner { name } deals { name } }
+				assignedTeamMember { teamMemberName }
+				tasks { title assignedTeamMember { teamMemberName } }
+				documents { title uploader { teamMemberName } }
+			} }
+		}
+	}`
+
+	list := func(first int) int64 {
+		t.Helper()
+
+		atomic.StoreInt64(queries, 0)
+		data, errs := post(t, c, listing, client.Var("first", first))
+		if len(errs) > 0 {
+			t.Fatalf("list %d deals: %v", first, errs)
+		}
+
+		edges := data["dealsConnection"].(map[string]interface{})["edges"].([]interface{})
+		if len(edges) != first {
+			t.Fatalf("listed %d deals, want %d", len(edges), first)
+		}
+		for _, edge := range edges {
+			deal := edge.(map[string]interface{})["node"].(map[string]interface{})
+			property, _ := deal["property"].(map[string]interface{})
+			if property == nil || property["owner"] == nil || len(property["deals"].([]interface{})) != 6 {
+				t.Fatalf("%v: property not loaded with its owner and deals: %v", deal["name"], property)
+			}
+			if deal["assignedTeamMember"] == nil {
+				t.Fatalf("%v: assignee not loaded", deal["name"])
+			}
+			tasks := deal["tasks"].([]interface{})
+			if len(tasks) != 2 || tasks[1].(map[string]interface{})["assignedTeamMember"] == nil {
+				t.Fatalf("%v: tasks not loaded with their assignees: %v", deal["name"], tasks)
+			}
+			documents := deal["documents"].([]interface{})
+			if len(documents) != 1 || documents[0].(map[string]interface{})["uploader"] == nil {
+				t.Fatalf("%v: documents not loaded with their uploaders: %v", deal["name"], documents)
+			}
+		}
+		return atomic.LoadInt64(queries)
+	}
+
+	few, many := list(2), list(24)
+
+	// Related items are loaded a kind at a time: 12 queries for either
+	// listing. Batches are formed within a short wait, so a slow machine may
+	// split one, but the count must not grow with the number of deals.
+	if many > few+3 {
+		t.Errorf("listing 2 deals ran %d queries but listing 24 ran %d; related items should be loaded in batches", few, many)
+	}
+	// Loading any related field one deal at a time would take 24 on its own
+	if many >= 24 {
+		t.Errorf("listing 24 deals ran %d queries, want far fewer than one per deal", many)
+	}
+}
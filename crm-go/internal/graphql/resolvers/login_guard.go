@@ -0,0 +1,210 @@
+package resolvers
+
+import (
+	"context"
+	"errors"
+	"log"
+	"sync"
+	"time"
+
+	"crmgo/internal/auth"
+	"crmgo/internal/models"
+
+	"golang.org/x/crypto/bcrypt"
+	"gorm.io/gorm"
+)
+
+// maxLoginDelay caps the progressive delay between failed sign-ins
+const maxLoginDelay = 10 * time.Second
+
+// errTooManyLoginAttempts is returned when an IP address has failed to sign
+// in too often within the failure window
+var errTooManyLoginAttempts = errors.New("too many failed sign-in attempts, please try again later")
+
+// errAccountLocked is returned while an account is locked out
+var errAccountLocked = errors.New("this account is temporarily locked after too many failed sign-in attempts, please try again later")
+
+// errAccountDeactivated is returned when a deactivated team member signs in
+// or acts in the organisation that deactivated them
+var errAccountDeactivated = errors.New("this account has been deactivated, please contact your organisation's administrator")
+
+// dummyPasswordHash is compared against when the email is unknown, so a
+// miss takes as long as a wrong password
+var dummyPasswordHash = sync.OnceValue(func() []byte {
+	hash, _ := bcrypt.GenerateFromPassword([]byte("not-a-real-password"), bcrypt.DefaultCost)
+	return hash
+})
+
+// recordLoginEvent stores a sign-in event. Failing to record one must not
+// stop the sign-in itself, so errors are only logged.
+func (r *Resolver) recordLoginEvent(ctx context.Context, event models.LoginEvent) {
+	if event.IPAddress == "" {
+		event.IPAddress = auth.ClientIP(ctx)
+	}
+	if err := r.db(ctx).Create(&event).Error; err != nil {
+		log.Printf("Failed to record %s event for %s: %v", event.Type, event.Email, err)
+	}
+}
+
+// recentIPFailures counts the failed sign-ins from ip within the failure window
+func (r *Resolver) recentIPFailures(ctx context.Context, ip string) (int, error) {
+	if ip == "" {
+		return 0, nil
+	}
+
+	var count int64
+	err := r.db(ctx).Model(&models.LoginEvent{}).
+		Where("ip_address = ? AND type IN ? AND created_at > ?",
+			ip, []string{models.LoginEventFailed, models.LoginEventLocked}, time.Now().Add(-r.Config.LoginFailureWindow)).
+		Count(&count).Error
+	return int(count), err
+}
+
+// recentAccountFailures returns the user's consecutive failures, ignoring
+// any that have aged out of the failure window
+func (r *Resolver) recentAccountFailures(user *models.User) int {
+	if user.LastFailedLogin == nil || time.Since(*user.LastFailedLogin) > r.Config.LoginFailureWindow {
+		return 0
+	}
+	return user.FailedLogins
+}
+
+// loginDelay returns how long to hold a sign-in attempt after the given
+// number of recent failures: nothing at first, then doubling up to a cap
+func (r *Resolver) loginDelay(failures int) time.Duration {
+	if failures <= 0 || r.Config.LoginDelayBase <= 0 {
+		return 0
+	}
+
+	delay := r.Config.LoginDelayBase
+	for i := 1; i < failures && delay < maxLoginDelay; i++ {
+		delay *= 2
+	}
+	if delay > maxLoginDelay {
+		delay = maxLoginDelay
+	}
+	return delay
+}
+
+// waitLoginDelay sleeps for delay unless the request is cancelled first
+func waitLoginDelay(ctx context.Context, delay time.Duration) error {
+	if delay <= 0 {
+		return nil
+	}
+
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// checkLoginIP refuses addresses that keep guessing, whichever accounts they
+// try, and returns the address's recent failures
+func (r *Resolver) checkLoginIP(ctx context.Context, email string) (int, error) {
+	ipFailures, err := r.recentIPFailures(ctx, auth.ClientIP(ctx))
+	if err != nil {
+		return 0, err
+	}
+	if r.Config.LoginIPMaxFailures > 0 && ipFailures >= r.Config.LoginIPMaxFailures {
+		r.recordLoginEvent(ctx, models.LoginEvent{Type: models.LoginEventRefused, Email: email, Reason: "too many failures from this IP address"})
+		return 0, errTooManyLoginAttempts
+	}
+	return ipFailures, nil
+}
+
+// isLocked reports whether user is locked out, recording the refused attempt
+func (r *Resolver) isLocked(ctx context.Context, user *models.User) bool {
+	if user.LockedUntil == nil || !time.Now().Before(*user.LockedUntil) {
+		return false
+	}
+	r.recordLoginEvent(ctx, models.LoginEvent{Type: models.LoginEventRefused, Email: user.Email, UserID: &user.ID, Reason: "account locked"})
+	return true
+}
+
+// isDeactivated reports whether every organisation user belongs to has
+// deactivated them, recording the refused attempt. Users who have not joined
+// an organisation yet are not deactivated.
+func (r *Resolver) isDeactivated(ctx context.Context, user *models.User) bool {
+	var memberships, active int64
+	if err := r.db(ctx).Model(&models.Membership{}).Where("user_id = ?", user.ID).Count(&memberships).Error; err != nil {
+		return false
+	}
+	if err := r.db(ctx).Model(&models.Membership{}).Where("user_id = ? AND deactivated_at IS NULL", user.ID).Count(&active).Error; err != nil {
+		return false
+	}
+	if memberships == 0 || active > 0 {
+		return false
+	}
+	r.recordLoginEvent(ctx, models.LoginEvent{Type: models.LoginEventRefused, Email: user.Email, UserID: &user.ID, Reason: "account deactivated"})
+	return true
+}
+
+// recordFailedLogin counts a wrong password or second factor against user
+// and locks the account once the limit is reached. It reports whether the
+// account is now locked. The count is updated in the database rather than
+// from user, so guesses made in parallel are each counted.
+func (r *Resolver) recordFailedLogin(ctx context.Context, user *models.User, reason string) (bool, error) {
+	now := time.Now()
+
+	// Failures older than the window no longer count towards a lockout
+	err := r.db(ctx).Model(&models.User{}).Where("id = ?", user.ID).Updates(map[string]interface{}{
+		"failed_logins":     gorm.Expr("CASE WHEN last_failed_login > ? THEN failed_logins + 1 ELSE 1 END", now.Add(-r.Config.LoginFailureWindow)),
+		"last_failed_login": now,
+	}).Error
+	if err != nil {
+		return false, err
+	}
+
+	// Only the failure that reaches the limit locks the account. The count
+	// starts again once the lockout has run its course.
+	locked := false
+	if r.Config.LoginMaxFailures > 0 {
+		result := r.db(ctx).Model(&models.User{}).
+			Where("id = ? AND failed_logins >= ?", user.ID, r.Config.LoginMaxFailures).
+			Updates(map[string]interface{}{
+				"failed_logins": 0,
+				"locked_until":  now.Add(r.Config.LoginLockout),
+			})
+		if result.Error != nil {
+			return false, result.Error
+		}
+		locked = result.RowsAffected > 0
+	}
+
+	event := models.LoginEvent{Type: models.LoginEventFailed, Email: user.Email, UserID: &user.ID, Reason: reason}
+	if locked {
+		event.Type = models.LoginEventLocked
+		log.Printf("Locked account %s after %d failed sign-ins from %s", user.Email, r.Config.LoginMaxFailures, auth.ClientIP(ctx))
+	}
+	r.recordLoginEvent(ctx, event)
+
+	return locked, nil
+}
+
+// lockedMeanwhile reports whether the account was locked while one of its
+// sign-ins was being checked, by failed guesses running alongside it
+func (r *Resolver) lockedMeanwhile(ctx context.Context, user *models.User) (bool, error) {
+	var current models.User
+	if err := r.db(ctx).Select("id", "email", "locked_until").First(&current, user.ID).Error; err != nil {
+		return false, err
+	}
+	return r.isLocked(ctx, &current), nil
+}
+
+// clearFailedLogins resets the failure count after a successful sign-in
+func (r *Resolver) clearFailedLogins(ctx context.Context, user *models.User) error {
+	if user.FailedLogins == 0 && user.LockedUntil == nil {
+		return nil
+	}
+
+	return r.db(ctx).Model(&models.User{}).Where("id = ?", user.ID).Updates(map[string]interface{}{
+		"failed_logins":     0,
+		"last_failed_login": nil,
+		"locked_until":      nil,
+	}).Error
+}
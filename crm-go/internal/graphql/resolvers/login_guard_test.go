@@ -0,0 +1,243 @@
+package resolvers_test
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/99designs/gqlgen/client"
+	"gorm.io/gorm"
+
+	"crmgo/internal/graphql/resolvers"
+	"crmgo/internal/models"
+	"crmgo/internal/tenant"
+)
+
+// seedMember adds a user signing in with password to user 1's organisation
+func seedMember(t *testing.T, resolver *resolvers.Resolver, email, password string) *models.User {
+	t.Helper()
+
+	db := resolver.DB.WithContext(tenant.WithoutScope(context.Background()))
+	orgID := uint(1)
+	user := models.User{Email: email, Password: password, Role: models.RoleAgent, OrganisationID: &orgID}
+	if err := db.Create(&user).Error; err != nil {
+		t.Fatalf("seed user: %v", err)
+	}
+	if err := db.Create(&models.Membership{UserID: user.ID, OrganisationID: orgID, Role: models.RoleAgent}).Error; err != nil {
+		t.Fatalf("seed membership: %v", err)
+	}
+	return &user
+}
+
+// withLockout locks accounts after maxFailures wrong guesses
+func withLockout(resolver *resolvers.Resolver, maxFailures int) {
+	resolver.Config.LoginMaxFailures = maxFailures
+	resolver.Config.LoginLockout = 15 * time.Minute
+	resolver.Config.LoginFailureWindow = 15 * time.Minute
+}
+
+// login signs in and returns the error message, or "" on success
+func login(t *testing.T, c *client.Client, email, password string) string {
+	t.Helper()
+
+	_, errs := post(t, c, `mutation($input: LoginInput!) { login(input: $input) { token } }`,
+		client.Var("input", map[string]interface{}{"email": email, "password": password}))
+	if len(errs) > 0 {
+		return errs[0].Message
+	}
+	return ""
+}
+
+func countLoginEvents(t *testing.T, db *gorm.DB, userID uint, eventType string) int64 {
+	t.Helper()
+
+	var count int64
+	if err := db.Model(&models.LoginEvent{}).Where("user_id = ? AND type = ?", userID, eventType).Count(&count).Error; err != nil {
+		t.Fatalf("count %s events: %v", eventType, err)
+	}
+	return count
+}
+
+func TestWrongPasswordsLockTheAccountUntilUnlocked(t *testing.T) {
+	c, resolver := newServer(t, 1)
+	seedDeals(t, resolver, 0)
+	withLockout(resolver, 3)
+	sam := seedMember(t, resolver, "sam@example.com", "correct-horse")
+	db := resolver.DB.WithContext(tenant.WithoutScope(context.Background()))
+
+	for i := 0; i < 2; i++ {
+		if msg := login(t, c, sam.Email, "wrong"); msg != "invalid email or password" {
+			t.Fatalf("wrong password %d: %q", i+1, msg)
+		}
+	}
+	if msg := login(t, c, sam.Email, "wrong"); !strings.Contains(msg, "temporarily locked") {
+		t.Fatalf("third wrong password: %q, want the account locked", msg)
+	}
+	if msg := login(t, c, sam.Email, "correct-horse"); !strings.Contains(msg, "temporarily locked") {
+		t.Fatalf("right password while locked: %q, want the account locked", msg)
+	}
+	if n := countLoginEvents(t, db, sam.ID, models.LoginEventLocked); n != 1 {
+		t.Errorf("recorded %d lockouts, want 1", n)
+	}
+
+	// An administrator of the organisation lifts the lockout
+	if _, errs := post(t, c, `mutation($id: ID!) { unlockUser(userId: $id) }`, client.Var("id", sam.ID)); len(errs) > 0 {
+		t.Fatalf("unlock: %v", errs)
+	}
+	if msg := login(t, c, sam.Email, "correct-horse"); msg != "" {
+		t.Fatalf("right password after unlocking: %q", msg)
+	}
+
+	// A lockout also ends on its own
+	for i := 0; i < 3; i++ {
+		login(t, c, sam.Email, "wrong")
+	}
+	if err := db.Model(&models.User{}).Where("id = ?", sam.ID).Update("locked_until", time.Now().Add(-time.Second)).Error; err != nil {
+		t.Fatalf("expire lockout: %v", err)
+	}
+	if msg := login(t, c, sam.Email, "correct-horse"); msg != "" {
+		t.Fatalf("right password after the lockout ran out: %q", msg)
+	}
+
+	var user models.User
+	if err := db.First(&user, sam.ID).Error; err != nil {
+		t.Fatalf("load user: %v", err)
+	}
+	if user.FailedLogins != 0 || user.LockedUntil != nil {
+		t.Errorf("after signing in: %d failures, locked until %v; want both cleared", user.FailedLogins, user.LockedUntil)
+	}
+}
+
+func TestFailuresOutsideTheWindowDoNotCount(t *testing.T) {
+	c, resolver := newServer(t, 1)
+	seedDeals(t, resolver, 0)
+	withLockout(resolver, 3)
+	sam := seedMember(t, resolver, "sam@example.com", "correct-horse")
+	db := resolver.DB.WithContext(tenant.WithoutScope(context.Background()))
+
+	login(t, c, sam.Email, "wrong")
+	login(t, c, sam.Email, "wrong")
+	if err := db.Model(&models.User{}).Where("id = ?", sam.ID).Update("last_failed_login", time.Now().Add(-time.Hour)).Error; err != nil {
+		t.Fatalf("age failures: %v", err)
+	}
+
+	if msg := login(t, c, sam.Email, "wrong"); msg != "invalid email or password" {
+		t.Fatalf("first failure in a new window: %q, want no lockout", msg)
+	}
+	var user models.User
+	if err := db.First(&user, sam.ID).Error; err != nil {
+		t.Fatalf("load user: %v", err)
+	}
+	if user.FailedLogins != 1 {
+		t.Errorf("failures counted %d, want 1", user.FailedLogins)
+	}
+}
+
+func TestParallelWrongPasswordsAreAllCounted(t *testing.T) {
+	c, resolver := newServer(t, 1)
+	seedDeals(t, resolver, 0)
+	withLockout(resolver, 5)
+	sam := seedMember(t, resolver, "sam@example.com", "correct-horse")
+	db := resolver.DB.WithContext(tenant.WithoutScope(context.Background()))
+
+	const guesses = 12
+	var wg sync.WaitGroup
+	for i := 0; i < guesses; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			c.RawPost(`mutation($input: LoginInput!) { login(input: $input) { token } }`,
+				client.Var("input", map[string]interface{}{"email": sam.Email, "password": "wrong"}))
+		}()
+	}
+	wg.Wait()
+
+	failed := countLoginEvents(t, db, sam.ID, models.LoginEventFailed)
+	locked := countLoginEvents(t, db, sam.ID, models.LoginEventLocked)
+	refused := countLoginEvents(t, db, sam.ID, models.LoginEventRefused)
+	if failed+locked+refused != guesses || locked == 0 {
+		t.Errorf("%d guesses recorded %d failures, %d lockouts and %d refusals; want every guess recorded and the account locked",
+			guesses, failed, locked, refused)
+	}
+	if msg := login(t, c, sam.Email, "correct-horse"); !strings.Contains(msg, "temporarily locked") {
+		t.Errorf("right password after parallel guessing: %q, want the account locked", msg)
+	}
+}
+
+func TestUnverifiedSignInIsRefusedNotSucceeded(t *testing.T) {
+	c, resolver := newServer(t, 1)
+	seedDeals(t, resolver, 0)
+	withLockout(resolver, 3)
+	resolver.Config.RequireEmailVerification = true
+	sam := seedMember(t, resolver, "sam@example.com", "correct-horse")
+	db := resolver.DB.WithContext(tenant.WithoutScope(context.Background()))
+
+	login(t, c, sam.Email, "wrong")
+	login(t, c, sam.Email, "wrong")
+	if msg := login(t, c, sam.Email, "correct-horse"); !strings.Contains(msg, "verify your email") {
+		t.Fatalf("unverified sign-in: %q, want a refusal", msg)
+	}
+
+	if n := countLoginEvents(t, db, sam.ID, models.LoginEventSucceeded); n != 0 {
+		t.Errorf("recorded %d successful sign-ins, want none", n)
+	}
+	if n := countLoginEvents(t, db, sam.ID, models.LoginEventRefused); n != 1 {
+		t.Errorf("recorded %d refused sign-ins, want 1", n)
+	}
+
+	// The refusal did not wipe the failures, so one more guess locks the account
+	if msg := login(t, c, sam.Email, "wrong"); !strings.Contains(msg, "temporarily locked") {
+		t.Errorf("third wrong password: %q, want the account locked", msg)
+	}
+}
+
+func TestUnlockUserFollowsMemberships(t *testing.T) {
+	c, resolver := newServer(t, 1)
+	seedDeals(t, resolver, 0)
+	db := resolver.DB.WithContext(tenant.WithoutScope(context.Background()))
+
+	other := models.Organisation{OrganisationName: "Other Realty"}
+	if err := db.Create(&other).Error; err != nil {
+		t.Fatalf("seed organisation: %v", err)
+	}
+
+	// Sam belongs to both organisations but last acted in the other one
+	sam := seedMember(t, resolver, "sam@example.com", "correct-horse")
+	if err := db.Create(&models.Membership{UserID: sam.ID, OrganisationID: other.ID, Role: models.RoleAgent}).Error; err != nil {
+		t.Fatalf("seed membership: %v", err)
+	}
+	if err := db.Model(sam).Update("organisation_id", other.ID).Error; err != nil {
+		t.Fatalf("switch organisation: %v", err)
+	}
+
+	// Olive left for the other organisation, though their user still points here
+	orgID := uint(1)
+	olive := models.User{Email: "olive@example.com", Password: "correct-horse", Role: models.RoleAgent, OrganisationID: &orgID}
+	if err := db.Create(&olive).Error; err != nil {
+		t.Fatalf("seed user: %v", err)
+	}
+	if err := db.Create(&models.Membership{UserID: olive.ID, OrganisationID: other.ID, Role: models.RoleAgent}).Error; err != nil {
+		t.Fatalf("seed membership: %v", err)
+	}
+
+	if err := db.Model(&models.User{}).Where("id IN ?", []uint{sam.ID, olive.ID}).Update("locked_until", time.Now().Add(time.Hour)).Error; err != nil {
+		t.Fatalf("lock users: %v", err)
+	}
+
+	if _, errs := post(t, c, `mutation($id: ID!) { unlockUser(userId: $id) }`, client.Var("id", sam.ID)); len(errs) > 0 {
+		t.Errorf("unlocking a member acting elsewhere: %v", errs)
+	}
+	if _, errs := post(t, c, `mutation($id: ID!) { unlockUser(userId: $id) }`, client.Var("id", olive.ID)); len(errs) == 0 || errs[0].Message != "user not found" {
+		t.Errorf("unlocking someone outside the organisation: %v, want user not found", errs)
+	}
+
+	var lockedIDs []uint
+	if err := db.Model(&models.User{}).Where("locked_until IS NOT NULL").Pluck("id", &lockedIDs).Error; err != nil {
+		t.Fatalf("load locked users: %v", err)
+	}
+	if len(lockedIDs) != 1 || lockedIDs[0] != olive.ID {
+		t.Errorf("users %v are still locked, want only %d", lockedIDs, olive.ID)
+	}
+}
@@ -0,0 +1,41 @@
+package resolvers_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/99designs/gqlgen/client"
+)
+
+func TestMeetingCalendarIgnoresTheClientsOffset(t *testing.T) {
+	c, resolver := newServer(t, 1)
+	seedDeals(t, resolver, 1)
+
+	at := time.Now().Add(24 * time.Hour).Truncate(time.Second)
+	_, errs := post(t, c, `mutation($at: DateTime!) { createMeeting(input: {dealId: "1", title: "Viewing", datetime: $at}) { id } }`,
+		client.Var("at", at.In(awayFromLocal(5)).Format(time.RFC3339)))
+	if len(errs) > 0 {
+		t.Fatalf("create meeting: %v", errs)
+	}
+
+	for _, tc := range []struct {
+		from, to time.Time
+		want     int
+	}{
+		{at.Add(-time.Minute), at.Add(time.Minute), 1},
+		{at, at.Add(time.Hour), 1},
+		{at.Add(time.Minute), at.Add(time.Hour), 0},
+		{at.Add(-time.Hour), at, 0},
+	} {
+		away := awayFromLocal(-7)
+		data, errs := post(t, c, `query($from: DateTime, $to: DateTime) { meetings(from: $from, to: $to) { id } }`,
+			client.Var("from", tc.from.In(away).Format(time.RFC3339)),
+			client.Var("to", tc.to.In(away).Format(time.RFC3339)))
+		if len(errs) > 0 {
+			t.Fatalf("meetings: %v", errs)
+		}
+		if got := len(data["meetings"].([]interface{})); got != tc.want {
+			t.Errorf("meetings from %s to %s: got %d, want %d", tc.from.Format(time.RFC3339), tc.to.Format(time.RFC3339), got, tc.want)
+		}
+	}
+}
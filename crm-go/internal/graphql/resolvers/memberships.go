@@ -0,0 +1,160 @@
+package resolvers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"crmgo/internal/models"
+	"crmgo/internal/tenant"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// errNotMember is returned when a user acts in an organisation they do not
+// belong to
+var errNotMember = errors.New("you are not a member of this organisation")
+
+// errNoOrganisation is returned for users who have not created or joined an
+// organisation yet
+var errNoOrganisation = errors.New("user does not belong to an organisation")
+
+// findMembership returns the user's membership of the organisation, or nil
+// if they do not belong to it
+func findMembership(db *gorm.DB, userID, orgID uint) (*models.Membership, error) {
+	var membership models.Membership
+	err := db.Where("user_id = ? AND organisation_id = ?", userID, orgID).First(&membership).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &membership, nil
+}
+
+// checkMembership makes sure the user can act in the organisation and
+// returns their membership of it
+func checkMembership(db *gorm.DB, userID, orgID uint) (*models.Membership, error) {
+	membership, err := findMembership(db, userID, orgID)
+	if err != nil {
+		return nil, err
+	}
+	if membership == nil {
+		return nil, errNotMember
+	}
+	if !membership.IsActive() {
+		return nil, errAccountDeactivated
+	}
+	return membership, nil
+}
+
+// addMembership makes the user a member of the organisation with the given
+// role. Someone rejoining an organisation they left gets their membership
+// back, active and with the new role.
+func addMembership(tx *gorm.DB, userID, orgID uint, role models.Role) error {
+	membership := models.Membership{UserID: userID, OrganisationID: orgID, Role: role}
+	return tx.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "user_id"}, {Name: "organisation_id"}},
+		DoUpdates: clause.Assignments(map[string]interface{}{"role": role, "deactivated_at": nil}),
+	}).Create(&membership).Error
+}
+
+// actIn loads what user needs to act in an organisation they are an active
+// member of: the organisation, their role there and their team member
+// profile. It only changes the user in memory.
+func (r *Resolver) actIn(ctx context.Context, user *models.User, orgID uint) error {
+	membership, err := checkMembership(r.db(ctx), user.ID, orgID)
+	if err != nil {
+		return err
+	}
+
+	var organisation models.Organisation
+	if err := r.db(ctx).First(&organisation, orgID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return errNotMember
+		}
+		return err
+	}
+
+	teamMember, err := findUserTeamMember(r.db(tenant.WithOrganisation(ctx, orgID)), user.ID, orgID)
+	if err != nil {
+		return err
+	}
+
+	user.OrganisationID = &organisation.ID
+	user.Organisation = &organisation
+	user.Role = membership.Role
+	user.TeamMember = teamMember
+	return nil
+}
+
+// loadUserProfile reloads user acting in their default organisation. A user
+// whose default organisation has gone or deactivated them is moved to the
+// most recently joined organisation they are still active in, and one left
+// with none is refused.
+func (r *Resolver) loadUserProfile(ctx context.Context, user *models.User) error {
+	if err := r.db(ctx).First(user, user.ID).Error; err != nil {
+		return err
+	}
+
+	var defaultErr error
+	if user.OrganisationID != nil {
+		defaultErr = r.actIn(ctx, user, *user.OrganisationID)
+		if defaultErr == nil || (!errors.Is(defaultErr, errNotMember) && !errors.Is(defaultErr, errAccountDeactivated)) {
+			return defaultErr
+		}
+	}
+
+	var membership models.Membership
+	err := r.db(ctx).
+		Joins("JOIN organisations ON organisations.id = memberships.organisation_id AND organisations.deleted_at IS NULL").
+		Where("memberships.user_id = ? AND memberships.deactivated_at IS NULL", user.ID).
+		Order("memberships.created_at DESC").
+		First(&membership).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		if errors.Is(defaultErr, errAccountDeactivated) {
+			return defaultErr
+		}
+		user.OrganisationID = nil
+		user.Organisation = nil
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	if err := r.setDefaultOrganisation(r.db(ctx), user.ID, &membership); err != nil {
+		return err
+	}
+	return r.actIn(ctx, user, membership.OrganisationID)
+}
+
+// setDefaultOrganisation makes the organisation of membership the one the
+// user acts in when they next sign in
+func (r *Resolver) setDefaultOrganisation(tx *gorm.DB, userID uint, membership *models.Membership) error {
+	return tx.Model(&models.User{}).Where("id = ?", userID).Updates(map[string]interface{}{
+		"organisation_id": membership.OrganisationID,
+		"role":            membership.Role,
+	}).Error
+}
+
+// myMemberships returns the memberships the caller can act in, with their
+// organisations, oldest first
+func (r *Resolver) myMemberships(ctx context.Context) ([]*models.Membership, error) {
+	userID, err := currentUserID(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var memberships []*models.Membership
+	if err := r.db(ctx).
+		Joins("Organisation").
+		Where("memberships.user_id = ? AND memberships.deactivated_at IS NULL", userID).
+		Order("memberships.created_at ASC, memberships.id ASC").
+		Find(&memberships).Error; err != nil {
+		return nil, fmt.Errorf("failed to fetch organisations: %v", err)
+	}
+	return memberships, nil
+}
@@ -0,0 +1,166 @@
+package resolvers_test
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/99designs/gqlgen/client"
+
+	"crmgo/internal/auth"
+	"crmgo/internal/models"
+	"crmgo/internal/tenant"
+)
+
+// tokenClaims returns the claims of an access token
+func tokenClaims(t *testing.T, tokens *auth.Tokens, token string) *auth.Claims {
+	t.Helper()
+
+	claims, err := tokens.Verify(token)
+	if err != nil {
+		t.Fatalf("verify token: %v", err)
+	}
+	return claims
+}
+
+// dealNames returns the names of the deals the caller of options can see
+func dealNames(t *testing.T, c *client.Client, options ...client.Option) string {
+	t.Helper()
+
+	data, errs := post(t, c, `query { deals { name } }`, options...)
+	if len(errs) > 0 {
+		t.Fatalf("deals: %v", errs)
+	}
+	var names []string
+	for _, deal := range data["deals"].([]interface{}) {
+		names = append(names, deal.(map[string]interface{})["name"].(string))
+	}
+	return strings.Join(names, ",")
+}
+
+func TestSwitchingOrganisation(t *testing.T) {
+	_, resolver := newServer(t, 0)
+	seedDeals(t, resolver, 1)
+	authenticator := withSessions(resolver)
+	c := tokenClient(resolver, authenticator)
+	db := resolver.DB.WithContext(tenant.WithoutScope(context.Background()))
+
+	// Sam is an agent in Acme, an admin in Other Realty, deactivated in
+	// Former Realty and not a member of Stranger Realty
+	sam := seedMember(t, resolver, "sam@example.com", "correct-horse")
+	organisations := map[string]*models.Organisation{}
+	for _, name := range []string{"Other Realty", "Former Realty", "Stranger Realty"} {
+		organisation := models.Organisation{OrganisationName: name}
+		if err := db.Create(&organisation).Error; err != nil {
+			t.Fatalf("seed organisation: %v", err)
+		}
+		organisations[name] = &organisation
+	}
+	deactivatedAt := time.Now()
+	for _, membership := range []models.Membership{
+		{UserID: sam.ID, OrganisationID: organisations["Other Realty"].ID, Role: models.RoleAdmin},
+		{UserID: sam.ID, OrganisationID: organisations["Former Realty"].ID, Role: models.RoleAdmin, DeactivatedAt: &deactivatedAt},
+	} {
+		if err := db.Create(&membership).Error; err != nil {
+			t.Fatalf("seed membership: %v", err)
+		}
+	}
+	for name, organisation := range organisations {
+		if err := db.Create(&models.Deal{Name: name + " deal", OrganisationID: organisation.ID}).Error; err != nil {
+			t.Fatalf("seed deal: %v", err)
+		}
+	}
+	otherID := fmt.Sprint(organisations["Other Realty"].ID)
+
+	token, refreshToken := signIn(t, c, sam.Email, "correct-horse")
+	if claims := tokenClaims(t, resolver.Tokens, token); claims.OrganisationID == nil || *claims.OrganisationID != 1 || claims.Role != models.RoleAgent {
+		t.Fatalf("signed in with claims %+v, want an agent of organisation 1", claims)
+	}
+
+	current := func(token string) map[string]bool {
+		t.Helper()
+		data, errs := post(t, c, `query { myOrganisations { organisationId current } }`, bearer(token))
+		if len(errs) > 0 {
+			t.Fatalf("my organisations: %v", errs)
+		}
+		memberships := map[string]bool{}
+		for _, membership := range data["myOrganisations"].([]interface{}) {
+			membership := membership.(map[string]interface{})
+			memberships[membership["organisationId"].(string)] = membership["current"].(bool)
+		}
+		return memberships
+	}
+	if got := current(token); len(got) != 2 || !got["1"] || got[otherID] {
+		t.Errorf("organisations before switching %v, want 1 current and %s", got, otherID)
+	}
+
+	data, errs := post(t, c, `mutation($id: ID!) { switchOrganisation(id: $id) { token refreshToken user { organisationId role } } }`,
+		bearer(token), client.Var("id", otherID))
+	if len(errs) > 0 {
+		t.Fatalf("switch organisation: %v", errs)
+	}
+	result := data["switchOrganisation"].(map[string]interface{})
+	switched := result["token"].(string)
+	claims := tokenClaims(t, resolver.Tokens, switched)
+	if claims.OrganisationID == nil || fmt.Sprint(*claims.OrganisationID) != otherID || claims.Role != models.RoleAdmin {
+		t.Errorf("switched with claims %+v, want an admin of organisation %s", claims, otherID)
+	}
+	if claims.ID != tokenClaims(t, resolver.Tokens, token).ID {
+		t.Error("switching started a new session")
+	}
+	if user := result["user"].(map[string]interface{}); user["organisationId"] != otherID || user["role"] != "ADMIN" {
+		t.Errorf("switched user %v, want an admin of organisation %s", user, otherID)
+	}
+
+	// Reads and roles follow the organisation switched to
+	if got := dealNames(t, c, bearer(switched)); got != "Other Realty deal" {
+		t.Errorf("deals after switching: %s, want only Other Realty's", got)
+	}
+	if got := dealNames(t, c, bearer(token)); got != "Deal 0" {
+		t.Errorf("deals with the token from before switching: %s, want only Acme's", got)
+	}
+	if got := current(switched); !got[otherID] || got["1"] {
+		t.Errorf("organisations after switching %v, want %s current", got, otherID)
+	}
+	setRequirement := `mutation { setTwoFactorRequirement(required: false) { id } }`
+	if _, errs := post(t, c, setRequirement, bearer(switched)); len(errs) > 0 {
+		t.Errorf("admin-only mutation after switching: %v", errs)
+	}
+	if _, errs := post(t, c, setRequirement, bearer(token)); !accessDenied(errs) {
+		t.Errorf("admin-only mutation as an agent of Acme: %v, want access denied", errs)
+	}
+
+	// Refreshing keeps acting where the session switched to
+	refreshed, refreshToken, errs := refresh(t, c, refreshToken)
+	if len(errs) > 0 {
+		t.Fatalf("refresh: %v", errs)
+	}
+	if claims := tokenClaims(t, resolver.Tokens, refreshed); claims.OrganisationID == nil || fmt.Sprint(*claims.OrganisationID) != otherID {
+		t.Errorf("refreshed with claims %+v, want organisation %s", claims, otherID)
+	}
+
+	// Organisations sam cannot act in are refused, and leave the session
+	// where it was
+	for name, want := range map[string]string{"Stranger Realty": "organisation not found", "Former Realty": "deactivated"} {
+		_, errs := post(t, c, `mutation($id: ID!) { switchOrganisation(id: $id) { token } }`,
+			bearer(refreshed), client.Var("id", fmt.Sprint(organisations[name].ID)))
+		if len(errs) == 0 || !strings.Contains(errs[0].Message, want) {
+			t.Errorf("switching to %s: %v, want %q", name, errs, want)
+		}
+	}
+	refreshed, _, errs = refresh(t, c, refreshToken)
+	if len(errs) > 0 {
+		t.Fatalf("refresh after refused switches: %v", errs)
+	}
+	if got := dealNames(t, c, bearer(refreshed)); got != "Other Realty deal" {
+		t.Errorf("deals after refused switches: %s, want only Other Realty's", got)
+	}
+
+	// API keys stay in the organisation they were made in
+	key, _ := createAPIKey(t, c, []string{"READ", "WRITE"}, bearer(refreshed))
+	if _, errs := post(t, c, `mutation { switchOrganisation(id: "1") { token } }`, withAPIKey(key)); len(errs) == 0 || !strings.Contains(errs[0].Message, "signed-in session") {
+		t.Errorf("switching with an API key: %v, want a refusal", errs)
+	}
+}
@@ -0,0 +1,331 @@
+package resolvers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	models1 "crmgo/internal/graphql/models"
+	"crmgo/internal/models"
+	"crmgo/internal/tenant"
+
+	"github.com/99designs/gqlgen/graphql"
+	"github.com/vektah/gqlparser/v2/ast"
+	"gorm.io/gorm"
+)
+
+// errOrganisationPendingDeletion is returned to members of an organisation
+// that has been scheduled for deletion
+var errOrganisationPendingDeletion = errors.New("this organisation has been deleted, only its owner can restore it")
+
+// currencyCode matches ISO 4217 currency codes
+var currencyCode = regexp.MustCompile(`^[A-Z]{3}$`)
+
+// languageTag matches the common shapes of BCP 47 language tags: a language,
+// optionally followed by a script and a region, such as en, en-GB or zh-Hant-TW
+var languageTag = regexp.MustCompile(`^[a-z]{2,3}(-[A-Z][a-z]{3})?(-([A-Z]{2}|[0-9]{3}))?$`)
+
+// deletionGateFields are the operations members may still use while their
+// organisation is scheduled for deletion
+var deletionGateFields = map[string]bool{
+	"__typename":          true,
+	"__schema":            true,
+	"__type":              true,
+	"health":              true,
+	"me":                  true,
+	"organisations":       true,
+	"organisation":        true,
+	"logout":              true,
+	"logoutAllSessions":   true,
+	"refreshToken":        true,
+	"restoreOrganisation": true,
+	"myOrganisations":     true,
+	"switchOrganisation":  true,
+}
+
+// OrganisationDeletionGate is a gqlgen operation middleware that shuts
+// members out of an organisation scheduled for deletion, leaving only what
+// its owner needs to restore it
+func (r *Resolver) OrganisationDeletionGate(ctx context.Context, next graphql.OperationHandler) graphql.ResponseHandler {
+	if !r.organisationPendingDeletion(ctx) {
+		return next(ctx)
+	}
+
+	for _, selection := range graphql.GetOperationContext(ctx).Operation.SelectionSet {
+		field, ok := selection.(*ast.Field)
+		if !ok || !deletionGateFields[field.Name] {
+			return graphql.OneShot(graphql.ErrorResponse(ctx, errOrganisationPendingDeletion.Error()))
+		}
+	}
+	return next(ctx)
+}
+
+// organisationPendingDeletion reports whether the caller's organisation has
+// been scheduled for deletion
+func (r *Resolver) organisationPendingDeletion(ctx context.Context) bool {
+	if _, err := currentUserID(ctx); err != nil {
+		return false
+	}
+	orgID, err := r.currentOrganisationID(ctx)
+	if err != nil {
+		return false
+	}
+
+	var organisation models.Organisation
+	if err := r.db(ctx).Select("id", "deletion_scheduled_at").First(&organisation, orgID).Error; err != nil {
+		return false
+	}
+	return organisation.IsPendingDeletion()
+}
+
+// currentOrganisation loads the organisation the caller is acting in
+func (r *Resolver) currentOrganisation(ctx context.Context) (*models.Organisation, error) {
+	orgID, err := r.currentOrganisationID(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var organisation models.Organisation
+	if err := r.db(ctx).First(&organisation, orgID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, fmt.Errorf("organisation not found")
+		}
+		return nil, err
+	}
+
+	return &organisation, nil
+}
+
+// findOrganisation loads an organisation by ID. Callers only ever see the
+// organisation they are acting in; any other is reported as not found.
+func (r *Resolver) findOrganisation(ctx context.Context, id string) (*models.Organisation, error) {
+	organisationID, err := stringToID(id)
+	if err != nil {
+		return nil, fmt.Errorf("invalid organisation ID")
+	}
+
+	orgID, err := r.currentOrganisationID(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if organisationID != orgID {
+		return nil, fmt.Errorf("organisation not found")
+	}
+
+	return r.currentOrganisation(ctx)
+}
+
+// applyOrganisationSettings validates the settings in input and sets them on
+// organisation, leaving out any the input does not mention
+func applyOrganisationSettings(organisation *models.Organisation, input models1.UpdateOrganisationSettingsInput) error {
+	if input.DefaultCurrency != nil {
+		currency := strings.ToUpper(strings.TrimSpace(*input.DefaultCurrency))
+		if !currencyCode.MatchString(currency) {
+			return fmt.Errorf("%q is not an ISO 4217 currency code", *input.DefaultCurrency)
+		}
+		organisation.DefaultCurrency = currency
+	}
+
+	if input.TimeZone != nil {
+		zone := strings.TrimSpace(*input.TimeZone)
+		if _, err := time.LoadLocation(zone); err != nil || zone == "" || zone == "Local" {
+			return fmt.Errorf("%q is not a known time zone", *input.TimeZone)
+		}
+		organisation.TimeZone = zone
+	}
+
+	if input.Locale != nil {
+		locale := strings.TrimSpace(*input.Locale)
+		if !languageTag.MatchString(locale) {
+			return fmt.Errorf("%q is not a valid locale", *input.Locale)
+		}
+		organisation.Locale = locale
+	}
+
+	if input.BusinessHours != nil {
+		hours, err := parseBusinessHours(input.BusinessHours)
+		if err != nil {
+			return err
+		}
+		organisation.BusinessHours = hours
+	}
+
+	if input.DealStages != nil {
+		stages, err := parseDealStages(input.DealStages)
+		if err != nil {
+			return err
+		}
+		organisation.DealStages = stages
+	}
+
+	return nil
+}
+
+// parseBusinessHours checks opening hours and returns them in weekday order.
+// Each day may appear once and must close after it opens.
+func parseBusinessHours(input []*models1.BusinessHoursInput) ([]models.BusinessHours, error) {
+	seen := make(map[models.Weekday]bool)
+	hours := make([]models.BusinessHours, 0, len(input))
+	for _, day := range input {
+		if seen[day.Day] {
+			return nil, fmt.Errorf("business hours for %s are given more than once", day.Day)
+		}
+		seen[day.Day] = true
+
+		opens, err := time.Parse("15:04", day.Opens)
+		if err != nil {
+			return nil, fmt.Errorf("opening time %q on %s must be HH:MM", day.Opens, day.Day)
+		}
+		closes, err := time.Parse("15:04", day.Closes)
+		if err != nil {
+			return nil, fmt.Errorf("closing time %q on %s must be HH:MM", day.Closes, day.Day)
+		}
+		if !closes.After(opens) {
+			return nil, fmt.Errorf("on %s the business must close after it opens", day.Day)
+		}
+
+		hours = append(hours, models.BusinessHours{Day: day.Day, Opens: day.Opens, Closes: day.Closes})
+	}
+
+	order := make(map[models.Weekday]int)
+	for i, day := range models.Weekdays {
+		order[day] = i
+	}
+	sort.Slice(hours, func(i, j int) bool { return order[hours[i].Day] < order[hours[j].Day] })
+
+	return hours, nil
+}
+
+// parseDealStages checks a deal pipeline: stage names must be unique, and
+// deals need at least one open stage to start in
+func parseDealStages(input []*models1.DealStageInput) ([]models.DealStage, error) {
+	seen := make(map[string]bool)
+	stages := make([]models.DealStage, 0, len(input))
+	open := false
+	for _, stage := range input {
+		name := strings.TrimSpace(stage.Name)
+		if name == "" {
+			return nil, fmt.Errorf("deal stage name is required")
+		}
+		if seen[strings.ToLower(name)] {
+			return nil, fmt.Errorf("deal stage %q is given more than once", name)
+		}
+		seen[strings.ToLower(name)] = true
+
+		closed := stage.Closed != nil && *stage.Closed
+		if !closed {
+			open = true
+		}
+		stages = append(stages, models.DealStage{Name: name, Closed: closed})
+	}
+
+	if !open {
+		return nil, fmt.Errorf("the deal pipeline needs at least one open stage")
+	}
+	return stages, nil
+}
+
+// dealStatus returns the stage of the organisation's deal pipeline called
+// status, spelled as the pipeline spells it
+func dealStatus(organisation *models.Organisation, status string) (string, error) {
+	stage, ok := organisation.DealStage(strings.TrimSpace(status))
+	if !ok {
+		return "", fmt.Errorf("deal status %q is not a stage of the organisation's deal pipeline", status)
+	}
+	return stage.Name, nil
+}
+
+// scheduleOrganisationDeletion deletes an organisation once the grace period
+// has passed. Its members lose access straight away; the owner can restore
+// it until then.
+func (r *Resolver) scheduleOrganisationDeletion(ctx context.Context, organisation *models.Organisation) error {
+	if organisation.IsPendingDeletion() {
+		return fmt.Errorf("organisation is already scheduled for deletion")
+	}
+
+	deleteAt := time.Now().Add(r.Config.OrganisationDeletionGrace)
+	if err := r.db(ctx).Model(organisation).Update("deletion_scheduled_at", deleteAt).Error; err != nil {
+		return fmt.Errorf("failed to delete organisation: %v", err)
+	}
+
+	return nil
+}
+
+// restoreOrganisation cancels the scheduled deletion of an organisation
+func (r *Resolver) restoreOrganisation(ctx context.Context, organisation *models.Organisation) error {
+	if !organisation.IsPendingDeletion() {
+		return fmt.Errorf("organisation is not scheduled for deletion")
+	}
+	if !time.Now().Before(*organisation.DeletionScheduledAt) {
+		return fmt.Errorf("the grace period has passed and the organisation can no longer be restored")
+	}
+
+	if err := r.db(ctx).Model(organisation).Update("deletion_scheduled_at", nil).Error; err != nil {
+		return fmt.Errorf("failed to restore organisation: %v", err)
+	}
+
+	return nil
+}
+
+// PurgeDeletedOrganisations soft-deletes the organisations whose grace
+// period has passed. Their members lose their membership and their sessions
+// in it; those who acted in it by default are left to pick another
+// organisation they belong to at their next sign-in. The organisation's
+// records are kept but can no longer be reached. It returns how many
+// organisations were deleted.
+func (r *Resolver) PurgeDeletedOrganisations(ctx context.Context) (int, error) {
+	ctx = tenant.WithoutScope(ctx)
+
+	var organisations []models.Organisation
+	if err := r.db(ctx).Where("deletion_scheduled_at <= ?", time.Now()).Find(&organisations).Error; err != nil {
+		return 0, err
+	}
+
+	for _, organisation := range organisations {
+		if err := r.purgeOrganisation(ctx, &organisation); err != nil {
+			return 0, fmt.Errorf("organisation %d: %v", organisation.ID, err)
+		}
+		log.Printf("Deleted organisation %d (%s) after its grace period", organisation.ID, organisation.OrganisationName)
+	}
+
+	return len(organisations), nil
+}
+
+// purgeOrganisation soft-deletes one organisation and detaches its members
+func (r *Resolver) purgeOrganisation(ctx context.Context, organisation *models.Organisation) error {
+	// Start DB transaction
+	tx := r.db(ctx).Begin()
+	defer func() {
+		if r := recover(); r != nil {
+			tx.Rollback()
+		}
+	}()
+
+	if err := revokeSessions(tx.Where("organisation_id = ?", organisation.ID)); err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	if err := tx.Where("organisation_id = ?", organisation.ID).Delete(&models.Membership{}).Error; err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	if err := tx.Model(&models.User{}).Where("organisation_id = ?", organisation.ID).Update("organisation_id", nil).Error; err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	if err := tx.Delete(organisation).Error; err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	// Commit transaction
+	return tx.Commit().Error
+}
@@ -0,0 +1,167 @@
+package resolvers_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/99designs/gqlgen/client"
+
+	"crmgo/internal/auth"
+	"crmgo/internal/models"
+	"crmgo/internal/tenant"
+)
+
+func pendingDeletion(errs []graphqlError) bool {
+	return len(errs) > 0 && strings.Contains(errs[0].Message, "this organisation has been deleted")
+}
+
+func TestDeletedOrganisationsCanBeRestoredDuringTheGracePeriod(t *testing.T) {
+	owner, resolver := newServer(t, 1)
+	seedDeals(t, resolver, 1)
+	resolver.Config.OrganisationDeletionGrace = 30 * 24 * time.Hour
+	authenticator := withSessions(resolver)
+	c := tokenClient(resolver, authenticator)
+	db := resolver.DB.WithContext(tenant.WithoutScope(context.Background()))
+	document := seedStoredDocument(t, resolver, "Signed contract")
+
+	sam := seedMember(t, resolver, "sam@example.com", "correct-horse")
+	token, _ := signIn(t, c, sam.Email, "correct-horse")
+
+	// Only owners may delete or restore the organisation
+	if _, errs := post(t, owner, `mutation { deleteOrganisation(id: "1") }`); !accessDenied(errs) {
+		t.Fatalf("admin deleting the organisation: %v, want access denied", errs)
+	}
+	setRole(t, resolver, models.RoleOwner)
+	if _, errs := post(t, owner, `mutation { deleteOrganisation(id: "1") }`); len(errs) > 0 {
+		t.Fatalf("delete organisation: %v", errs)
+	}
+	var organisation models.Organisation
+	if err := db.First(&organisation, 1).Error; err != nil {
+		t.Fatalf("load organisation: %v", err)
+	}
+	if organisation.DeletionScheduledAt == nil || organisation.DeletionScheduledAt.Before(time.Now().Add(29*24*time.Hour)) {
+		t.Errorf("deletion scheduled for %v, want after the grace period", organisation.DeletionScheduledAt)
+	}
+	if _, errs := post(t, owner, `mutation { deleteOrganisation(id: "1") }`); !pendingDeletion(errs) {
+		t.Errorf("deleting the organisation twice: %v, want it refused", errs)
+	}
+
+	// Members keep only the fields that let them move on
+	for _, member := range []struct {
+		name    string
+		c       *client.Client
+		options []client.Option
+	}{{"owner", owner, nil}, {"agent", c, []client.Option{bearer(token)}}} {
+		for _, query := range []string{`query { deals { id } }`, `mutation { createContact(input: {name: "Pat"}) { id } }`} {
+			if _, errs := post(t, member.c, query, member.options...); !pendingDeletion(errs) {
+				t.Errorf("%s running %s: %v, want it refused", member.name, query, errs)
+			}
+		}
+		if _, errs := post(t, member.c, `query { me { email } myOrganisations { organisationId } }`, member.options...); len(errs) > 0 {
+			t.Errorf("%s running allowed fields: %v", member.name, errs)
+		}
+	}
+	if rec := download(resolver, authenticator, token, document.ID); rec.Code != http.StatusForbidden {
+		t.Errorf("download from a deleted organisation: %d %s, want 403", rec.Code, rec.Body)
+	}
+	if _, errs := post(t, c, `mutation { restoreOrganisation(id: "1") { id } }`, bearer(token)); !accessDenied(errs) {
+		t.Errorf("agent restoring the organisation: %v, want access denied", errs)
+	}
+
+	if _, errs := post(t, owner, `mutation { restoreOrganisation(id: "1") { id } }`); len(errs) > 0 {
+		t.Fatalf("restore organisation: %v", errs)
+	}
+	if _, errs := post(t, c, `query { deals { id } }`, bearer(token)); len(errs) > 0 {
+		t.Errorf("deals after restoring: %v", errs)
+	}
+	if rec := download(resolver, authenticator, token, document.ID); rec.Code != http.StatusOK {
+		t.Errorf("download after restoring: %d %s", rec.Code, rec.Body)
+	}
+
+	// Once the grace period is over it is too late
+	if _, errs := post(t, owner, `mutation { deleteOrganisation(id: "1") }`); len(errs) > 0 {
+		t.Fatalf("delete organisation again: %v", errs)
+	}
+	if err := db.Model(&models.Organisation{}).Where("id = ?", 1).Update("deletion_scheduled_at", time.Now().Add(-time.Minute)).Error; err != nil {
+		t.Fatalf("end grace period: %v", err)
+	}
+	if _, errs := post(t, owner, `mutation { restoreOrganisation(id: "1") { id } }`); len(errs) == 0 || !strings.Contains(errs[0].Message, "grace period has passed") {
+		t.Errorf("restoring after the grace period: %v, want a refusal", errs)
+	}
+}
+
+func TestPurgingDeletedOrganisations(t *testing.T) {
+	_, resolver := newServer(t, 0)
+	seedDeals(t, resolver, 1)
+	authenticator := withSessions(resolver)
+	c := tokenClient(resolver, authenticator)
+	db := resolver.DB.WithContext(tenant.WithoutScope(context.Background()))
+
+	// Sam also belongs to a second organisation; Pat only to the first
+	other := models.Organisation{OrganisationName: "Other Realty"}
+	if err := db.Create(&other).Error; err != nil {
+		t.Fatalf("seed organisation: %v", err)
+	}
+	sam := seedMember(t, resolver, "sam@example.com", "correct-horse")
+	if err := db.Create(&models.Membership{UserID: sam.ID, OrganisationID: other.ID, Role: models.RoleAdmin}).Error; err != nil {
+		t.Fatalf("seed membership: %v", err)
+	}
+	pat := seedMember(t, resolver, "pat@example.com", "battery-staple")
+	token, refreshToken := signIn(t, c, sam.Email, "correct-horse")
+
+	// Organisations still in their grace period are left alone
+	if err := db.Model(&models.Organisation{}).Where("id = ?", other.ID).Update("deletion_scheduled_at", time.Now().Add(time.Hour)).Error; err != nil {
+		t.Fatalf("schedule deletion: %v", err)
+	}
+	if n, err := resolver.PurgeDeletedOrganisations(context.Background()); err != nil || n != 0 {
+		t.Fatalf("purge during the grace period: %d %v, want nothing purged", n, err)
+	}
+	if err := db.Model(&models.Organisation{}).Where("id = ?", other.ID).Update("deletion_scheduled_at", nil).Error; err != nil {
+		t.Fatalf("restore organisation: %v", err)
+	}
+
+	if err := db.Model(&models.Organisation{}).Where("id = ?", 1).Update("deletion_scheduled_at", time.Now().Add(-time.Minute)).Error; err != nil {
+		t.Fatalf("schedule deletion: %v", err)
+	}
+	if n, err := resolver.PurgeDeletedOrganisations(context.Background()); err != nil || n != 1 {
+		t.Fatalf("purge: %d %v, want 1 organisation purged", n, err)
+	}
+
+	if err := db.First(&models.Organisation{}, 1).Error; err == nil {
+		t.Error("purged organisation can still be loaded")
+	}
+	if err := authenticate(authenticator, "Bearer "+token); !errors.Is(err, auth.ErrSessionRevoked) {
+		t.Errorf("session in the purged organisation: %v, want it revoked", err)
+	}
+	if _, _, errs := refresh(t, c, refreshToken); !refreshRefused(errs) {
+		t.Errorf("refreshing a session in the purged organisation: %v, want a refusal", errs)
+	}
+	var memberships, defaults int64
+	db.Model(&models.Membership{}).Where("organisation_id = ?", 1).Count(&memberships)
+	db.Model(&models.User{}).Where("organisation_id = ?", 1).Count(&defaults)
+	if memberships != 0 || defaults != 0 {
+		t.Errorf("%d memberships and %d users still in the purged organisation, want none", memberships, defaults)
+	}
+
+	// Members move on to another organisation they belong to, if they have one
+	signInTo := func(email, password string) map[string]interface{} {
+		t.Helper()
+		data, errs := post(t, c, `mutation($input: LoginInput!) { login(input: $input) { nextStep user { organisationId role } } }`,
+			client.Var("input", map[string]interface{}{"email": email, "password": password}))
+		if len(errs) > 0 {
+			t.Fatalf("login as %s: %v", email, errs)
+		}
+		return data["login"].(map[string]interface{})
+	}
+	if result := signInTo(sam.Email, "correct-horse"); result["user"].(map[string]interface{})["organisationId"] != "2" ||
+		result["user"].(map[string]interface{})["role"] != "ADMIN" {
+		t.Errorf("sam signed in to %v, want their other organisation as an admin", result["user"])
+	}
+	if result := signInTo(pat.Email, "battery-staple"); result["user"].(map[string]interface{})["organisationId"] != nil || result["nextStep"] != "create-organization" {
+		t.Errorf("pat signed in with %v, want no organisation", result)
+	}
+}
@@ -4,44 +4,178 @@ package resolvers
 //
 // It serves as dependency injection for your app, add any dependencies you require here.
 import (
+	"context"
+	"crmgo/internal/auth"
+	"crmgo/internal/config"
 	"crmgo/internal/models"
+	"crmgo/internal/oidc"
+	"crmgo/internal/services"
+	"crmgo/internal/storage"
+	"crmgo/internal/tenant"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"strings"
 	"time"
 
-	"github.com/golang-jwt/jwt/v5"
+	"github.com/99designs/gqlgen/graphql"
 	"gorm.io/gorm"
 )
 
 // Resolver is the root resolver for GraphQL queries and mutations
 type Resolver struct {
-	DB        *gorm.DB
-	JWTSecret string
+	DB           *gorm.DB
+	JWTSecret    string
+	Tokens       *auth.Tokens
+	Config       *config.Config
+	EmailService *services.EmailService
+	Storage      storage.BlobStore
+	SSO          *oidc.Provider // Nil unless single sign-on is configured
 }
 
-// NewResolver creates a new resolver with the provided database connection
-func NewResolver(db *gorm.DB, jwtSecret string) *Resolver {
-	return &Resolver{
-		DB:        db,
-		JWTSecret: jwtSecret,
+// NewResolver creates a new resolver with the provided database connection,
+// configuration, email service, document blob store and access token issuer
+func NewResolver(db *gorm.DB, cfg *config.Config, emailService *services.EmailService, blobStore storage.BlobStore, tokens *auth.Tokens) *Resolver {
+	r := &Resolver{
+		DB:           db,
+		JWTSecret:    cfg.JWTSecret,
+		Tokens:       tokens,
+		Config:       cfg,
+		EmailService: emailService,
+		Storage:      blobStore,
 	}
+
+	if cfg.OIDCIssuerURL != "" {
+		r.SSO = oidc.NewProvider(oidc.Config{
+			IssuerURL:    cfg.OIDCIssuerURL,
+			ClientID:     cfg.OIDCClientID,
+			ClientSecret: cfg.OIDCClientSecret,
+			RedirectURL:  cfg.OIDCRedirectURL,
+		}, nil)
+	}
+
+	return r
+}
+
+// db returns a database handle bound to ctx, so that tenant-owned models are
+// scoped to the organisation the request is acting in
+func (r *Resolver) db(ctx context.Context) *gorm.DB {
+	return r.DB.WithContext(ctx)
 }
 
-func (r *Resolver) generateToken(user *models.User) (string, error) {
-    claims := jwt.MapClaims{
-        "id":    user.ID,
-        "email": user.Email,
-        "role":  user.Role,
-        "exp":   time.Now().Add(time.Hour * 24 * 7).Unix(), // 7 days
-    }
+// TenantScope is a gqlgen operation middleware that scopes every resolver of
+// an operation to the caller's organisation
+func (r *Resolver) TenantScope(ctx context.Context, next graphql.OperationHandler) graphql.ResponseHandler {
+	return next(r.withTenant(ctx))
+}
 
-    if user.OrganisationID != nil {
-        claims["organisation_id"] = *user.OrganisationID
-    }
+// withTenant returns ctx scoped to the caller's organisation. Anonymous
+// callers and users without an organisation get ctx back unchanged, so any
+// tenant-owned query they attempt fails instead of running unscoped.
+func (r *Resolver) withTenant(ctx context.Context) context.Context {
+	if _, ok := tenant.OrganisationID(ctx); ok {
+		return ctx
+	}
+	orgID, err := r.currentOrganisationID(ctx)
+	if err != nil {
+		return ctx
+	}
+	return tenant.WithOrganisation(ctx, orgID)
+}
 
-    token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-    return token.SignedString([]byte(r.JWTSecret))
+// currentUserID returns the authenticated user's ID from the request context
+func currentUserID(ctx context.Context) (uint, error) {
+	principal, ok := auth.FromContext(ctx)
+	if !ok {
+		return 0, fmt.Errorf("unauthorized")
+	}
+	return principal.UserID, nil
 }
 
+// currentOrganisationID returns the organisation the caller is acting in.
+// It prefers the organisation_id claim from the JWT and falls back to the
+// user's default organisation, since tokens issued before onboarding carry
+// no organisation. Either way the user must still be an active member.
+func (r *Resolver) currentOrganisationID(ctx context.Context) (uint, error) {
+	if orgID, ok := tenant.OrganisationID(ctx); ok {
+		return orgID, nil
+	}
 
+	userID, err := currentUserID(ctx)
+	if err != nil {
+		return 0, err
+	}
 
+	var orgID uint
+	if principal, ok := auth.FromContext(ctx); ok && principal.OrganisationID != 0 {
+		orgID = principal.OrganisationID
+	} else {
+		var user models.User
+		if err := r.DB.Select("id", "organisation_id").First(&user, userID).Error; err != nil {
+			return 0, fmt.Errorf("unauthorized")
+		}
+		if user.OrganisationID == nil {
+			return 0, errNoOrganisation
+		}
+		orgID = *user.OrganisationID
+	}
 
+	if _, err := checkMembership(r.DB, userID, orgID); err != nil {
+		return 0, err
+	}
+	return orgID, nil
+}
 
+// checkOrganisationInput rejects client-supplied organisation IDs that do not
+// match the caller's organisation
+func checkOrganisationInput(input *string, orgID uint) error {
+	if input == nil || *input == "" {
+		return nil
+	}
+	id, err := stringToID(*input)
+	if err != nil || id != orgID {
+		return fmt.Errorf("organisation does not match the authenticated user")
+	}
+	return nil
+}
+
+// likeEscaper escapes the wildcard characters of LIKE patterns, for use with
+// ESCAPE '\'
+var likeEscaper = strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`)
+
+// likePattern builds a case-insensitive LIKE pattern for a free-text search,
+// escaping the wildcard characters in the user's input
+func likePattern(query string) string {
+	return "%" + likeEscaper.Replace(strings.ToLower(strings.TrimSpace(query))) + "%"
+}
+
+// prefixPattern builds a case-insensitive LIKE pattern matching text that
+// starts with prefix
+func prefixPattern(prefix string) string {
+	return likeEscaper.Replace(strings.ToLower(prefix)) + "%"
+}
+
+// generateSecureToken returns a hex-encoded cryptographically random token
+func generateSecureToken(numBytes int) (string, error) {
+	b := make([]byte, numBytes)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// storedTime returns t in local time, the zone GORM stores times in. SQLite
+// compares times as text, so a time from the client must be in that zone
+// before it is saved or compared with stored times.
+func storedTime(t time.Time) time.Time {
+	return t.Local()
+}
+
+// optionalStoredTime is storedTime for an optional time
+func optionalStoredTime(t *time.Time) *time.Time {
+	if t == nil {
+		return nil
+	}
+	local := storedTime(*t)
+	return &local
+}
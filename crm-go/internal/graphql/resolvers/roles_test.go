@@ -0,0 +1,146 @@
+package resolvers_test
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/99designs/gqlgen/client"
+
+	"crmgo/internal/graphql/resolvers"
+	"crmgo/internal/models"
+	"crmgo/internal/tenant"
+)
+
+// setRole gives user 1 role in their organisation, as an owner changing it
+// would
+func setRole(t *testing.T, resolver *resolvers.Resolver, role models.Role) {
+	t.Helper()
+
+	db := resolver.DB.WithContext(tenant.WithoutScope(context.Background()))
+	if err := db.Model(&models.Membership{}).Where("user_id = ?", 1).Update("role", role).Error; err != nil {
+		t.Fatalf("set role %s: %v", role, err)
+	}
+}
+
+func TestHasRoleFollowsTheCurrentRole(t *testing.T) {
+	c, resolver := newServer(t, 1)
+	seedDeals(t, resolver, 1)
+
+	operations := []struct {
+		name    string
+		query   string
+		allowed []models.Role
+	}{
+		{"list deals", `{ deals { id } }`, models.Roles},
+		{"create contact", `mutation { createContact(input: {name: "Sam"}) { id } }`, []models.Role{models.RoleOwner, models.RoleAdmin, models.RoleAgent}},
+		{"invite team member", `mutation { inviteTeamMember(input: {teamMemberName: "Ann", teamMemberEmailId: "ann+%s@example.com"}) { id } }`, []models.Role{models.RoleOwner, models.RoleAdmin}},
+		{"rename organisation", `mutation { updateOrganisation(id: "1", input: {organisationName: "Acme Homes"}) { id } }`, []models.Role{models.RoleOwner}},
+	}
+
+	// Roles are read on every request, so each change applies at once
+	for _, role := range models.Roles {
+		setRole(t, resolver, role)
+
+		for _, op := range operations {
+			query := op.query
+			if strings.Contains(query, "%s") {
+				query = fmt.Sprintf(query, role)
+			}
+
+			_, errs := post(t, c, query)
+			if allowed := role.In(op.allowed...); accessDenied(errs) == allowed {
+				t.Errorf("%s as %s: errors %v, want allowed %v", op.name, role, errs, allowed)
+			}
+		}
+	}
+}
+
+func TestInvitationsCannotGrantOwnership(t *testing.T) {
+	c, resolver := newServer(t, 1)
+	seedDeals(t, resolver, 0)
+
+	invite := func(email, role string) []graphqlError {
+		t.Helper()
+
+		input := fmt.Sprintf(`{teamMemberName: "Ann", teamMemberEmailId: %q`, email)
+		if role != "" {
+			input += ", role: " + role
+		}
+		_, errs := post(t, c, `mutation { inviteTeamMember(input: `+input+`}) { id } }`)
+		return errs
+	}
+
+	errs := invite("owner@example.com", "OWNER")
+	if len(errs) == 0 || !strings.Contains(errs[0].Message, "owner role cannot be assigned") {
+		t.Errorf("inviting an owner: %v, want a refusal", errs)
+	}
+
+	if errs := invite("admin@example.com", "ADMIN"); len(errs) > 0 {
+		t.Errorf("inviting an admin: %v", errs)
+	}
+	if errs := invite("agent@example.com", ""); len(errs) > 0 {
+		t.Errorf("inviting without a role: %v", errs)
+	}
+
+	db := resolver.DB.WithContext(tenant.WithoutScope(context.Background()))
+	roles := make(map[string]models.Role)
+	var invitations []models.Invitation
+	if err := db.Find(&invitations).Error; err != nil {
+		t.Fatalf("load invitations: %v", err)
+	}
+	for _, invitation := range invitations {
+		roles[invitation.Email] = invitation.Role
+	}
+	want := map[string]models.Role{"admin@example.com": models.RoleAdmin, "agent@example.com": models.RoleAgent}
+	if fmt.Sprint(roles) != fmt.Sprint(want) {
+		t.Errorf("invitations hold roles %v, want %v", roles, want)
+	}
+}
+
+func TestResendingKeepsTheInvitedRole(t *testing.T) {
+	c, resolver := newServer(t, 1)
+	seedDeals(t, resolver, 0)
+	db := resolver.DB.WithContext(tenant.WithoutScope(context.Background()))
+
+	resend := func(id string) []graphqlError {
+		t.Helper()
+		_, errs := post(t, c, `mutation($id: ID!) { resendInvitation(input: {teamMemberId: $id}) }`, client.Var("id", id))
+		return errs
+	}
+
+	data, errs := post(t, c, `mutation { inviteTeamMember(input: {teamMemberName: "Ann", teamMemberEmailId: "ann@example.com", role: ADMIN}) { id } }`)
+	if len(errs) > 0 {
+		t.Fatalf("invite: %v", errs)
+	}
+	invited := data["inviteTeamMember"].(map[string]interface{})["id"].(string)
+	var before models.Invitation
+	if err := db.Where("email = ?", "ann@example.com").First(&before).Error; err != nil {
+		t.Fatalf("load invitation: %v", err)
+	}
+
+	if errs := resend(invited); len(errs) > 0 {
+		t.Fatalf("resend: %v", errs)
+	}
+	var after models.Invitation
+	if err := db.First(&after, before.ID).Error; err != nil {
+		t.Fatalf("load invitation: %v", err)
+	}
+	if after.Role != models.RoleAdmin || after.TokenHash == before.TokenHash {
+		t.Errorf("resent invitation has role %s and a new token %v, want admin with a new token", after.Role, after.TokenHash != before.TokenHash)
+	}
+
+	// Members added without an invitation have no role to be invited with
+	data, errs = post(t, c, `mutation { createTeamMember(input: {teamMemberName: "Bo", teamMemberEmailId: "bo@example.com"}) { id } }`)
+	if len(errs) > 0 {
+		t.Fatalf("create team member: %v", errs)
+	}
+	if errs := resend(data["createTeamMember"].(map[string]interface{})["id"].(string)); len(errs) == 0 || !strings.Contains(errs[0].Message, "never invited") {
+		t.Errorf("resending to a member never invited: %v, want a refusal", errs)
+	}
+	var count int64
+	if err := db.Model(&models.Invitation{}).Where("email = ?", "bo@example.com").Count(&count).Error; err != nil || count != 0 {
+		t.Errorf("%d invitations for a member never invited (%v), want none", count, err)
+	}
+}
@@ -0,0 +1,38 @@
+package resolvers
+
+import (
+	"github.com/99designs/gqlgen/graphql/handler"
+
+	"crmgo/internal/graphql/generated"
+)
+
+// GraphQLServer builds the GraphQL server with the schema's access
+// directives and the operation middleware every request must pass through.
+// Authentication and data loaders are left to the HTTP handlers around it.
+func (r *Resolver) GraphQLServer() *handler.Server {
+	srv := handler.NewDefaultServer(generated.NewExecutableSchema(generated.Config{
+		Resolvers: r,
+		Directives: generated.DirectiveRoot{
+			Public:  r.Public,
+			Auth:    r.Auth,
+			HasRole: r.HasRole,
+		},
+	}))
+
+	// Refuse root fields that do not declare who may use them
+	srv.AroundFields(r.RequireAccessDirective)
+
+	// Scope every operation's database access to the caller's organisation
+	srv.AroundOperations(r.TenantScope)
+
+	// Hold back members who have yet to set up required two-factor authentication
+	srv.AroundOperations(r.TwoFactorGate)
+
+	// Shut members out of organisations scheduled for deletion
+	srv.AroundOperations(r.OrganisationDeletionGate)
+
+	// Limit requests made with API keys to the keys' scopes
+	srv.AroundOperations(r.APIKeyScopes)
+
+	return srv
+}
@@ -0,0 +1,197 @@
+package resolvers
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"crmgo/internal/auth"
+	models1 "crmgo/internal/graphql/models"
+	"crmgo/internal/models"
+
+	"gorm.io/gorm"
+)
+
+// errInvalidRefreshToken is returned for refresh tokens that are malformed,
+// unknown, expired or revoked
+var errInvalidRefreshToken = errors.New("invalid or expired refresh token")
+
+// generateToken issues a short-lived access token for user, tied to the
+// session with the given JTI
+func (r *Resolver) generateToken(user *models.User, jti string, expiresAt time.Time) (string, error) {
+	claims := auth.Claims{
+		UserID:         user.ID,
+		Email:          user.Email,
+		Role:           user.Role,
+		OrganisationID: user.OrganisationID,
+	}
+	claims.ID = jti
+
+	if user.TeamMember != nil {
+		claims.TeamMemberID = &user.TeamMember.ID
+	}
+
+	return r.Tokens.Issue(claims, expiresAt)
+}
+
+// startSession signs user in on a new session and returns its access and
+// refresh tokens
+func (r *Resolver) startSession(ctx context.Context, user *models.User) (*models1.AuthResult, error) {
+	jti, err := generateSecureToken(16)
+	if err != nil {
+		return nil, err
+	}
+	secret, err := generateSecureToken(32)
+	if err != nil {
+		return nil, err
+	}
+
+	session := models.Session{
+		JTI:              jti,
+		UserID:           user.ID,
+		OrganisationID:   user.OrganisationID,
+		RefreshTokenHash: hashToken(secret),
+		ExpiresAt:        time.Now().Add(r.Config.RefreshTokenTTL),
+	}
+	if err := r.db(ctx).Create(&session).Error; err != nil {
+		return nil, err
+	}
+
+	return r.sessionTokens(user, &session, secret)
+}
+
+// sessionTokens builds the auth result for a session whose refresh token
+// secret has just been issued
+func (r *Resolver) sessionTokens(user *models.User, session *models.Session, secret string) (*models1.AuthResult, error) {
+	expiresAt := time.Now().Add(r.Config.AccessTokenTTL)
+	token, err := r.generateToken(user, session.JTI, expiresAt)
+	if err != nil {
+		return nil, err
+	}
+
+	refreshToken := session.JTI + "." + secret
+	return &models1.AuthResult{
+		Token:        &token,
+		RefreshToken: &refreshToken,
+		ExpiresAt:    &expiresAt,
+		User:         user,
+	}, nil
+}
+
+// rotateSession exchanges a refresh token for a new access token and a new
+// refresh token. Presenting a refresh token that has already been rotated
+// means it was copied, so the whole session is revoked.
+func (r *Resolver) rotateSession(ctx context.Context, refreshToken string) (*models1.AuthResult, error) {
+	jti, secret, ok := strings.Cut(refreshToken, ".")
+	if !ok || jti == "" || secret == "" {
+		return nil, errInvalidRefreshToken
+	}
+
+	var session models.Session
+	if err := r.db(ctx).Where("jti = ?", jti).First(&session).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, errInvalidRefreshToken
+		}
+		return nil, err
+	}
+	if !session.IsActive() {
+		return nil, errInvalidRefreshToken
+	}
+
+	if subtle.ConstantTimeCompare([]byte(hashToken(secret)), []byte(session.RefreshTokenHash)) != 1 {
+		if err := revokeSessions(r.db(ctx).Where("id = ?", session.ID)); err != nil {
+			return nil, err
+		}
+		return nil, errInvalidRefreshToken
+	}
+
+	var user models.User
+	if err := r.db(ctx).First(&user, session.UserID).Error; err != nil {
+		return nil, errInvalidRefreshToken
+	}
+
+	// Keep acting in the session's organisation, for as long as the user is
+	// an active member of it
+	if session.OrganisationID != nil {
+		if err := r.actIn(ctx, &user, *session.OrganisationID); err != nil {
+			if errors.Is(err, errNotMember) || errors.Is(err, errAccountDeactivated) {
+				return nil, errInvalidRefreshToken
+			}
+			return nil, err
+		}
+	} else if err := r.loadUserProfile(ctx, &user); err != nil {
+		if errors.Is(err, errAccountDeactivated) {
+			return nil, errInvalidRefreshToken
+		}
+		return nil, err
+	}
+
+	newSecret, err := generateSecureToken(32)
+	if err != nil {
+		return nil, err
+	}
+
+	// Only the holder of the current refresh token wins a concurrent rotation
+	now := time.Now()
+	result := r.db(ctx).Model(&models.Session{}).
+		Where("id = ? AND refresh_token_hash = ? AND revoked_at IS NULL", session.ID, session.RefreshTokenHash).
+		Updates(map[string]interface{}{
+			"refresh_token_hash": hashToken(newSecret),
+			"expires_at":         now.Add(r.Config.RefreshTokenTTL),
+			"last_used_at":       now,
+			"organisation_id":    user.OrganisationID,
+		})
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	if result.RowsAffected == 0 {
+		return nil, errInvalidRefreshToken
+	}
+
+	return r.sessionTokens(&user, &session, newSecret)
+}
+
+// revokeSessions revokes every active session matched by query
+func revokeSessions(query *gorm.DB) error {
+	return query.Model(&models.Session{}).
+		Where("revoked_at IS NULL").
+		Update("revoked_at", time.Now()).Error
+}
+
+// IsSessionActive reports whether the session with the given JTI exists and
+// has been neither revoked nor allowed to expire. The auth middleware uses it
+// to reject access tokens of signed-out sessions.
+func (r *Resolver) IsSessionActive(ctx context.Context, jti string) bool {
+	if jti == "" {
+		return false
+	}
+
+	var session models.Session
+	if err := r.db(ctx).Select("id", "expires_at", "revoked_at").Where("jti = ?", jti).First(&session).Error; err != nil {
+		return false
+	}
+	return session.IsActive()
+}
+
+// currentSessionID returns the JTI of the session the request's access token
+// belongs to
+func currentSessionID(ctx context.Context) (string, error) {
+	principal, ok := auth.FromContext(ctx)
+	if !ok || principal.SessionID == "" {
+		return "", fmt.Errorf("unauthorized")
+	}
+	return principal.SessionID, nil
+}
+
+// hashToken returns the hex SHA-256 digest of a random token. Tokens are
+// long and random, so a fast unsalted hash is enough to keep them useless to
+// anyone reading the database.
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,215 @@
+package resolvers_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/99designs/gqlgen/client"
+
+	"crmgo/internal/auth"
+	"crmgo/internal/graphql/resolvers"
+	"crmgo/internal/models"
+	"crmgo/internal/tenant"
+)
+
+// withSessions gives sessions started on resolver the application's default
+// lifetimes and returns the authenticator the application puts in front of
+// the GraphQL server
+func withSessions(resolver *resolvers.Resolver) *auth.Authenticator {
+	resolver.Config.AccessTokenTTL = 15 * time.Minute
+	resolver.Config.RefreshTokenTTL = 30 * 24 * time.Hour
+	return auth.NewAuthenticator(resolver.Tokens, resolver.IsSessionActive, resolver.AuthenticateAPIKey)
+}
+
+// tokenClient serves resolver's schema behind authenticator, so requests act
+// as whoever the credentials they send belong to
+func tokenClient(resolver *resolvers.Resolver, authenticator *auth.Authenticator) *client.Client {
+	return client.New(authenticator.Optional(resolver.DataLoaders(resolver.GraphQLServer())))
+}
+
+// bearer sends token as the request's access token
+func bearer(token string) client.Option {
+	return client.AddHeader("Authorization", "Bearer "+token)
+}
+
+// authenticate returns the error the authenticator gives a request sending
+// authorization
+func authenticate(authenticator *auth.Authenticator, authorization string) error {
+	req := httptest.NewRequest(http.MethodPost, "/graphql", nil)
+	req.Header.Set("Authorization", authorization)
+	_, err := authenticator.Authenticate(req)
+	return err
+}
+
+// signIn logs in and returns the session's access and refresh tokens
+func signIn(t *testing.T, c *client.Client, email, password string) (string, string) {
+	t.Helper()
+
+	data, errs := post(t, c, `mutation($input: LoginInput!) { login(input: $input) { token refreshToken } }`,
+		client.Var("input", map[string]interface{}{"email": email, "password": password}))
+	if len(errs) > 0 {
+		t.Fatalf("login as %s: %v", email, errs)
+	}
+	result := data["login"].(map[string]interface{})
+	return result["token"].(string), result["refreshToken"].(string)
+}
+
+// refresh exchanges refreshToken for new tokens
+func refresh(t *testing.T, c *client.Client, refreshToken string) (string, string, []graphqlError) {
+	t.Helper()
+
+	data, errs := post(t, c, `mutation($refreshToken: String!) { refreshToken(refreshToken: $refreshToken) { token refreshToken } }`,
+		client.Var("refreshToken", refreshToken))
+	if len(errs) > 0 {
+		return "", "", errs
+	}
+	result := data["refreshToken"].(map[string]interface{})
+	return result["token"].(string), result["refreshToken"].(string), nil
+}
+
+func refreshRefused(errs []graphqlError) bool {
+	return len(errs) > 0 && strings.Contains(errs[0].Message, "invalid or expired refresh token")
+}
+
+func TestRefreshTokensRotate(t *testing.T) {
+	_, resolver := newServer(t, 0)
+	seedDeals(t, resolver, 0)
+	authenticator := withSessions(resolver)
+	c := tokenClient(resolver, authenticator)
+	sam := seedMember(t, resolver, "sam@example.com", "correct-horse")
+
+	_, first := signIn(t, c, sam.Email, "correct-horse")
+	token, second, errs := refresh(t, c, first)
+	if len(errs) > 0 {
+		t.Fatalf("refresh: %v", errs)
+	}
+	if second == first {
+		t.Fatal("refreshing handed back the same refresh token")
+	}
+	if err := authenticate(authenticator, "Bearer "+token); err != nil {
+		t.Errorf("new access token: %v", err)
+	}
+
+	// Only the digest of the secret is stored
+	db := resolver.DB.WithContext(tenant.WithoutScope(context.Background()))
+	var session models.Session
+	if err := db.Where("user_id = ?", sam.ID).First(&session).Error; err != nil {
+		t.Fatalf("load session: %v", err)
+	}
+	if _, secret, _ := strings.Cut(second, "."); strings.Contains(session.RefreshTokenHash, secret) {
+		t.Error("refresh token stored in the clear")
+	}
+
+	third, _, errs := refresh(t, c, second)
+	if len(errs) > 0 {
+		t.Fatalf("refresh with the rotated token: %v", errs)
+	}
+
+	// Replaying a token that was already exchanged means it leaked, so the
+	// thief and the rightful holder both lose the session
+	if _, _, errs := refresh(t, c, first); !refreshRefused(errs) {
+		t.Fatalf("replayed refresh token: %v, want a refusal", errs)
+	}
+	if err := authenticate(authenticator, "Bearer "+third); !errors.Is(err, auth.ErrSessionRevoked) {
+		t.Errorf("access token after a replay: %v, want the session revoked", err)
+	}
+	if _, _, errs := refresh(t, c, second); !refreshRefused(errs) {
+		t.Errorf("latest refresh token after a replay: %v, want a refusal", errs)
+	}
+
+	for _, token := range []string{"", "no-separator", session.JTI + ".", "unknown.secret"} {
+		if _, _, errs := refresh(t, c, token); !refreshRefused(errs) {
+			t.Errorf("refresh token %q: %v, want a refusal", token, errs)
+		}
+	}
+}
+
+func TestLogoutRevokesAccessTokens(t *testing.T) {
+	_, resolver := newServer(t, 0)
+	seedDeals(t, resolver, 0)
+	authenticator := withSessions(resolver)
+	c := tokenClient(resolver, authenticator)
+	sam := seedMember(t, resolver, "sam@example.com", "correct-horse")
+
+	laptop, laptopRefresh := signIn(t, c, sam.Email, "correct-horse")
+	phone, phoneRefresh := signIn(t, c, sam.Email, "correct-horse")
+	tablet, _ := signIn(t, c, sam.Email, "correct-horse")
+
+	if _, errs := post(t, c, `mutation { logout }`, bearer(laptop)); len(errs) > 0 {
+		t.Fatalf("logout: %v", errs)
+	}
+	if err := authenticate(authenticator, "Bearer "+laptop); !errors.Is(err, auth.ErrSessionRevoked) {
+		t.Errorf("access token of the logged out session: %v, want the session revoked", err)
+	}
+	if _, _, errs := refresh(t, c, laptopRefresh); !refreshRefused(errs) {
+		t.Errorf("refresh token of the logged out session: %v, want a refusal", errs)
+	}
+	if _, errs := post(t, c, `query { me { email } }`, bearer(laptop)); !accessDenied(errs) {
+		t.Errorf("query with the logged out token: %v, want it refused", errs)
+	}
+	if err := authenticate(authenticator, "Bearer "+phone); err != nil {
+		t.Errorf("access token of another session after logout: %v", err)
+	}
+
+	if _, errs := post(t, c, `mutation { logoutAllSessions }`, bearer(phone)); len(errs) > 0 {
+		t.Fatalf("logout all sessions: %v", errs)
+	}
+	for name, token := range map[string]string{"phone": phone, "tablet": tablet} {
+		if err := authenticate(authenticator, "Bearer "+token); !errors.Is(err, auth.ErrSessionRevoked) {
+			t.Errorf("%s's access token after logging out everywhere: %v, want the session revoked", name, err)
+		}
+	}
+	if _, _, errs := refresh(t, c, phoneRefresh); !refreshRefused(errs) {
+		t.Errorf("refresh after logging out everywhere: %v, want a refusal", errs)
+	}
+
+	// Other users keep their sessions
+	jane, _ := signIn(t, c, "jane@example.com", "hash")
+	if _, errs := post(t, c, `mutation { logoutAllSessions }`, bearer(laptop)); !accessDenied(errs) {
+		t.Errorf("logging out everywhere with a revoked token: %v, want it refused", errs)
+	}
+	if err := authenticate(authenticator, "Bearer "+jane); err != nil {
+		t.Errorf("another user's access token: %v", err)
+	}
+}
+
+func TestRefreshStopsWithTheMembership(t *testing.T) {
+	admin, resolver := newServer(t, 1)
+	seedDeals(t, resolver, 0)
+	authenticator := withSessions(resolver)
+	c := tokenClient(resolver, authenticator)
+	db := resolver.DB.WithContext(tenant.WithoutScope(context.Background()))
+
+	sam := seedMember(t, resolver, "sam@example.com", "correct-horse")
+	teamMember := models.TeamMember{OrganisationID: 1, TeamMemberName: "Sam", TeamMemberEmailID: sam.Email, UserID: &sam.ID}
+	if err := db.Create(&teamMember).Error; err != nil {
+		t.Fatalf("seed team member: %v", err)
+	}
+
+	token, refreshToken := signIn(t, c, sam.Email, "correct-horse")
+	if errs := deactivate(t, admin, teamMember.ID, nil); len(errs) > 0 {
+		t.Fatalf("deactivate: %v", errs)
+	}
+	if err := authenticate(authenticator, "Bearer "+token); !errors.Is(err, auth.ErrSessionRevoked) {
+		t.Errorf("access token after deactivation: %v, want the session revoked", err)
+	}
+	if _, _, errs := refresh(t, c, refreshToken); !refreshRefused(errs) {
+		t.Errorf("refresh after deactivation: %v, want a refusal", errs)
+	}
+
+	// A session still open when the membership lapses cannot be refreshed
+	// either
+	pat := seedMember(t, resolver, "pat@example.com", "battery-staple")
+	_, refreshToken = signIn(t, c, pat.Email, "battery-staple")
+	if err := db.Model(&models.Membership{}).Where("user_id = ?", pat.ID).Update("deactivated_at", time.Now()).Error; err != nil {
+		t.Fatalf("deactivate membership: %v", err)
+	}
+	if _, _, errs := refresh(t, c, refreshToken); !refreshRefused(errs) {
+		t.Errorf("refresh with a deactivated membership: %v, want a refusal", errs)
+	}
+}
@@ -0,0 +1,328 @@
+package resolvers
+
+import (
+	"context"
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"crmgo/internal/models"
+	"crmgo/internal/oidc"
+	"crmgo/internal/tenant"
+
+	"github.com/golang-jwt/jwt/v5"
+	"gorm.io/gorm"
+)
+
+// ssoCookieName holds the state of a single sign-on attempt between the
+// redirect to the identity provider and the callback
+const ssoCookieName = "crm_sso"
+
+// ssoCookiePath limits the state cookie to the single sign-on endpoints
+const ssoCookiePath = "/auth/oidc"
+
+// ssoStateTTL is how long a user has to sign in at the identity provider
+const ssoStateTTL = 10 * time.Minute
+
+// ssoStatePurpose tells the signed state cookie apart from other tokens
+// signed with the same secret
+const ssoStatePurpose = "sso_state"
+
+// errSSOFailed is shown to users for failures whose details only belong in the log
+var errSSOFailed = errors.New("single sign-on failed, please try again")
+
+// errSSOExpired is returned when the callback's state is missing or does not match
+var errSSOExpired = errors.New("single sign-on session expired, please try again")
+
+// ssoRefusal is a reason for refusing single sign-on that is safe to show
+// to the user
+type ssoRefusal string
+
+func (e ssoRefusal) Error() string { return string(e) }
+
+// SSOLoginHandler starts single sign-on by sending the browser to the
+// identity provider. The state, nonce and PKCE verifier travel in a signed
+// cookie so that the callback can only be completed by the same browser.
+func (r *Resolver) SSOLoginHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if r.SSO == nil {
+			http.Error(w, `{"error":"Single sign-on is not configured"}`, http.StatusNotFound)
+			return
+		}
+		if req.Method != http.MethodGet {
+			http.Error(w, `{"error":"Method not allowed"}`, http.StatusMethodNotAllowed)
+			return
+		}
+
+		state, err1 := generateSecureToken(16)
+		nonce, err2 := generateSecureToken(16)
+		verifier, err3 := generateSecureToken(32)
+		if err := errors.Join(err1, err2, err3); err != nil {
+			log.Printf("Failed to start single sign-on: %v", err)
+			http.Error(w, `{"error":"Failed to start single sign-on"}`, http.StatusInternalServerError)
+			return
+		}
+
+		authURL, err := r.SSO.AuthCodeURL(req.Context(), state, nonce, oidc.CodeChallenge(verifier))
+		if err != nil {
+			log.Printf("Failed to start single sign-on: %v", err)
+			http.Error(w, `{"error":"Identity provider is unavailable"}`, http.StatusBadGateway)
+			return
+		}
+
+		cookie, err := r.signSSOState(state, nonce, verifier)
+		if err != nil {
+			log.Printf("Failed to start single sign-on: %v", err)
+			http.Error(w, `{"error":"Failed to start single sign-on"}`, http.StatusInternalServerError)
+			return
+		}
+		http.SetCookie(w, r.ssoCookie(cookie, int(ssoStateTTL.Seconds())))
+
+		http.Redirect(w, req, authURL, http.StatusFound)
+	})
+}
+
+// SSOCallbackHandler completes single sign-on. It validates the identity
+// provider's answer, provisions the user if needed and hands the frontend a
+// one-time code to redeem with the completeSsoLogin mutation, so that no
+// tokens appear in URLs.
+func (r *Resolver) SSOCallbackHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if r.SSO == nil {
+			http.Error(w, `{"error":"Single sign-on is not configured"}`, http.StatusNotFound)
+			return
+		}
+
+		// The state is single-use whatever the outcome
+		http.SetCookie(w, r.ssoCookie("", -1))
+
+		query := req.URL.Query()
+		if providerErr := query.Get("error"); providerErr != "" {
+			log.Printf("Identity provider refused single sign-on: %s %s", providerErr, query.Get("error_description"))
+			r.ssoFailed(w, req, errSSOFailed)
+			return
+		}
+
+		cookie, err := req.Cookie(ssoCookieName)
+		if err != nil {
+			r.ssoFailed(w, req, errSSOExpired)
+			return
+		}
+		state, nonce, verifier, err := r.parseSSOState(cookie.Value)
+		if err != nil || subtle.ConstantTimeCompare([]byte(state), []byte(query.Get("state"))) != 1 {
+			r.ssoFailed(w, req, errSSOExpired)
+			return
+		}
+
+		claims, err := r.SSO.Exchange(req.Context(), query.Get("code"), verifier, nonce)
+		if err != nil {
+			log.Printf("Single sign-on failed: %v", err)
+			r.ssoFailed(w, req, errSSOFailed)
+			return
+		}
+
+		user, err := r.provisionSSOUser(req.Context(), claims)
+		if err != nil {
+			log.Printf("Single sign-on refused for %s: %v", claims.Email, err)
+			var refusal ssoRefusal
+			if !errors.As(err, &refusal) {
+				err = errSSOFailed
+			}
+			r.ssoFailed(w, req, err)
+			return
+		}
+
+		code, err := r.issueUserToken(req.Context(), user.ID, models.UserTokenSSOLogin, models.SSOLoginTTL)
+		if err != nil {
+			log.Printf("Single sign-on failed for %s: %v", user.Email, err)
+			r.ssoFailed(w, req, errSSOFailed)
+			return
+		}
+
+		http.Redirect(w, req, r.frontendRedirect("/sso/callback", url.Values{"code": {code}}), http.StatusFound)
+	})
+}
+
+// provisionSSOUser finds the user behind a verified identity, creating them
+// and their team member in the organisation mapped from their email domain
+// on first sign-in
+func (r *Resolver) provisionSSOUser(ctx context.Context, claims *oidc.Claims) (*models.User, error) {
+	email := strings.ToLower(strings.TrimSpace(claims.Email))
+	if email == "" || !claims.EmailVerified {
+		return nil, ssoRefusal("your identity provider did not confirm your email address")
+	}
+
+	_, domain, _ := strings.Cut(email, "@")
+	orgID, ok := r.Config.OIDCDomainOrganisations[domain]
+	if !ok {
+		return nil, ssoRefusal(fmt.Sprintf("no organisation uses single sign-on for %s", domain))
+	}
+	ctx = tenant.WithOrganisation(ctx, orgID)
+	now := time.Now()
+
+	// Start DB transaction
+	tx := r.db(ctx).Begin()
+	defer func() {
+		if r := recover(); r != nil {
+			tx.Rollback()
+		}
+	}()
+
+	var user models.User
+	var identity models.UserIdentity
+	err := tx.Where("issuer = ? AND subject = ?", claims.Issuer, claims.Subject).First(&identity).Error
+	switch {
+	case err == nil:
+		err = tx.First(&user, identity.UserID).Error
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		// First sign-in with this identity: match an existing account by email
+		err = tx.Where("LOWER(email) = ?", email).First(&user).Error
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			user = models.User{
+				Email:           email,
+				Role:            models.RoleAgent,
+				EmailVerified:   true,
+				EmailVerifiedAt: &now,
+			}
+			// The account is only reachable through single sign-on until
+			// the user sets a password through a reset link
+			user.Password, err = generateSecureToken(32)
+			if err == nil {
+				err = tx.Create(&user).Error
+			}
+		}
+		if err == nil {
+			identity = models.UserIdentity{UserID: user.ID, Issuer: claims.Issuer, Subject: claims.Subject}
+			err = tx.Create(&identity).Error
+		}
+	}
+	if err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+
+	// Accounts that belong to other organisations join this one as well
+	membership, err := findMembership(tx, user.ID, orgID)
+	if err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+	if membership == nil {
+		if err := r.joinSSOOrganisation(tx, &user, orgID, claims.Name); err != nil {
+			tx.Rollback()
+			return nil, err
+		}
+	} else if !membership.IsActive() {
+		tx.Rollback()
+		return nil, ssoRefusal(errAccountDeactivated.Error())
+	}
+
+	if err := tx.Model(&identity).Updates(map[string]interface{}{"email": email, "last_login_at": now}).Error; err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+	if err := markEmailVerified(tx, user.ID); err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+
+	// Commit transaction
+	if err := tx.Commit().Error; err != nil {
+		return nil, err
+	}
+
+	return &user, nil
+}
+
+// joinSSOOrganisation adds a user who signed in through single sign-on to
+// their organisation as an agent, with a team member profile. It becomes the
+// organisation they act in unless they already have one.
+func (r *Resolver) joinSSOOrganisation(tx *gorm.DB, user *models.User, orgID uint, name string) error {
+	if name == "" {
+		name, _, _ = strings.Cut(user.Email, "@")
+	}
+
+	if err := addMembership(tx, user.ID, orgID, models.RoleAgent); err != nil {
+		return err
+	}
+
+	if user.OrganisationID == nil {
+		if err := tx.Model(user).Updates(map[string]interface{}{"organisation_id": orgID, "role": models.RoleAgent}).Error; err != nil {
+			return err
+		}
+		user.OrganisationID = &orgID
+		user.Role = models.RoleAgent
+	}
+
+	teamMember := models.TeamMember{
+		OrganisationID:    orgID,
+		TeamMemberName:    name,
+		TeamMemberEmailID: user.Email,
+		UserID:            &user.ID,
+	}
+	return tx.Create(&teamMember).Error
+}
+
+// signSSOState packs a sign-on attempt's secrets into a signed cookie value
+func (r *Resolver) signSSOState(state, nonce, verifier string) (string, error) {
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
+		"purpose":  ssoStatePurpose,
+		"state":    state,
+		"nonce":    nonce,
+		"verifier": verifier,
+		"exp":      time.Now().Add(ssoStateTTL).Unix(),
+	})
+	return token.SignedString([]byte(r.JWTSecret))
+}
+
+// parseSSOState unpacks a cookie value made by signSSOState
+func (r *Resolver) parseSSOState(value string) (state, nonce, verifier string, err error) {
+	claims := jwt.MapClaims{}
+	_, err = jwt.ParseWithClaims(value, claims, func(token *jwt.Token) (interface{}, error) {
+		return []byte(r.JWTSecret), nil
+	}, jwt.WithValidMethods([]string{jwt.SigningMethodHS256.Alg()}))
+	if err != nil {
+		return "", "", "", err
+	}
+
+	if purpose, _ := claims["purpose"].(string); purpose != ssoStatePurpose {
+		return "", "", "", fmt.Errorf("not a single sign-on state")
+	}
+	state, _ = claims["state"].(string)
+	nonce, _ = claims["nonce"].(string)
+	verifier, _ = claims["verifier"].(string)
+	if state == "" || nonce == "" || verifier == "" {
+		return "", "", "", fmt.Errorf("incomplete single sign-on state")
+	}
+	return state, nonce, verifier, nil
+}
+
+// ssoCookie builds the state cookie. It must survive the top-level
+// redirect back from the identity provider, hence SameSite=Lax.
+func (r *Resolver) ssoCookie(value string, maxAge int) *http.Cookie {
+	return &http.Cookie{
+		Name:     ssoCookieName,
+		Value:    value,
+		Path:     ssoCookiePath,
+		MaxAge:   maxAge,
+		HttpOnly: true,
+		Secure:   strings.HasPrefix(r.Config.OIDCRedirectURL, "https://"),
+		SameSite: http.SameSiteLaxMode,
+	}
+}
+
+// ssoFailed sends the browser back to the frontend's sign-in page with an
+// error to show
+func (r *Resolver) ssoFailed(w http.ResponseWriter, req *http.Request, err error) {
+	http.Redirect(w, req, r.frontendRedirect("/login", url.Values{"sso_error": {err.Error()}}), http.StatusFound)
+}
+
+// frontendRedirect builds a link to a frontend page
+func (r *Resolver) frontendRedirect(path string, query url.Values) string {
+	return strings.TrimRight(r.Config.FrontendURL, "/") + path + "?" + query.Encode()
+}
@@ -0,0 +1,225 @@
+package resolvers_test
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/99designs/gqlgen/client"
+	"github.com/golang-jwt/jwt/v5"
+
+	"crmgo/internal/graphql/resolvers"
+	"crmgo/internal/models"
+	"crmgo/internal/oidc"
+	"crmgo/internal/tenant"
+)
+
+// ssoIdP is a minimal OpenID Connect provider that signs in whoever the
+// test says is at the keyboard
+type ssoIdP struct {
+	server *httptest.Server
+	key    *rsa.PrivateKey
+
+	mu     sync.Mutex
+	grants map[string]jwt.MapClaims
+}
+
+// withSSO turns on single sign-on for example.com users of organisation 1
+// against a mock identity provider
+func withSSO(t *testing.T, resolver *resolvers.Resolver) *ssoIdP {
+	t.Helper()
+
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	idp := &ssoIdP{key: key, grants: make(map[string]jwt.MapClaims)}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]string{
+			"issuer":                 idp.server.URL,
+			"authorization_endpoint": idp.server.URL + "/authorize",
+			"token_endpoint":         idp.server.URL + "/token",
+			"jwks_uri":               idp.server.URL + "/jwks",
+		})
+	})
+	mux.HandleFunc("/jwks", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"keys": []map[string]string{{
+				"kty": "RSA",
+				"kid": "key-1",
+				"n":   base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+				"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+			}},
+		})
+	})
+	mux.HandleFunc("/token", func(w http.ResponseWriter, r *http.Request) {
+		idp.mu.Lock()
+		claims, ok := idp.grants[r.PostFormValue("code")]
+		delete(idp.grants, r.PostFormValue("code"))
+		idp.mu.Unlock()
+		if !ok {
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(map[string]string{"error": "invalid_grant"})
+			return
+		}
+
+		token := jwt.NewWithClaims(jwt.SigningMethodRS256, claims)
+		token.Header["kid"] = "key-1"
+		signed, err := token.SignedString(key)
+		if err != nil {
+			t.Errorf("sign ID token: %v", err)
+		}
+		json.NewEncoder(w).Encode(map[string]string{"access_token": "access", "token_type": "Bearer", "id_token": signed})
+	})
+	idp.server = httptest.NewServer(mux)
+	t.Cleanup(idp.server.Close)
+
+	resolver.Config.OIDCIssuerURL = idp.server.URL
+	resolver.Config.OIDCClientID = "crm"
+	resolver.Config.OIDCClientSecret = "client-secret"
+	resolver.Config.OIDCRedirectURL = "http://localhost:3001/auth/oidc/callback"
+	resolver.Config.OIDCDomainOrganisations = map[string]uint{"example.com": 1}
+	resolver.SSO = oidc.NewProvider(oidc.Config{
+		IssuerURL:    idp.server.URL,
+		ClientID:     "crm",
+		ClientSecret: "client-secret",
+		RedirectURL:  resolver.Config.OIDCRedirectURL,
+	}, idp.server.Client())
+
+	return idp
+}
+
+// signIn runs the browser's side of single sign-on as the identity provider
+// user with email. It returns the code for completeSsoLogin, or the error
+// the frontend was sent back with.
+func (idp *ssoIdP) signIn(t *testing.T, resolver *resolvers.Resolver, email string) (code, ssoError string) {
+	t.Helper()
+
+	start := httptest.NewRecorder()
+	resolver.SSOLoginHandler().ServeHTTP(start, httptest.NewRequest(http.MethodGet, "/auth/oidc/login", nil))
+	authURL, err := url.Parse(start.Header().Get("Location"))
+	if err != nil || start.Code != http.StatusFound {
+		t.Fatalf("start single sign-on: %d %s", start.Code, start.Body)
+	}
+
+	// The user signs in at the identity provider, which redirects back
+	query := authURL.Query()
+	now := time.Now()
+	idp.mu.Lock()
+	idp.grants["code-"+query.Get("state")] = jwt.MapClaims{
+		"iss":            idp.server.URL,
+		"sub":            "user-" + email,
+		"aud":            "crm",
+		"iat":            now.Unix(),
+		"exp":            now.Add(5 * time.Minute).Unix(),
+		"nonce":          query.Get("nonce"),
+		"email":          email,
+		"email_verified": true,
+		"name":           "Sam Agent",
+	}
+	idp.mu.Unlock()
+
+	callback := httptest.NewRequest(http.MethodGet, "/auth/oidc/callback?"+url.Values{
+		"code":  {"code-" + query.Get("state")},
+		"state": {query.Get("state")},
+	}.Encode(), nil)
+	for _, cookie := range start.Result().Cookies() {
+		callback.AddCookie(cookie)
+	}
+	done := httptest.NewRecorder()
+	resolver.SSOCallbackHandler().ServeHTTP(done, callback)
+
+	redirect, err := url.Parse(done.Header().Get("Location"))
+	if err != nil || done.Code != http.StatusFound {
+		t.Fatalf("complete single sign-on: %d %s", done.Code, done.Body)
+	}
+	return redirect.Query().Get("code"), redirect.Query().Get("sso_error")
+}
+
+func TestSSOProvisionsUsersByLowercasedEmail(t *testing.T) {
+	c, resolver := newServer(t, 0)
+	seedDeals(t, resolver, 0)
+	idp := withSSO(t, resolver)
+	db := resolver.DB.WithContext(tenant.WithoutScope(context.Background()))
+
+	completeLogin := func(code string) map[string]interface{} {
+		t.Helper()
+		data, errs := post(t, c, `mutation($code: String!) { completeSsoLogin(code: $code) { token user { id email } } }`, client.Var("code", code))
+		if len(errs) > 0 {
+			t.Fatalf("complete sign-in: %v", errs)
+		}
+		return data["completeSsoLogin"].(map[string]interface{})
+	}
+
+	// An existing account is matched whatever the case the provider uses
+	code, ssoError := idp.signIn(t, resolver, " Jane@Example.COM")
+	if ssoError != "" {
+		t.Fatalf("existing user: %s", ssoError)
+	}
+	if result := completeLogin(code); result["token"] == nil || result["user"].(map[string]interface{})["id"] != "1" {
+		t.Errorf("existing user signed in as %v, want user 1 with a session", result)
+	}
+
+	// A new user joins the organisation mapped from their domain
+	code, ssoError = idp.signIn(t, resolver, "Sam.Agent@EXAMPLE.com")
+	if ssoError != "" {
+		t.Fatalf("new user: %s", ssoError)
+	}
+	result := completeLogin(code)
+	if email := result["user"].(map[string]interface{})["email"]; email != "sam.agent@example.com" {
+		t.Errorf("new user provisioned as %v, want sam.agent@example.com", email)
+	}
+
+	var users, teamMembers int64
+	db.Model(&models.User{}).Where("email LIKE ?", "%@example.com").Count(&users)
+	db.Model(&models.TeamMember{}).Where("team_member_email_id = ? AND organisation_id = ?", "sam.agent@example.com", 1).Count(&teamMembers)
+	if users != 2 || teamMembers != 1 {
+		t.Errorf("after signing in: %d users and %d team members for the new user, want 2 users and 1 team member", users, teamMembers)
+	}
+
+	// Domains no organisation claims are refused
+	if _, ssoError := idp.signIn(t, resolver, "sam@elsewhere.com"); ssoError == "" {
+		t.Error("an unmapped domain was signed in")
+	}
+}
+
+func TestSSOSignInStillAsksForTheSecondFactor(t *testing.T) {
+	c, resolver := newServer(t, 0)
+	seedDeals(t, resolver, 0)
+	idp := withSSO(t, resolver)
+	db := resolver.DB.WithContext(tenant.WithoutScope(context.Background()))
+	if err := db.Model(&models.User{}).Where("id = ?", 1).Updates(map[string]interface{}{"two_factor_enabled": true, "two_factor_secret": "JBSWY3DPEHPK3PXP"}).Error; err != nil {
+		t.Fatalf("enable two-factor: %v", err)
+	}
+
+	code, ssoError := idp.signIn(t, resolver, "jane@example.com")
+	if ssoError != "" {
+		t.Fatalf("sign in: %s", ssoError)
+	}
+	data, errs := post(t, c, `mutation($code: String!) { completeSsoLogin(code: $code) { token refreshToken twoFactorRequired challengeToken } }`, client.Var("code", code))
+	if len(errs) > 0 {
+		t.Fatalf("complete sign-in: %v", errs)
+	}
+
+	result := data["completeSsoLogin"].(map[string]interface{})
+	if result["token"] != nil || result["refreshToken"] != nil {
+		t.Errorf("single sign-on handed out a session without the second factor: %v", result)
+	}
+	if result["twoFactorRequired"] != true || result["challengeToken"] == nil {
+		t.Errorf("completeSsoLogin returned %v, want a two-factor challenge", result)
+	}
+	if n := countLoginEvents(t, db, 1, models.LoginEventSucceeded); n != 0 {
+		t.Errorf("recorded %d successful sign-ins before the second factor, want none", n)
+	}
+}
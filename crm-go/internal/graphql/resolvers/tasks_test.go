@@ -0,0 +1,53 @@
+package resolvers_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/99designs/gqlgen/client"
+)
+
+// awayFromLocal returns a zone hours ahead of local time, so a time written
+// in it reads differently from the same time stored in local time
+func awayFromLocal(hours int) *time.Location {
+	_, offset := time.Now().Zone()
+	return time.FixedZone("away", offset+hours*3600)
+}
+
+func TestTaskDueDateFiltersIgnoreTheClientsOffset(t *testing.T) {
+	c, resolver := newServer(t, 1)
+	seedDeals(t, resolver, 1)
+
+	due := time.Now().Add(48 * time.Hour).Truncate(time.Second)
+	_, errs := post(t, c, `mutation($due: DateTime) { createTask(input: {title: "Call the buyer", dealId: "1", dueDate: $due}) { id } }`,
+		client.Var("due", due.In(awayFromLocal(5)).Format(time.RFC3339)))
+	if len(errs) > 0 {
+		t.Fatalf("create task: %v", errs)
+	}
+
+	count := func(args string, at time.Time) int {
+		t.Helper()
+
+		data, errs := post(t, c, `query($at: DateTime) { tasks(`+args+`: $at) { id } }`,
+			client.Var("at", at.In(awayFromLocal(-7)).Format(time.RFC3339)))
+		if len(errs) > 0 {
+			t.Fatalf("tasks(%s): %v", args, errs)
+		}
+		return len(data["tasks"].([]interface{}))
+	}
+
+	for _, tc := range []struct {
+		args string
+		at   time.Time
+		want int
+	}{
+		{"dueAfter", due.Add(-time.Minute), 1},
+		{"dueAfter", due.Add(time.Minute), 0},
+		{"dueBefore", due.Add(time.Minute), 1},
+		{"dueBefore", due.Add(-time.Minute), 0},
+	} {
+		if got := count(tc.args, tc.at); got != tc.want {
+			t.Errorf("tasks(%s: %s) returned %d tasks, want %d", tc.args, tc.at.Format(time.RFC3339), got, tc.want)
+		}
+	}
+}
@@ -0,0 +1,219 @@
+package resolvers
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"crmgo/internal/models"
+
+	"gorm.io/gorm"
+)
+
+// findActiveTeamMember loads a team member who can still be assigned work
+func (r *Resolver) findActiveTeamMember(ctx context.Context, id string) (*models.TeamMember, error) {
+	teamMember, err := r.findTeamMember(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if !teamMember.IsActive() {
+		return nil, fmt.Errorf("team member %s has been deactivated", teamMember.TeamMemberName)
+	}
+	return teamMember, nil
+}
+
+// assignedWork is work in the hands of a team member, with the column that
+// assigns it to them
+type assignedWork struct {
+	query  *gorm.DB
+	column string
+}
+
+// openWork returns the deals, tasks and upcoming meetings still in the hands
+// of a team member. Deals are open until they reach one of closedStages.
+func openWork(tx *gorm.DB, teamMemberID uint, closedStages []string, now time.Time) []assignedWork {
+	deals := tx.Model(&models.Deal{}).Where("assigned_to = ?", teamMemberID)
+	if len(closedStages) > 0 {
+		deals = deals.Where("status NOT IN ?", closedStages)
+	}
+
+	return []assignedWork{
+		{deals, "assigned_to"},
+		{tx.Model(&models.Task{}).Where("assigned_to = ? AND status NOT IN ?", teamMemberID, []string{models.TaskStatusDone, models.TaskStatusCancelled}), "assigned_to"},
+		{tx.Model(&models.Meeting{}).Where("team_member_id = ? AND status <> ? AND datetime >= ?", teamMemberID, models.MeetingStatusCancelled, now), "team_member_id"},
+	}
+}
+
+// deactivateTeamMember deactivates a team member who has left and hands
+// their open work to reassignTo in one transaction. Their linked user can no
+// longer act in the organisation, and their sessions in it are revoked; any
+// other organisations they belong to are unaffected. Finished work keeps
+// pointing at them so the history stays attributed.
+func (r *Resolver) deactivateTeamMember(ctx context.Context, id string, reassignTo *string) (*models.TeamMember, error) {
+	userID, err := currentUserID(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	teamMember, err := r.findTeamMember(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if !teamMember.IsActive() {
+		return nil, fmt.Errorf("team member is already deactivated")
+	}
+
+	if teamMember.UserID != nil {
+		if *teamMember.UserID == userID {
+			return nil, fmt.Errorf("you cannot deactivate yourself")
+		}
+
+		membership, err := findMembership(r.db(ctx), *teamMember.UserID, teamMember.OrganisationID)
+		if err != nil {
+			return nil, err
+		}
+		if membership != nil && membership.Role == models.RoleOwner {
+			return nil, fmt.Errorf("the organisation owner cannot be deactivated")
+		}
+	}
+
+	var assignee *models.TeamMember
+	if reassignTo != nil && *reassignTo != "" {
+		assignee, err = r.findActiveTeamMember(ctx, *reassignTo)
+		if err != nil {
+			return nil, fmt.Errorf("reassign to: %v", err)
+		}
+		if assignee.ID == teamMember.ID {
+			return nil, fmt.Errorf("open work cannot be reassigned to the member being deactivated")
+		}
+	}
+
+	organisation, err := r.currentOrganisation(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+
+	// Start DB transaction
+	tx := r.db(ctx).Begin()
+	defer func() {
+		if r := recover(); r != nil {
+			tx.Rollback()
+		}
+	}()
+
+	// Claim the deactivation first so two concurrent requests cannot both
+	// reassign the same work
+	result := tx.Model(&models.TeamMember{}).
+		Where("id = ? AND deactivated_at IS NULL", teamMember.ID).
+		Update("deactivated_at", now)
+	if result.Error != nil {
+		tx.Rollback()
+		return nil, fmt.Errorf("failed to deactivate team member: %v", result.Error)
+	}
+	if result.RowsAffected == 0 {
+		tx.Rollback()
+		return nil, fmt.Errorf("team member is already deactivated")
+	}
+
+	// Hand over open deals, tasks and upcoming meetings
+	for _, work := range openWork(tx, teamMember.ID, organisation.ClosedDealStages(), now) {
+		if assignee == nil {
+			var count int64
+			if err := work.query.Count(&count).Error; err != nil {
+				tx.Rollback()
+				return nil, err
+			}
+			if count > 0 {
+				tx.Rollback()
+				return nil, fmt.Errorf("%s still has open deals, tasks or meetings, choose a team member to reassign them to", teamMember.TeamMemberName)
+			}
+			continue
+		}
+
+		if err := work.query.Update(work.column, assignee.ID).Error; err != nil {
+			tx.Rollback()
+			return nil, fmt.Errorf("failed to reassign open work: %v", err)
+		}
+	}
+
+	// Shut the linked user out of the organisation and end the sessions they
+	// still have in it
+	if teamMember.UserID != nil {
+		if err := tx.Model(&models.Membership{}).
+			Where("user_id = ? AND organisation_id = ?", *teamMember.UserID, teamMember.OrganisationID).
+			Update("deactivated_at", now).Error; err != nil {
+			tx.Rollback()
+			return nil, fmt.Errorf("failed to deactivate user: %v", err)
+		}
+		if err := revokeSessions(tx.Where("user_id = ? AND organisation_id = ?", *teamMember.UserID, teamMember.OrganisationID)); err != nil {
+			tx.Rollback()
+			return nil, err
+		}
+	}
+
+	// Commit transaction
+	if err := tx.Commit().Error; err != nil {
+		return nil, fmt.Errorf("failed to commit transaction: %v", err)
+	}
+
+	teamMember.DeactivatedAt = &now
+	return teamMember, nil
+}
+
+// reactivateTeamMember lets a deactivated team member sign in and be
+// assigned work again. Work reassigned when they left stays reassigned.
+func (r *Resolver) reactivateTeamMember(ctx context.Context, id string) (*models.TeamMember, error) {
+	teamMember, err := r.findTeamMember(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if teamMember.IsActive() {
+		return nil, fmt.Errorf("team member is not deactivated")
+	}
+
+	// Start DB transaction
+	tx := r.db(ctx).Begin()
+	defer func() {
+		if r := recover(); r != nil {
+			tx.Rollback()
+		}
+	}()
+
+	if err := tx.Model(teamMember).Update("deactivated_at", nil).Error; err != nil {
+		tx.Rollback()
+		return nil, fmt.Errorf("failed to reactivate team member: %v", err)
+	}
+
+	if teamMember.UserID != nil {
+		if err := tx.Model(&models.Membership{}).
+			Where("user_id = ? AND organisation_id = ?", *teamMember.UserID, teamMember.OrganisationID).
+			Update("deactivated_at", nil).Error; err != nil {
+			tx.Rollback()
+			return nil, fmt.Errorf("failed to reactivate user: %v", err)
+		}
+	}
+
+	// Commit transaction
+	if err := tx.Commit().Error; err != nil {
+		return nil, fmt.Errorf("failed to commit transaction: %v", err)
+	}
+
+	teamMember.DeactivatedAt = nil
+	return teamMember, nil
+}
+
+// findAssignee loads the team member work is being assigned to. Only active
+// members can be given new work, but work may stay with the deactivated
+// member it is already assigned to, so finished work can still be edited.
+func (r *Resolver) findAssignee(ctx context.Context, id string, current *uint) (*models.TeamMember, error) {
+	teamMember, err := r.findTeamMember(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if !teamMember.IsActive() && (current == nil || *current != teamMember.ID) {
+		return nil, fmt.Errorf("team member %s has been deactivated", teamMember.TeamMemberName)
+	}
+	return teamMember, nil
+}
@@ -0,0 +1,230 @@
+package resolvers_test
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/99designs/gqlgen/client"
+
+	"crmgo/internal/graphql/resolvers"
+	"crmgo/internal/models"
+	"crmgo/internal/tenant"
+)
+
+// leaver is a team member about to leave, with work both open and finished
+type leaver struct {
+	user       *models.User
+	teamMember models.TeamMember
+
+	openDeal, wonDeal            models.Deal
+	openTask, doneTask           models.Task
+	upcomingMeeting, pastMeeting models.Meeting
+	cancelledMeeting             models.Meeting
+}
+
+// seedLeaver adds sam@example.com to user 1's organisation and gives them
+// deals, tasks and meetings
+func seedLeaver(t *testing.T, resolver *resolvers.Resolver) *leaver {
+	t.Helper()
+
+	db := resolver.DB.WithContext(tenant.WithoutScope(context.Background()))
+	create := func(value interface{}) {
+		if err := db.Create(value).Error; err != nil {
+			t.Fatalf("seed %T: %v", value, err)
+		}
+	}
+
+	l := &leaver{user: seedMember(t, resolver, "sam@example.com", "correct-horse")}
+	l.teamMember = models.TeamMember{OrganisationID: 1, TeamMemberName: "Sam", TeamMemberEmailID: l.user.Email, UserID: &l.user.ID}
+	create(&l.teamMember)
+
+	id := &l.teamMember.ID
+	l.openDeal = models.Deal{Name: "Open deal", OrganisationID: 1, AssignedTo: id, Status: "Negotiation"}
+	l.wonDeal = models.Deal{Name: "Won deal", OrganisationID: 1, AssignedTo: id, Status: models.DealStatusWon}
+	create(&l.openDeal)
+	create(&l.wonDeal)
+
+	l.openTask = models.Task{Title: "Open task", DealID: &l.openDeal.ID, AssignedTo: id}
+	l.doneTask = models.Task{Title: "Done task", DealID: &l.wonDeal.ID, AssignedTo: id, Status: models.TaskStatusDone}
+	create(&l.openTask)
+	create(&l.doneTask)
+
+	l.upcomingMeeting = models.Meeting{Datetime: time.Now().Add(24 * time.Hour), DealID: &l.openDeal.ID, TeamMemberID: id}
+	l.pastMeeting = models.Meeting{Datetime: time.Now().Add(-24 * time.Hour), DealID: &l.wonDeal.ID, TeamMemberID: id}
+	l.cancelledMeeting = models.Meeting{Datetime: time.Now().Add(48 * time.Hour), DealID: &l.openDeal.ID, TeamMemberID: id, Status: models.MeetingStatusCancelled}
+	create(&l.upcomingMeeting)
+	create(&l.pastMeeting)
+	create(&l.cancelledMeeting)
+
+	return l
+}
+
+// assignedTo returns the team member a deal, task or meeting is assigned to
+func assignedTo(t *testing.T, resolver *resolvers.Resolver, record interface{}, id uint) uint {
+	t.Helper()
+
+	db := resolver.DB.WithContext(tenant.WithoutScope(context.Background()))
+	column := "assigned_to"
+	if _, ok := record.(*models.Meeting); ok {
+		column = "team_member_id"
+	}
+	var teamMemberID uint
+	if err := db.Model(record).Where("id = ?", id).Select(column).Scan(&teamMemberID).Error; err != nil {
+		t.Fatalf("load %T %d: %v", record, id, err)
+	}
+	return teamMemberID
+}
+
+func deactivate(t *testing.T, c *client.Client, id uint, reassignTo *uint) []graphqlError {
+	t.Helper()
+
+	options := []client.Option{client.Var("id", fmt.Sprint(id))}
+	if reassignTo != nil {
+		options = append(options, client.Var("reassignTo", fmt.Sprint(*reassignTo)))
+	}
+	_, errs := post(t, c, `mutation($id: ID!, $reassignTo: ID) { deactivateTeamMember(id: $id, reassignTo: $reassignTo) { id deactivatedAt } }`, options...)
+	return errs
+}
+
+func TestDeactivatingRequiresAHomeForOpenWork(t *testing.T) {
+	c, resolver := newServer(t, 1)
+	seedDeals(t, resolver, 0)
+	sam := seedLeaver(t, resolver)
+	db := resolver.DB.WithContext(tenant.WithoutScope(context.Background()))
+
+	errs := deactivate(t, c, sam.teamMember.ID, nil)
+	if len(errs) == 0 || !strings.Contains(errs[0].Message, "still has open deals, tasks or meetings") {
+		t.Fatalf("deactivating without reassigning: %v, want a refusal", errs)
+	}
+
+	// The refusal rolled back the whole deactivation
+	var teamMember models.TeamMember
+	if err := db.First(&teamMember, sam.teamMember.ID).Error; err != nil {
+		t.Fatalf("load team member: %v", err)
+	}
+	if !teamMember.IsActive() {
+		t.Error("the refused deactivation was kept")
+	}
+	if msg := login(t, c, sam.user.Email, "correct-horse"); msg != "" {
+		t.Errorf("sign-in after the refused deactivation: %q", msg)
+	}
+
+	// Once the open work is finished no reassignment is needed
+	finished := []struct {
+		record interface{}
+		status string
+	}{
+		{&sam.openDeal, models.DealStatusLost},
+		{&sam.openTask, models.TaskStatusCancelled},
+		{&sam.upcomingMeeting, models.MeetingStatusCancelled},
+	}
+	for _, f := range finished {
+		if err := db.Model(f.record).Update("status", f.status).Error; err != nil {
+			t.Fatalf("finish %T: %v", f.record, err)
+		}
+	}
+	if errs := deactivate(t, c, sam.teamMember.ID, nil); len(errs) > 0 {
+		t.Errorf("deactivating without open work: %v", errs)
+	}
+}
+
+func TestDeactivatingReassignsOnlyOpenWork(t *testing.T) {
+	c, resolver := newServer(t, 1)
+	seedDeals(t, resolver, 0)
+	sam := seedLeaver(t, resolver)
+	db := resolver.DB.WithContext(tenant.WithoutScope(context.Background()))
+	successor := uint(1) // Agent 0
+
+	if errs := deactivate(t, c, sam.teamMember.ID, &successor); len(errs) > 0 {
+		t.Fatalf("deactivate: %v", errs)
+	}
+
+	records := []struct {
+		name   string
+		record interface{}
+		id     uint
+		want   uint
+	}{
+		{"open deal", &models.Deal{}, sam.openDeal.ID, successor},
+		{"won deal", &models.Deal{}, sam.wonDeal.ID, sam.teamMember.ID},
+		{"open task", &models.Task{}, sam.openTask.ID, successor},
+		{"done task", &models.Task{}, sam.doneTask.ID, sam.teamMember.ID},
+		{"upcoming meeting", &models.Meeting{}, sam.upcomingMeeting.ID, successor},
+		{"past meeting", &models.Meeting{}, sam.pastMeeting.ID, sam.teamMember.ID},
+		{"cancelled meeting", &models.Meeting{}, sam.cancelledMeeting.ID, sam.teamMember.ID},
+	}
+	for _, r := range records {
+		if got := assignedTo(t, resolver, r.record, r.id); got != r.want {
+			t.Errorf("%s is assigned to %d, want %d", r.name, got, r.want)
+		}
+	}
+
+	var membership models.Membership
+	if err := db.Where("user_id = ? AND organisation_id = ?", sam.user.ID, 1).First(&membership).Error; err != nil {
+		t.Fatalf("load membership: %v", err)
+	}
+	if membership.IsActive() {
+		t.Error("the linked user's membership is still active")
+	}
+
+	// Deactivated members cannot be handed work either
+	if errs := deactivate(t, c, successor, &sam.teamMember.ID); len(errs) == 0 || !strings.Contains(errs[0].Message, "has been deactivated") {
+		t.Errorf("reassigning to a deactivated member: %v, want a refusal", errs)
+	}
+}
+
+func TestDeactivatedMembersCannotSignIn(t *testing.T) {
+	c, resolver := newServer(t, 1)
+	seedDeals(t, resolver, 0)
+	sam := seedLeaver(t, resolver)
+	successor := uint(1)
+
+	if msg := login(t, c, sam.user.Email, "correct-horse"); msg != "" {
+		t.Fatalf("sign-in before leaving: %q", msg)
+	}
+	if errs := deactivate(t, c, sam.teamMember.ID, &successor); len(errs) > 0 {
+		t.Fatalf("deactivate: %v", errs)
+	}
+	if msg := login(t, c, sam.user.Email, "correct-horse"); !strings.Contains(msg, "deactivated") {
+		t.Errorf("sign-in after leaving: %q, want a refusal", msg)
+	}
+
+	if _, errs := post(t, c, `mutation($id: ID!) { reactivateTeamMember(id: $id) { id } }`, client.Var("id", fmt.Sprint(sam.teamMember.ID))); len(errs) > 0 {
+		t.Fatalf("reactivate: %v", errs)
+	}
+	if msg := login(t, c, sam.user.Email, "correct-horse"); msg != "" {
+		t.Errorf("sign-in after coming back: %q", msg)
+	}
+}
+
+func TestOwnersAndYourselfCannotBeDeactivated(t *testing.T) {
+	c, resolver := newServer(t, 1)
+	seedDeals(t, resolver, 0)
+	db := resolver.DB.WithContext(tenant.WithoutScope(context.Background()))
+
+	self := models.TeamMember{OrganisationID: 1, TeamMemberName: "Jane", TeamMemberEmailID: "jane@example.com", UserID: uintPtr(1)}
+	owner := seedMember(t, resolver, "owner@example.com", "correct-horse")
+	if err := db.Model(&models.Membership{}).Where("user_id = ?", owner.ID).Update("role", models.RoleOwner).Error; err != nil {
+		t.Fatalf("make owner: %v", err)
+	}
+	ownerMember := models.TeamMember{OrganisationID: 1, TeamMemberName: "Olive", TeamMemberEmailID: owner.Email, UserID: &owner.ID}
+	for _, teamMember := range []*models.TeamMember{&self, &ownerMember} {
+		if err := db.Create(teamMember).Error; err != nil {
+			t.Fatalf("seed team member: %v", err)
+		}
+	}
+
+	if errs := deactivate(t, c, self.ID, nil); len(errs) == 0 || !strings.Contains(errs[0].Message, "cannot deactivate yourself") {
+		t.Errorf("deactivating yourself: %v, want a refusal", errs)
+	}
+	if errs := deactivate(t, c, ownerMember.ID, nil); len(errs) == 0 || !strings.Contains(errs[0].Message, "owner cannot be deactivated") {
+		t.Errorf("deactivating the owner: %v, want a refusal", errs)
+	}
+}
+
+func uintPtr(v uint) *uint {
+	return &v
+}
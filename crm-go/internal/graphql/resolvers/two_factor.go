@@ -0,0 +1,282 @@
+package resolvers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	models1 "crmgo/internal/graphql/models"
+	"crmgo/internal/models"
+	"crmgo/internal/totp"
+
+	"github.com/99designs/gqlgen/graphql"
+	"github.com/vektah/gqlparser/v2/ast"
+	"gorm.io/gorm"
+)
+
+// twoFactorIssuer names the account in authenticator apps
+const twoFactorIssuer = "CRM Dashboard"
+
+// totpSkew is how many 30 second steps either side of now a code is accepted
+// for, to allow for clock drift on the user's phone
+const totpSkew = 1
+
+// errInvalidTwoFactorCode is returned for wrong, reused or malformed
+// authenticator and recovery codes
+var errInvalidTwoFactorCode = errors.New("invalid two-factor code")
+
+// errInvalidTwoFactorChallenge is returned for sign-in challenges that are
+// unknown, expired or already used
+var errInvalidTwoFactorChallenge = errors.New("sign-in challenge is invalid or has expired, please sign in again")
+
+// twoFactorSetupFields are the operations a member may still use while their
+// organisation requires two-factor authentication and they have not set it up
+var twoFactorSetupFields = map[string]bool{
+	"__typename":                 true,
+	"__schema":                   true,
+	"__type":                     true,
+	"health":                     true,
+	"me":                         true,
+	"logout":                     true,
+	"logoutAllSessions":          true,
+	"refreshToken":               true,
+	"beginTwoFactorEnrollment":   true,
+	"confirmTwoFactorEnrollment": true,
+	"myOrganisations":            true,
+	"switchOrganisation":         true,
+}
+
+// TwoFactorGate is a gqlgen operation middleware that holds back members of
+// organisations requiring two-factor authentication until they have enrolled.
+// They stay signed in so that they can enroll.
+func (r *Resolver) TwoFactorGate(ctx context.Context, next graphql.OperationHandler) graphql.ResponseHandler {
+	userID, err := currentUserID(ctx)
+	if err != nil {
+		return next(ctx)
+	}
+	orgID, err := r.currentOrganisationID(ctx)
+	if err != nil || !r.twoFactorSetupRequired(ctx, userID, orgID) {
+		return next(ctx)
+	}
+
+	for _, selection := range graphql.GetOperationContext(ctx).Operation.SelectionSet {
+		field, ok := selection.(*ast.Field)
+		if !ok || !twoFactorSetupFields[field.Name] {
+			return graphql.OneShot(graphql.ErrorResponse(ctx, "your organisation requires two-factor authentication, please set it up to continue"))
+		}
+	}
+	return next(ctx)
+}
+
+// twoFactorSetupRequired reports whether the user acts in an organisation
+// that requires two-factor authentication but has not enrolled yet
+func (r *Resolver) twoFactorSetupRequired(ctx context.Context, userID, orgID uint) bool {
+	var user models.User
+	if err := r.db(ctx).Select("id", "two_factor_enabled").First(&user, userID).Error; err != nil {
+		return false
+	}
+	if user.TwoFactorEnabled {
+		return false
+	}
+
+	var organisation models.Organisation
+	if err := r.db(ctx).Select("id", "require_two_factor").First(&organisation, orgID).Error; err != nil {
+		return false
+	}
+	return organisation.RequireTwoFactor
+}
+
+// twoFactorChallenge answers a correct password for a user with two-factor
+// authentication by issuing a short-lived challenge instead of a session
+func (r *Resolver) twoFactorChallenge(ctx context.Context, user *models.User) (*models1.AuthResult, error) {
+	challenge, err := r.issueUserToken(ctx, user.ID, models.UserTokenTwoFactorChallenge, models.TwoFactorChallengeTTL)
+	if err != nil {
+		return nil, fmt.Errorf("failed to start two-factor sign-in: %v", err)
+	}
+
+	required := true
+	step := "verify-two-factor"
+	return &models1.AuthResult{
+		User:              user,
+		TwoFactorRequired: &required,
+		ChallengeToken:    &challenge,
+		NextStep:          &step,
+	}, nil
+}
+
+// completeLogin signs user in once every factor has been checked
+func (r *Resolver) completeLogin(ctx context.Context, user *models.User) (*models1.AuthResult, error) {
+	if r.isDeactivated(ctx, user) {
+		return nil, errAccountDeactivated
+	}
+
+	// A refused sign-in neither succeeds nor clears the failures before it
+	if r.mustVerifyEmail(user) {
+		r.recordLoginEvent(ctx, models.LoginEvent{Type: models.LoginEventRefused, Email: user.Email, UserID: &user.ID, Reason: "email not verified"})
+		return nil, fmt.Errorf("please verify your email address before signing in")
+	}
+
+	if err := r.clearFailedLogins(ctx, user); err != nil {
+		return nil, err
+	}
+	r.recordLoginEvent(ctx, models.LoginEvent{Type: models.LoginEventSucceeded, Email: user.Email, UserID: &user.ID})
+
+	// Load related data
+	if err := r.loadUserProfile(ctx, user); err != nil {
+		if errors.Is(err, errAccountDeactivated) {
+			return nil, err
+		}
+		return nil, fmt.Errorf("error loading user data: %v", err)
+	}
+
+	// Start a new session
+	result, err := r.startSession(ctx, user)
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate token: %v", err)
+	}
+
+	// Check if setup is required
+	if user.OrganisationID == nil {
+		required := true
+		step := "create-organization"
+		result.SetupRequired = &required
+		result.NextStep = &step
+	} else if r.twoFactorSetupRequired(ctx, user.ID, *user.OrganisationID) {
+		step := "setup-two-factor"
+		result.NextStep = &step
+	}
+
+	return result, nil
+}
+
+// checkSecondFactor accepts either a current authenticator code or an unused
+// recovery code for user
+func (r *Resolver) checkSecondFactor(ctx context.Context, user *models.User, code string) (bool, error) {
+	if !user.TwoFactorEnabled {
+		return false, nil
+	}
+	if ok, err := r.checkTOTP(ctx, user, code); ok || err != nil {
+		return ok, err
+	}
+	return r.useRecoveryCode(ctx, user.ID, code)
+}
+
+// checkTOTP checks an authenticator code against the user's secret. Each
+// code is accepted only once, so one seen over the user's shoulder cannot be
+// replayed within its window.
+func (r *Resolver) checkTOTP(ctx context.Context, user *models.User, code string) (bool, error) {
+	if user.TwoFactorSecret == "" {
+		return false, nil
+	}
+
+	step, ok := totp.Validate(user.TwoFactorSecret, code, time.Now(), totpSkew)
+	if !ok {
+		return false, nil
+	}
+
+	result := r.db(ctx).Model(&models.User{}).
+		Where("id = ? AND two_factor_last_step < ?", user.ID, step).
+		Update("two_factor_last_step", step)
+	if result.Error != nil {
+		return false, result.Error
+	}
+	return result.RowsAffected == 1, nil
+}
+
+// useRecoveryCode redeems one of the user's recovery codes
+func (r *Resolver) useRecoveryCode(ctx context.Context, userID uint, code string) (bool, error) {
+	normalized := normalizeRecoveryCode(code)
+	if normalized == "" {
+		return false, nil
+	}
+
+	result := r.db(ctx).Model(&models.RecoveryCode{}).
+		Where("user_id = ? AND code_hash = ? AND used_at IS NULL", userID, hashToken(normalized)).
+		Update("used_at", time.Now())
+	if result.Error != nil {
+		return false, result.Error
+	}
+	return result.RowsAffected == 1, nil
+}
+
+// issueRecoveryCodes replaces the user's recovery codes and returns the new
+// ones, which are shown to the user once and never again
+func issueRecoveryCodes(tx *gorm.DB, userID uint) ([]string, error) {
+	if err := tx.Where("user_id = ?", userID).Delete(&models.RecoveryCode{}).Error; err != nil {
+		return nil, err
+	}
+
+	codes := make([]string, 0, models.RecoveryCodeCount)
+	records := make([]models.RecoveryCode, 0, models.RecoveryCodeCount)
+	for i := 0; i < models.RecoveryCodeCount; i++ {
+		raw, err := generateSecureToken(5)
+		if err != nil {
+			return nil, err
+		}
+		codes = append(codes, raw[:5]+"-"+raw[5:])
+		records = append(records, models.RecoveryCode{UserID: userID, CodeHash: hashToken(raw)})
+	}
+
+	if err := tx.Create(&records).Error; err != nil {
+		return nil, err
+	}
+	return codes, nil
+}
+
+// normalizeRecoveryCode strips the formatting users may type along with a
+// recovery code
+func normalizeRecoveryCode(code string) string {
+	code = strings.ToLower(strings.TrimSpace(code))
+	return strings.NewReplacer("-", "", " ", "").Replace(code)
+}
+
+// verifySecondFactor checks a code the user entered, counting wrong codes
+// towards the same lockout as wrong passwords
+func (r *Resolver) verifySecondFactor(ctx context.Context, user *models.User, code string) error {
+	if r.isLocked(ctx, user) {
+		return errAccountLocked
+	}
+
+	ok, err := r.checkSecondFactor(ctx, user, code)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		locked, err := r.recordFailedLogin(ctx, user, "wrong two-factor code")
+		if err != nil {
+			return err
+		}
+		if locked {
+			return errAccountLocked
+		}
+		return errInvalidTwoFactorCode
+	}
+
+	locked, err := r.lockedMeanwhile(ctx, user)
+	if err != nil {
+		return err
+	}
+	if locked {
+		return errAccountLocked
+	}
+	return nil
+}
+
+// currentUser loads the authenticated user
+func (r *Resolver) currentUser(ctx context.Context) (*models.User, error) {
+	userID, err := currentUserID(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var user models.User
+	if err := r.db(ctx).First(&user, userID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, fmt.Errorf("user not found")
+		}
+		return nil, err
+	}
+	return &user, nil
+}
@@ -0,0 +1,249 @@
+package resolvers_test
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/99designs/gqlgen/client"
+
+	"crmgo/internal/auth"
+	"crmgo/internal/graphql/resolvers"
+	"crmgo/internal/models"
+	"crmgo/internal/tenant"
+	"crmgo/internal/totp"
+)
+
+// enroll sets up two-factor authentication for the caller of options and
+// returns their secret, the step of the code that confirmed it and their
+// recovery codes
+func enroll(t *testing.T, c *client.Client, options ...client.Option) (string, int64, []string) {
+	t.Helper()
+
+	data, errs := post(t, c, `mutation { beginTwoFactorEnrollment { secret provisioningUri } }`, options...)
+	if len(errs) > 0 {
+		t.Fatalf("begin enrollment: %v", errs)
+	}
+	secret := data["beginTwoFactorEnrollment"].(map[string]interface{})["secret"].(string)
+
+	step := totp.Step(time.Now())
+	data, errs = post(t, c, `mutation($code: String!) { confirmTwoFactorEnrollment(code: $code) }`,
+		append(options, client.Var("code", totpCode(t, secret, step)))...)
+	if len(errs) > 0 {
+		t.Fatalf("confirm enrollment: %v", errs)
+	}
+	var codes []string
+	for _, code := range data["confirmTwoFactorEnrollment"].([]interface{}) {
+		codes = append(codes, code.(string))
+	}
+	return secret, step, codes
+}
+
+func totpCode(t *testing.T, secret string, step int64) string {
+	t.Helper()
+
+	code, err := totp.Code(secret, step)
+	if err != nil {
+		t.Fatalf("totp code: %v", err)
+	}
+	return code
+}
+
+// startLogin signs in with a password and returns the two-factor challenge
+// it is answered with
+func startLogin(t *testing.T, c *client.Client, email, password string) string {
+	t.Helper()
+
+	data, errs := post(t, c, `mutation($input: LoginInput!) { login(input: $input) { token twoFactorRequired challengeToken } }`,
+		client.Var("input", map[string]interface{}{"email": email, "password": password}))
+	if len(errs) > 0 {
+		t.Fatalf("login as %s: %v", email, errs)
+	}
+	result := data["login"].(map[string]interface{})
+	if result["token"] != nil || result["twoFactorRequired"] != true {
+		t.Fatalf("login as %s: %v, want a two-factor challenge instead of a session", email, result)
+	}
+	return result["challengeToken"].(string)
+}
+
+// finishLogin answers a two-factor challenge and returns the access token,
+// or the error message
+func finishLogin(t *testing.T, c *client.Client, challenge, code string) (string, string) {
+	t.Helper()
+
+	data, errs := post(t, c, `mutation($challenge: String!, $code: String!) { verifyTwoFactor(challengeToken: $challenge, code: $code) { token } }`,
+		client.Var("challenge", challenge), client.Var("code", code))
+	if len(errs) > 0 {
+		return "", errs[0].Message
+	}
+	return data["verifyTwoFactor"].(map[string]interface{})["token"].(string), ""
+}
+
+// seedStoredDocument adds a document to deal 1 whose file holds contents
+func seedStoredDocument(t *testing.T, resolver *resolvers.Resolver, contents string) models.Document {
+	t.Helper()
+
+	key := fmt.Sprintf("documents/test-%d", time.Now().UnixNano())
+	if err := resolver.Storage.Put(context.Background(), key, strings.NewReader(contents), "text/plain"); err != nil {
+		t.Fatalf("store file: %v", err)
+	}
+	dealID := uint(1)
+	document := models.Document{Title: "Contract", OrganisationID: 1, DealID: &dealID, StorageKey: &key}
+	db := resolver.DB.WithContext(tenant.WithoutScope(context.Background()))
+	if err := db.Create(&document).Error; err != nil {
+		t.Fatalf("seed document: %v", err)
+	}
+	return document
+}
+
+// download fetches a document the way the application serves it, behind
+// authenticator's Require
+func download(resolver *resolvers.Resolver, authenticator *auth.Authenticator, token string, id uint) *httptest.ResponseRecorder {
+	mux := http.NewServeMux()
+	mux.Handle("/documents/{id}/download", authenticator.Require(resolver.DocumentDownloadHandler()))
+
+	req := httptest.NewRequest(http.MethodGet, fmt.Sprintf("/documents/%d/download", id), nil)
+	req.Header.Set("Authorization", "Bearer "+token)
+	rec := httptest.NewRecorder()
+	mux.ServeHTTP(rec, req)
+	return rec
+}
+
+func TestTwoFactorSignIn(t *testing.T) {
+	_, resolver := newServer(t, 0)
+	seedDeals(t, resolver, 0)
+	authenticator := withSessions(resolver)
+	c := tokenClient(resolver, authenticator)
+	sam := seedMember(t, resolver, "sam@example.com", "correct-horse")
+	db := resolver.DB.WithContext(tenant.WithoutScope(context.Background()))
+
+	token, _ := signIn(t, c, sam.Email, "correct-horse")
+	data, errs := post(t, c, `mutation { beginTwoFactorEnrollment { secret } }`, bearer(token))
+	if len(errs) > 0 {
+		t.Fatalf("begin enrollment: %v", errs)
+	}
+	pending := data["beginTwoFactorEnrollment"].(map[string]interface{})["secret"].(string)
+	wrong := totpCode(t, pending, totp.Step(time.Now())-10)
+	if _, errs := post(t, c, `mutation($code: String!) { confirmTwoFactorEnrollment(code: $code) }`, bearer(token), client.Var("code", wrong)); len(errs) == 0 || errs[0].Message != "invalid two-factor code" {
+		t.Errorf("confirming with a stale code: %v, want a refusal", errs)
+	}
+	if msg := login(t, c, sam.Email, "correct-horse"); msg != "" {
+		t.Errorf("login before enrollment is confirmed: %q", msg)
+	}
+
+	secret, step, recoveryCodes := enroll(t, c, bearer(token))
+	if len(recoveryCodes) != models.RecoveryCodeCount {
+		t.Errorf("%d recovery codes, want %d", len(recoveryCodes), models.RecoveryCodeCount)
+	}
+
+	// A wrong code leaves the challenge open for another try
+	challenge := startLogin(t, c, sam.Email, "correct-horse")
+	if _, msg := finishLogin(t, c, challenge, "000000"); msg != "invalid two-factor code" {
+		t.Errorf("wrong code: %q, want a refusal", msg)
+	}
+	next := totpCode(t, secret, step+1)
+	signedIn, msg := finishLogin(t, c, challenge, next)
+	if msg != "" {
+		t.Fatalf("right code: %q", msg)
+	}
+	if err := authenticate(authenticator, "Bearer "+signedIn); err != nil {
+		t.Errorf("access token from the challenge: %v", err)
+	}
+
+	// The challenge is used up, and each step's code only works once
+	if _, msg := finishLogin(t, c, challenge, totpCode(t, secret, step+1)); !strings.Contains(msg, "sign-in challenge is invalid") {
+		t.Errorf("reusing the challenge: %q, want a refusal", msg)
+	}
+	challenge = startLogin(t, c, sam.Email, "correct-horse")
+	if _, msg := finishLogin(t, c, challenge, next); msg != "invalid two-factor code" {
+		t.Errorf("replayed code: %q, want a refusal", msg)
+	}
+	if _, msg := finishLogin(t, c, challenge, totpCode(t, secret, step)); msg != "invalid two-factor code" {
+		t.Errorf("code from before the last one used: %q, want a refusal", msg)
+	}
+
+	// Recovery codes work once each, however they are typed
+	if _, msg := finishLogin(t, c, challenge, " "+strings.ToUpper(recoveryCodes[0])+" "); msg != "" {
+		t.Errorf("recovery code: %q", msg)
+	}
+	challenge = startLogin(t, c, sam.Email, "correct-horse")
+	if _, msg := finishLogin(t, c, challenge, recoveryCodes[0]); msg != "invalid two-factor code" {
+		t.Errorf("reused recovery code: %q, want a refusal", msg)
+	}
+
+	// Challenges expire
+	if err := db.Model(&models.UserToken{}).Where("user_id = ? AND purpose = ?", sam.ID, models.UserTokenTwoFactorChallenge).
+		Update("expires_at", time.Now().Add(-time.Second)).Error; err != nil {
+		t.Fatalf("expire challenge: %v", err)
+	}
+	if _, msg := finishLogin(t, c, challenge, recoveryCodes[1]); !strings.Contains(msg, "sign-in challenge is invalid") {
+		t.Errorf("expired challenge: %q, want a refusal", msg)
+	}
+	if _, msg := finishLogin(t, c, "made-up", recoveryCodes[1]); !strings.Contains(msg, "sign-in challenge is invalid") {
+		t.Errorf("made-up challenge: %q, want a refusal", msg)
+	}
+}
+
+func TestTwoFactorRequirementHoldsBackMembers(t *testing.T) {
+	admin, resolver := newServer(t, 1)
+	seedDeals(t, resolver, 1)
+	authenticator := withSessions(resolver)
+	c := tokenClient(resolver, authenticator)
+	sam := seedMember(t, resolver, "sam@example.com", "correct-horse")
+	document := seedStoredDocument(t, resolver, "Signed contract")
+
+	if _, errs := post(t, admin, `mutation { setTwoFactorRequirement(required: true) { requireTwoFactor } }`); len(errs) > 0 {
+		t.Fatalf("require two-factor: %v", errs)
+	}
+
+	data, errs := post(t, c, `mutation($input: LoginInput!) { login(input: $input) { token nextStep } }`,
+		client.Var("input", map[string]interface{}{"email": sam.Email, "password": "correct-horse"}))
+	if len(errs) > 0 {
+		t.Fatalf("login: %v", errs)
+	}
+	result := data["login"].(map[string]interface{})
+	if result["nextStep"] != "setup-two-factor" {
+		t.Errorf("login's next step %v, want setup-two-factor", result["nextStep"])
+	}
+	token := result["token"].(string)
+
+	held := func(errs []graphqlError) bool {
+		return len(errs) > 0 && strings.Contains(errs[0].Message, "requires two-factor authentication")
+	}
+	for _, query := range []string{
+		`query { deals { id } }`,
+		`query { me { email } deals { id } }`,
+		`mutation { createContact(input: {name: "Pat"}) { id } }`,
+	} {
+		if _, errs := post(t, c, query, bearer(token)); !held(errs) {
+			t.Errorf("%s before enrolling: %v, want it held back", query, errs)
+		}
+	}
+	if _, errs := post(t, c, `query { me { email } myOrganisations { organisationId } }`, bearer(token)); len(errs) > 0 {
+		t.Errorf("allowed fields before enrolling: %v", errs)
+	}
+	if rec := download(resolver, authenticator, token, document.ID); rec.Code != http.StatusForbidden {
+		t.Errorf("download before enrolling: %d %s, want 403", rec.Code, rec.Body)
+	}
+
+	enroll(t, c, bearer(token))
+	if _, errs := post(t, c, `query { deals { id } }`, bearer(token)); len(errs) > 0 {
+		t.Errorf("deals after enrolling: %v", errs)
+	}
+	if rec := download(resolver, authenticator, token, document.ID); rec.Code != http.StatusOK || rec.Body.String() != "Signed contract" {
+		t.Errorf("download after enrolling: %d %s", rec.Code, rec.Body)
+	}
+
+	// The admin who turned the requirement on is held back too, even from
+	// turning it off again, until they enroll
+	if _, errs := post(t, admin, `query { deals { id } }`); !held(errs) {
+		t.Errorf("admin who has not enrolled: %v, want them held back", errs)
+	}
+	if _, errs := post(t, admin, `mutation { setTwoFactorRequirement(required: false) { requireTwoFactor } }`); !held(errs) {
+		t.Errorf("lifting the requirement without enrolling: %v, want it held back", errs)
+	}
+}
@@ -0,0 +1,105 @@
+package models
+
+import (
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// APIKeyScope limits what an API key may be used for
+type APIKeyScope string
+
+// API key scopes
+const (
+	APIKeyScopeRead  APIKeyScope = "read"  // Run queries
+	APIKeyScopeWrite APIKeyScope = "write" // Run mutations
+	APIKeyScopeAdmin APIKeyScope = "admin" // Act with the owner's administrator role rather than as an agent
+)
+
+// APIKeyScopes lists every valid scope
+var APIKeyScopes = []APIKeyScope{APIKeyScopeRead, APIKeyScopeWrite, APIKeyScopeAdmin}
+
+// IsValid reports whether s is one of the known scopes
+func (s APIKeyScope) IsValid() bool {
+	for _, scope := range APIKeyScopes {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
+
+// MarshalGQL writes the scope as a GraphQL enum value
+func (s APIKeyScope) MarshalGQL(w io.Writer) {
+	fmt.Fprint(w, strconv.Quote(strings.ToUpper(string(s))))
+}
+
+// UnmarshalGQL reads the scope from a GraphQL enum value
+func (s *APIKeyScope) UnmarshalGQL(v interface{}) error {
+	str, ok := v.(string)
+	if !ok {
+		return fmt.Errorf("API key scope must be a string")
+	}
+
+	scope := APIKeyScope(strings.ToLower(str))
+	if !scope.IsValid() {
+		return fmt.Errorf("%q is not a valid API key scope", str)
+	}
+	*s = scope
+	return nil
+}
+
+// APIKey is a personal key a user mints for scripts and integrations. It
+// acts as the user who created it, limited to its scopes. Only a hash of the
+// key is stored; the key itself is shown once when it is created.
+type APIKey struct {
+	ID             uint       `gorm:"primaryKey" json:"id"`
+	UserID         uint       `gorm:"not null;index" json:"user_id"`
+	User           User       `gorm:"foreignKey:UserID" json:"user,omitempty"`
+	OrganisationID *uint      `gorm:"index" json:"organisation_id"` // Organisation the key acts in
+	Name           string     `gorm:"not null" json:"name"`
+	Prefix         string     `gorm:"not null" json:"prefix"` // Start of the key, so users can tell keys apart
+	KeyHash        string     `gorm:"not null;uniqueIndex" json:"-"`
+	Scopes         string     `gorm:"not null" json:"scopes"` // Comma-separated APIKeyScope values
+	LastUsedAt     *time.Time `json:"last_used_at"`
+	ExpiresAt      *time.Time `json:"expires_at"`
+	RevokedAt      *time.Time `json:"revoked_at"`
+	CreatedAt      time.Time  `json:"created_at"`
+	UpdatedAt      time.Time  `json:"updated_at"`
+}
+
+// TableName keeps the table name readable
+func (APIKey) TableName() string {
+	return "api_keys"
+}
+
+// IsActive reports whether the key can still be used
+func (k *APIKey) IsActive() bool {
+	return k.RevokedAt == nil && (k.ExpiresAt == nil || time.Now().Before(*k.ExpiresAt))
+}
+
+// ScopeList returns the key's scopes
+func (k *APIKey) ScopeList() []APIKeyScope {
+	var scopes []APIKeyScope
+	for _, s := range strings.Split(k.Scopes, ",") {
+		if scope := APIKeyScope(strings.TrimSpace(s)); scope.IsValid() {
+			scopes = append(scopes, scope)
+		}
+	}
+	return scopes
+}
+
+// SetScopes stores scopes on the key, dropping duplicates
+func (k *APIKey) SetScopes(scopes []APIKeyScope) {
+	seen := make(map[APIKeyScope]bool)
+	var values []string
+	for _, scope := range scopes {
+		if !seen[scope] {
+			seen[scope] = true
+			values = append(values, string(scope))
+		}
+	}
+	k.Scopes = strings.Join(values, ",")
+}
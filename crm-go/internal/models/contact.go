@@ -18,4 +18,7 @@ type Contact struct {
 	CreatedAt      time.Time      `json:"created_at"`
 	UpdatedAt      time.Time      `json:"updated_at"`
 	DeletedAt      gorm.DeletedAt `gorm:"index" json:"-"`
-}
\ No newline at end of file
+}
+
+// TenantOwned marks contacts as belonging to a single organisation
+func (Contact) TenantOwned() {}
@@ -8,18 +8,26 @@ import (
 
 // Document represents a file or document in the system
 type Document struct {
-	ID          uint           `gorm:"primaryKey" json:"id"`
-	Title       string         `gorm:"not null" json:"title"`
-	FileURL     string         `gorm:"not null" json:"file_url"`
-	FileType    *string        `json:"file_type"`
-	UploadedBy  *uint          `json:"uploaded_by,omitempty"`
-	TeamMember  *TeamMember    `gorm:"foreignKey:UploadedBy" json:"uploader,omitempty"`
-	DealID      *uint          `json:"deal_id,omitempty"`
-	Deal        *Deal          `gorm:"foreignKey:DealID" json:"deal,omitempty"`
-	PropertyID  *uint          `json:"property_id,omitempty"`
-	Property    *Property      `gorm:"foreignKey:PropertyID" json:"property,omitempty"`
-	UploadedAt  time.Time      `gorm:"not null;default:CURRENT_TIMESTAMP" json:"uploaded_at"`
-	CreatedAt   time.Time      `json:"created_at"`
-	UpdatedAt   time.Time      `json:"updated_at"`
-	DeletedAt   gorm.DeletedAt `gorm:"index" json:"-"`
-}
\ No newline at end of file
+	ID             uint           `gorm:"primaryKey" json:"id"`
+	Title          string         `gorm:"not null" json:"title"`
+	OrganisationID uint           `gorm:"index" json:"organisation_id"`
+	FileURL        *string        `json:"file_url,omitempty"` // External link, for documents not held in storage
+	FileType       *string        `json:"file_type"`
+	FileName       *string        `json:"file_name"`
+	FileSize       *int64         `json:"file_size"`
+	Checksum       *string        `json:"checksum"`                 // SHA-256 of the file contents, hex encoded
+	StorageKey     *string        `gorm:"index" json:"storage_key"` // Backend-independent key of the uploaded file in blob storage
+	UploadedBy     *uint          `json:"uploaded_by,omitempty"`
+	TeamMember     *TeamMember    `gorm:"foreignKey:UploadedBy" json:"uploader,omitempty"`
+	DealID         *uint          `json:"deal_id,omitempty"`
+	Deal           *Deal          `gorm:"foreignKey:DealID" json:"deal,omitempty"`
+	PropertyID     *uint          `json:"property_id,omitempty"`
+	Property       *Property      `gorm:"foreignKey:PropertyID" json:"property,omitempty"`
+	UploadedAt     time.Time      `gorm:"not null;default:CURRENT_TIMESTAMP" json:"uploaded_at"`
+	CreatedAt      time.Time      `json:"created_at"`
+	UpdatedAt      time.Time      `json:"updated_at"`
+	DeletedAt      gorm.DeletedAt `gorm:"index" json:"-"`
+}
+
+// TenantOwned marks documents as belonging to a single organisation
+func (Document) TenantOwned() {}
@@ -6,11 +6,23 @@ import (
 	"gorm.io/gorm"
 )
 
-// Invitation represents a team member invitation
+// Invitation statuses
+const (
+	InvitationStatusPending  = "pending"
+	InvitationStatusAccepted = "accepted"
+	InvitationStatusRevoked  = "revoked"
+)
+
+// InvitationTTL is how long an invitation link stays valid
+const InvitationTTL = 7 * 24 * time.Hour
+
+// Invitation represents a team member invitation. Only a hash of the token
+// in the join link is stored.
 type Invitation struct {
 	ID             uint           `gorm:"primaryKey" json:"id"`
 	Email          string         `gorm:"not null" json:"email"`
-	Token          string         `gorm:"not null;unique" json:"token"`
+	TokenHash      string         `gorm:"not null;unique" json:"-"`
+	Role           Role           `gorm:"not null;default:'agent'" json:"role"`
 	TeamMemberID   uint           `gorm:"not null" json:"team_member_id"`
 	TeamMember     TeamMember     `gorm:"foreignKey:TeamMemberID" json:"team_member,omitempty"`
 	OrganisationID uint           `gorm:"not null" json:"organisation_id"`
@@ -23,4 +35,12 @@ type Invitation struct {
 	CreatedAt      time.Time      `json:"created_at"`
 	UpdatedAt      time.Time      `json:"updated_at"`
 	DeletedAt      gorm.DeletedAt `gorm:"index" json:"-"`
-}
\ No newline at end of file
+}
+
+// TenantOwned marks invitations as belonging to a single organisation
+func (Invitation) TenantOwned() {}
+
+// IsExpired reports whether the invitation link has passed its expiry time
+func (i *Invitation) IsExpired() bool {
+	return time.Now().After(i.ExpiresAt)
+}
@@ -0,0 +1,27 @@
+package models
+
+import (
+	"time"
+)
+
+// Login event types
+const (
+	LoginEventSucceeded = "login_succeeded"
+	LoginEventFailed    = "login_failed"
+	LoginEventLocked    = "account_locked"   // The failure that locked the account
+	LoginEventRefused   = "login_refused"    // Attempt rejected without checking the password
+	LoginEventUnlocked  = "account_unlocked" // An administrator lifted a lockout
+)
+
+// LoginEvent records a sign-in attempt or lockout change, so that
+// brute-force attempts can be throttled and attack patterns reviewed
+type LoginEvent struct {
+	ID        uint      `gorm:"primaryKey" json:"id"`
+	Type      string    `gorm:"not null;index" json:"type"`
+	Email     string    `gorm:"index" json:"email"`
+	UserID    *uint     `gorm:"index" json:"user_id"`
+	IPAddress string    `gorm:"index:idx_login_events_ip_created" json:"ip_address"`
+	Reason    string    `json:"reason"`
+	ActorID   *uint     `json:"actor_id"` // The administrator behind an unlock
+	CreatedAt time.Time `gorm:"index:idx_login_events_ip_created" json:"created_at"`
+}
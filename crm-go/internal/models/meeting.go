@@ -17,12 +17,19 @@ type Meeting struct {
 	Title        *string        `json:"title"`
 	Description  *string        `json:"description"`
 	Location     *string        `json:"location"`
+	Status       string         `gorm:"not null;default:'Scheduled'" json:"status"`
 	Notes        []MeetingNotes `gorm:"foreignKey:MeetingID" json:"notes,omitempty"`
 	CreatedAt    time.Time      `json:"created_at"`
 	UpdatedAt    time.Time      `json:"updated_at"`
 	DeletedAt    gorm.DeletedAt `gorm:"index" json:"-"`
 }
 
+// Meeting statuses
+const (
+	MeetingStatusScheduled = "Scheduled"
+	MeetingStatusCancelled = "Cancelled"
+)
+
 // MeetingNotes represents notes taken during a meeting
 type MeetingNotes struct {
 	ID           uint           `gorm:"primaryKey" json:"id"`
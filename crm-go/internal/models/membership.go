@@ -0,0 +1,26 @@
+package models
+
+import (
+	"time"
+)
+
+// Membership is a user's place in an organisation and the role they hold
+// there. A user may belong to several organisations; User.OrganisationID is
+// the one they act in by default, and User.Role their role in it.
+// Memberships span organisations, so they are not tenant owned.
+type Membership struct {
+	ID             uint         `gorm:"primaryKey" json:"id"`
+	UserID         uint         `gorm:"not null;uniqueIndex:idx_membership_user_organisation" json:"user_id"`
+	User           User         `gorm:"foreignKey:UserID" json:"user,omitempty"`
+	OrganisationID uint         `gorm:"not null;uniqueIndex:idx_membership_user_organisation;index" json:"organisation_id"`
+	Organisation   Organisation `gorm:"foreignKey:OrganisationID" json:"organisation,omitempty"`
+	Role           Role         `gorm:"not null;default:'agent'" json:"role"`
+	DeactivatedAt  *time.Time   `json:"deactivated_at"` // Set while the user's team member there is deactivated
+	CreatedAt      time.Time    `json:"created_at"`
+	UpdatedAt      time.Time    `json:"updated_at"`
+}
+
+// IsActive reports whether the user can act in the organisation
+func (m *Membership) IsActive() bool {
+	return m.DeactivatedAt == nil
+}
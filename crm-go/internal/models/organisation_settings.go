@@ -0,0 +1,149 @@
+package models
+
+import (
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// Weekday is a day of the week in an organisation's business hours
+type Weekday string
+
+// Days of the week, starting on Monday
+const (
+	Monday    Weekday = "monday"
+	Tuesday   Weekday = "tuesday"
+	Wednesday Weekday = "wednesday"
+	Thursday  Weekday = "thursday"
+	Friday    Weekday = "friday"
+	Saturday  Weekday = "saturday"
+	Sunday    Weekday = "sunday"
+)
+
+// Weekdays lists every day of the week in order
+var Weekdays = []Weekday{Monday, Tuesday, Wednesday, Thursday, Friday, Saturday, Sunday}
+
+// IsValid reports whether d is one of the days of the week
+func (d Weekday) IsValid() bool {
+	for _, day := range Weekdays {
+		if d == day {
+			return true
+		}
+	}
+	return false
+}
+
+// MarshalGQL writes the day as a GraphQL enum value
+func (d Weekday) MarshalGQL(w io.Writer) {
+	fmt.Fprint(w, strconv.Quote(strings.ToUpper(string(d))))
+}
+
+// UnmarshalGQL reads the day from a GraphQL enum value
+func (d *Weekday) UnmarshalGQL(v interface{}) error {
+	s, ok := v.(string)
+	if !ok {
+		return fmt.Errorf("weekday must be a string")
+	}
+
+	day := Weekday(strings.ToLower(s))
+	if !day.IsValid() {
+		return fmt.Errorf("%q is not a valid weekday", s)
+	}
+	*d = day
+	return nil
+}
+
+// BusinessHours are the opening hours of one day, as 24-hour HH:MM times in
+// the organisation's time zone
+type BusinessHours struct {
+	Day    Weekday `json:"day"`
+	Opens  string  `json:"opens"`
+	Closes string  `json:"closes"`
+}
+
+// DealStage is a stage of an organisation's deal pipeline. Deals in a closed
+// stage are finished and no longer count as anyone's open work.
+type DealStage struct {
+	Name   string `json:"name"`
+	Closed bool   `json:"closed"`
+}
+
+// DefaultBusinessHours are used until an organisation sets its own
+var DefaultBusinessHours = []BusinessHours{
+	{Day: Monday, Opens: "09:00", Closes: "17:00"},
+	{Day: Tuesday, Opens: "09:00", Closes: "17:00"},
+	{Day: Wednesday, Opens: "09:00", Closes: "17:00"},
+	{Day: Thursday, Opens: "09:00", Closes: "17:00"},
+	{Day: Friday, Opens: "09:00", Closes: "17:00"},
+}
+
+// DefaultDealStages are used until an organisation sets its own
+var DefaultDealStages = []DealStage{
+	{Name: DefaultDealStatus},
+	{Name: "Contacted"},
+	{Name: "Viewing"},
+	{Name: "Negotiation"},
+	{Name: DealStatusWon, Closed: true},
+	{Name: DealStatusLost, Closed: true},
+}
+
+// OrganisationSettings are the preferences an organisation works with
+type OrganisationSettings struct {
+	DefaultCurrency string
+	TimeZone        string
+	Locale          string
+	BusinessHours   []BusinessHours
+	DealStages      []DealStage
+}
+
+// Settings returns the organisation's settings, with defaults for any it has
+// not set
+func (o *Organisation) Settings() *OrganisationSettings {
+	settings := &OrganisationSettings{
+		DefaultCurrency: o.DefaultCurrency,
+		TimeZone:        o.TimeZone,
+		Locale:          o.Locale,
+		BusinessHours:   o.BusinessHours,
+		DealStages:      o.DealStages,
+	}
+	if settings.BusinessHours == nil {
+		settings.BusinessHours = DefaultBusinessHours
+	}
+	if len(settings.DealStages) == 0 {
+		settings.DealStages = DefaultDealStages
+	}
+	return settings
+}
+
+// ClosedDealStages returns the names of the organisation's closed deal stages
+func (o *Organisation) ClosedDealStages() []string {
+	var names []string
+	for _, stage := range o.Settings().DealStages {
+		if stage.Closed {
+			names = append(names, stage.Name)
+		}
+	}
+	return names
+}
+
+// DealStage returns the organisation's deal stage called name, ignoring case
+func (o *Organisation) DealStage(name string) (DealStage, bool) {
+	for _, stage := range o.Settings().DealStages {
+		if strings.EqualFold(stage.Name, name) {
+			return stage, true
+		}
+	}
+	return DealStage{}, false
+}
+
+// InitialDealStage returns the name of the stage new deals start in: the
+// first open stage of the organisation's pipeline
+func (o *Organisation) InitialDealStage() string {
+	for _, stage := range o.Settings().DealStages {
+		if !stage.Closed {
+			return stage.Name
+		}
+	}
+	return DefaultDealStatus
+}
@@ -8,14 +8,27 @@ import (
 
 // Organisation represents an organization or company in the system
 type Organisation struct {
-	ID               uint           `gorm:"primaryKey" json:"id"`
-	OrganisationName string         `gorm:"not null" json:"organisation_name"`
-	TeamMembers      []TeamMember   `gorm:"foreignKey:OrganisationID" json:"team_members,omitempty"`
-	Properties       []Property     `gorm:"foreignKey:OrganisationID" json:"properties,omitempty"`
-	Users            []User         `gorm:"foreignKey:OrganisationID" json:"users,omitempty"`
-	Contacts         []Contact      `gorm:"foreignKey:OrganisationID" json:"contacts,omitempty"`
-	Invitations      []Invitation   `gorm:"foreignKey:OrganisationID" json:"invitations,omitempty"`
-	CreatedAt        time.Time      `json:"created_at"`
-	UpdatedAt        time.Time      `json:"updated_at"`
-	DeletedAt        gorm.DeletedAt `gorm:"index" json:"-"`
-}
\ No newline at end of file
+	ID                  uint            `gorm:"primaryKey" json:"id"`
+	OrganisationName    string          `gorm:"not null" json:"organisation_name"`
+	RequireTwoFactor    bool            `gorm:"not null;default:false" json:"require_two_factor"` // Every member must enroll in 2FA
+	DefaultCurrency     string          `gorm:"not null;default:'USD'" json:"default_currency"`   // ISO 4217 code
+	TimeZone            string          `gorm:"not null;default:'UTC'" json:"time_zone"`          // IANA time zone name
+	Locale              string          `gorm:"not null;default:'en-US'" json:"locale"`           // BCP 47 language tag
+	BusinessHours       []BusinessHours `gorm:"serializer:json" json:"business_hours"`            // Days without hours are closed
+	DealStages          []DealStage     `gorm:"serializer:json" json:"deal_stages"`               // Pipeline stages in order
+	DeletionScheduledAt *time.Time      `json:"deletion_scheduled_at"`                            // When a deleted organisation is removed for good
+	TeamMembers         []TeamMember    `gorm:"foreignKey:OrganisationID" json:"team_members,omitempty"`
+	Properties          []Property      `gorm:"foreignKey:OrganisationID" json:"properties,omitempty"`
+	Users               []User          `gorm:"foreignKey:OrganisationID" json:"users,omitempty"`
+	Contacts            []Contact       `gorm:"foreignKey:OrganisationID" json:"contacts,omitempty"`
+	Invitations         []Invitation    `gorm:"foreignKey:OrganisationID" json:"invitations,omitempty"`
+	CreatedAt           time.Time       `json:"created_at"`
+	UpdatedAt           time.Time       `json:"updated_at"`
+	DeletedAt           gorm.DeletedAt  `gorm:"index" json:"-"`
+}
+
+// IsPendingDeletion reports whether the organisation has been deleted and is
+// waiting out the grace period in which it can still be restored
+func (o *Organisation) IsPendingDeletion() bool {
+	return o.DeletionScheduledAt != nil
+}
@@ -21,4 +21,55 @@ type Property struct {
 	CreatedAt      time.Time      `json:"created_at"`
 	UpdatedAt      time.Time      `json:"updated_at"`
 	DeletedAt      gorm.DeletedAt `gorm:"index" json:"-"`
-}
\ No newline at end of file
+}
+
+// TenantOwned marks properties as belonging to a single organisation
+func (Property) TenantOwned() {}
+
+// Property lifecycle statuses
+const (
+	PropertyStatusAvailable  = "Available"
+	PropertyStatusUnderOffer = "Under Offer"
+	PropertyStatusSold       = "Sold"
+	PropertyStatusLeased     = "Leased"
+	PropertyStatusOffMarket  = "Off Market"
+)
+
+// propertyStatusTransitions lists the statuses a property may move to from each status
+var propertyStatusTransitions = map[string][]string{
+	PropertyStatusAvailable:  {PropertyStatusUnderOffer, PropertyStatusSold, PropertyStatusLeased, PropertyStatusOffMarket},
+	PropertyStatusUnderOffer: {PropertyStatusAvailable, PropertyStatusSold, PropertyStatusLeased, PropertyStatusOffMarket},
+	PropertyStatusSold:       {},
+	PropertyStatusLeased:     {PropertyStatusAvailable, PropertyStatusOffMarket},
+	PropertyStatusOffMarket:  {PropertyStatusAvailable},
+}
+
+// PropertyStatuses returns the valid property statuses in lifecycle order
+func PropertyStatuses() []string {
+	return []string{
+		PropertyStatusAvailable,
+		PropertyStatusUnderOffer,
+		PropertyStatusSold,
+		PropertyStatusLeased,
+		PropertyStatusOffMarket,
+	}
+}
+
+// IsValidPropertyStatus checks whether status is part of the property lifecycle
+func IsValidPropertyStatus(status string) bool {
+	_, ok := propertyStatusTransitions[status]
+	return ok
+}
+
+// CanTransitionPropertyStatus checks whether a property may move from one status to another
+func CanTransitionPropertyStatus(from, to string) bool {
+	if from == to {
+		return true
+	}
+	for _, next := range propertyStatusTransitions[from] {
+		if next == to {
+			return true
+		}
+	}
+	return false
+}
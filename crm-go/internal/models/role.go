@@ -0,0 +1,71 @@
+package models
+
+import (
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// Role is a user's level of access within their organisation
+type Role string
+
+// User roles, from most to least privileged
+const (
+	RoleOwner    Role = "owner"
+	RoleAdmin    Role = "admin"
+	RoleAgent    Role = "agent"
+	RoleReadOnly Role = "read_only"
+)
+
+// Roles lists every valid role
+var Roles = []Role{RoleOwner, RoleAdmin, RoleAgent, RoleReadOnly}
+
+// IsValid reports whether r is one of the known roles
+func (r Role) IsValid() bool {
+	for _, role := range Roles {
+		if r == role {
+			return true
+		}
+	}
+	return false
+}
+
+// In reports whether r is one of roles
+func (r Role) In(roles ...Role) bool {
+	for _, role := range roles {
+		if r == role {
+			return true
+		}
+	}
+	return false
+}
+
+// ParseRole converts a GraphQL enum value such as READ_ONLY into a Role
+func ParseRole(s string) (Role, error) {
+	role := Role(strings.ToLower(s))
+	if !role.IsValid() {
+		return "", fmt.Errorf("%q is not a valid role", s)
+	}
+	return role, nil
+}
+
+// MarshalGQL writes the role as a GraphQL enum value
+func (r Role) MarshalGQL(w io.Writer) {
+	fmt.Fprint(w, strconv.Quote(strings.ToUpper(string(r))))
+}
+
+// UnmarshalGQL reads the role from a GraphQL enum value
+func (r *Role) UnmarshalGQL(v interface{}) error {
+	s, ok := v.(string)
+	if !ok {
+		return fmt.Errorf("role must be a string")
+	}
+
+	role, err := ParseRole(s)
+	if err != nil {
+		return err
+	}
+	*r = role
+	return nil
+}
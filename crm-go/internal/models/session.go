@@ -0,0 +1,27 @@
+package models
+
+import (
+	"time"
+)
+
+// Session is a signed-in device or browser. Access tokens carry the session's
+// JTI so they stop working as soon as the session is revoked, and the
+// session's refresh token is rotated every time it is used.
+type Session struct {
+	ID               uint       `gorm:"primaryKey" json:"id"`
+	JTI              string     `gorm:"not null;uniqueIndex" json:"jti"`
+	UserID           uint       `gorm:"not null;index" json:"user_id"`
+	User             User       `gorm:"foreignKey:UserID" json:"user,omitempty"`
+	OrganisationID   *uint      `gorm:"index" json:"organisation_id"` // Organisation the session acts in
+	RefreshTokenHash string     `gorm:"not null" json:"-"`            // SHA-256 of the current refresh token secret
+	ExpiresAt        time.Time  `gorm:"not null" json:"expires_at"`
+	LastUsedAt       *time.Time `json:"last_used_at"`
+	RevokedAt        *time.Time `json:"revoked_at"`
+	CreatedAt        time.Time  `json:"created_at"`
+	UpdatedAt        time.Time  `json:"updated_at"`
+}
+
+// IsActive reports whether the session can still be used
+func (s *Session) IsActive() bool {
+	return s.RevokedAt == nil && time.Now().Before(s.ExpiresAt)
+}
@@ -20,4 +20,32 @@ type Task struct {
 	CreatedAt   time.Time      `json:"created_at"`
 	UpdatedAt   time.Time      `json:"updated_at"`
 	DeletedAt   gorm.DeletedAt `gorm:"index" json:"-"`
-}
\ No newline at end of file
+}
+
+// Task statuses
+const (
+	TaskStatusPending    = "Pending"
+	TaskStatusInProgress = "In Progress"
+	TaskStatusDone       = "Done"
+	TaskStatusCancelled  = "Cancelled"
+)
+
+// TaskStatuses returns the valid task statuses
+func TaskStatuses() []string {
+	return []string{TaskStatusPending, TaskStatusInProgress, TaskStatusDone, TaskStatusCancelled}
+}
+
+// IsValidTaskStatus checks whether status is one of the task statuses
+func IsValidTaskStatus(status string) bool {
+	for _, s := range TaskStatuses() {
+		if s == status {
+			return true
+		}
+	}
+	return false
+}
+
+// IsOpenTaskStatus reports whether a task in this status still needs doing
+func IsOpenTaskStatus(status string) bool {
+	return status != TaskStatusDone && status != TaskStatusCancelled
+}
@@ -9,11 +9,11 @@ import (
 // TeamMember represents a team member within an organization
 type TeamMember struct {
 	ID                 uint           `gorm:"primaryKey" json:"id"`
-	OrganisationID     uint           `gorm:"not null" json:"organisation_id"`
+	OrganisationID     uint           `gorm:"not null;uniqueIndex:idx_team_member_user_organisation" json:"organisation_id"`
 	Organisation       Organisation   `gorm:"foreignKey:OrganisationID" json:"organisation,omitempty"`
 	TeamMemberName     string         `gorm:"not null" json:"team_member_name"`
 	TeamMemberEmailID  string         `gorm:"not null" json:"team_member_email_id"`
-	UserID             *uint          `gorm:"unique" json:"user_id,omitempty"`
+	UserID             *uint          `gorm:"uniqueIndex:idx_team_member_user_organisation" json:"user_id,omitempty"` // A user has one team member per organisation
 	User               *User          `gorm:"foreignKey:UserID" json:"user,omitempty"`
 	Deals              []Deal         `gorm:"foreignKey:AssignedTo" json:"deals,omitempty"`
 	Discussions        []Discussion   `gorm:"foreignKey:TeamMemberID" json:"discussions,omitempty"`
@@ -22,7 +22,16 @@ type TeamMember struct {
 	Tasks              []Task         `gorm:"foreignKey:AssignedTo" json:"tasks,omitempty"`
 	Documents          []Document     `gorm:"foreignKey:UploadedBy" json:"documents,omitempty"`
 	Invitations        []Invitation   `gorm:"foreignKey:TeamMemberID" json:"invitations,omitempty"`
+	DeactivatedAt      *time.Time     `json:"deactivated_at"` // Set when the member leaves; kept so their history stays attributed
 	CreatedAt          time.Time      `json:"created_at"`
 	UpdatedAt          time.Time      `json:"updated_at"`
 	DeletedAt          gorm.DeletedAt `gorm:"index" json:"-"`
-}
\ No newline at end of file
+}
+
+// TenantOwned marks team members as belonging to a single organisation
+func (TeamMember) TenantOwned() {}
+
+// IsActive reports whether the team member can sign in and be assigned work
+func (t *TeamMember) IsActive() bool {
+	return t.DeactivatedAt == nil
+}
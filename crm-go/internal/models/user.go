@@ -9,17 +9,27 @@ import (
 
 // User represents a user account in the system
 type User struct {
-	ID             uint           `gorm:"primaryKey" json:"id"`
-	Email          string         `gorm:"unique;not null" json:"email"`
-	Password       string         `gorm:"not null" json:"-"` // Password is not exposed in JSON
-	Role           string         `gorm:"not null;default:'admin'" json:"role"`
-	OrganisationID *uint          `json:"organisation_id"`
-	Organisation   *Organisation  `gorm:"foreignKey:OrganisationID" json:"organisation,omitempty"`
-	TeamMember     *TeamMember    `gorm:"foreignKey:UserID" json:"team_member,omitempty"`
-	SentInvitations []Invitation  `gorm:"foreignKey:InvitedBy" json:"sent_invitations,omitempty"`
-	CreatedAt      time.Time      `json:"created_at"`
-	UpdatedAt      time.Time      `json:"updated_at"`
-	DeletedAt      gorm.DeletedAt `gorm:"index" json:"-"`
+	ID                 uint           `gorm:"primaryKey" json:"id"`
+	Email              string         `gorm:"unique;not null" json:"email"`
+	Password           string         `gorm:"not null" json:"-"`                    // Password is not exposed in JSON
+	Role               Role           `gorm:"not null;default:'agent'" json:"role"` // Role in the organisation the user acts in; see Membership
+	EmailVerified      bool           `gorm:"not null;default:false" json:"email_verified"`
+	EmailVerifiedAt    *time.Time     `json:"email_verified_at"`
+	TwoFactorEnabled   bool           `gorm:"not null;default:false" json:"two_factor_enabled"`
+	TwoFactorSecret    string         `json:"-"` // Pending until enrollment is confirmed
+	TwoFactorEnabledAt *time.Time     `json:"two_factor_enabled_at"`
+	TwoFactorLastStep  int64          `gorm:"not null;default:0" json:"-"` // Last accepted TOTP step, so a code works once
+	FailedLogins       int            `gorm:"not null;default:0" json:"-"` // Consecutive failed sign-ins
+	LastFailedLogin    *time.Time     `json:"-"`
+	LockedUntil        *time.Time     `json:"locked_until"`
+	OrganisationID     *uint          `json:"organisation_id"` // Organisation the user acts in by default
+	Organisation       *Organisation  `gorm:"foreignKey:OrganisationID" json:"organisation,omitempty"`
+	TeamMember         *TeamMember    `gorm:"foreignKey:UserID" json:"team_member,omitempty"`
+	Memberships        []Membership   `gorm:"foreignKey:UserID" json:"memberships,omitempty"`
+	SentInvitations    []Invitation   `gorm:"foreignKey:InvitedBy" json:"sent_invitations,omitempty"`
+	CreatedAt          time.Time      `json:"created_at"`
+	UpdatedAt          time.Time      `json:"updated_at"`
+	DeletedAt          gorm.DeletedAt `gorm:"index" json:"-"`
 }
 
 // BeforeSave hook - hash the password before saving if it's not already hashed
@@ -44,4 +54,4 @@ func (u *User) ComparePassword(password string) bool {
 func isHashedPassword(password string) bool {
 	// bcrypt hashes start with $2a$ or $2b$
 	return len(password) == 60 && (password[:4] == "$2a$" || password[:4] == "$2b$")
-}
\ No newline at end of file
+}
@@ -0,0 +1,40 @@
+package models
+
+import (
+	"time"
+)
+
+// User token purposes
+const (
+	UserTokenPasswordReset      = "password_reset"
+	UserTokenEmailVerification  = "email_verification"
+	UserTokenTwoFactorChallenge = "two_factor_challenge"
+	UserTokenSSOLogin           = "sso_login"
+)
+
+// PasswordResetTTL is how long a password reset link stays valid
+const PasswordResetTTL = time.Hour
+
+// EmailVerificationTTL is how long an email verification link stays valid
+const EmailVerificationTTL = 48 * time.Hour
+
+// TwoFactorChallengeTTL is how long a user has to enter their second factor
+// after giving the right password
+const TwoFactorChallengeTTL = 5 * time.Minute
+
+// SSOLoginTTL is how long the frontend has to redeem the one-time code it is
+// handed at the end of single sign-on
+const SSOLoginTTL = 2 * time.Minute
+
+// UserToken is a single-use token issued to a user, such as a password
+// reset link or a two-factor sign-in challenge. Only a hash of the token is stored.
+type UserToken struct {
+	ID        uint       `gorm:"primaryKey" json:"id"`
+	UserID    uint       `gorm:"not null;index" json:"user_id"`
+	User      User       `gorm:"foreignKey:UserID" json:"user,omitempty"`
+	Purpose   string     `gorm:"not null;index" json:"purpose"`
+	TokenHash string     `gorm:"not null;uniqueIndex" json:"-"`
+	ExpiresAt time.Time  `gorm:"not null" json:"expires_at"`
+	UsedAt    *time.Time `json:"used_at"`
+	CreatedAt time.Time  `json:"created_at"`
+}
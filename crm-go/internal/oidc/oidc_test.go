@@ -0,0 +1,338 @@
+package oidc
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+const (
+	testClientID     = "crm"
+	testClientSecret = "client-secret"
+	testRedirectURL  = "http://localhost:3001/auth/oidc/callback"
+)
+
+// mockIdP is a minimal OpenID Connect provider: it serves discovery and
+// keys, and redeems codes it was told about for signed ID tokens
+type mockIdP struct {
+	t      *testing.T
+	server *httptest.Server
+	key    *rsa.PrivateKey
+	kid    string
+
+	mu    sync.Mutex
+	codes map[string]mockGrant
+}
+
+// mockGrant is what an authorization code stands for
+type mockGrant struct {
+	challenge string
+	claims    jwt.MapClaims
+}
+
+func newMockIdP(t *testing.T) *mockIdP {
+	t.Helper()
+
+	idp := &mockIdP{t: t, kid: "key-1", codes: make(map[string]mockGrant)}
+	idp.key = newRSAKey(t)
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]string{
+			"issuer":                 idp.server.URL,
+			"authorization_endpoint": idp.server.URL + "/authorize",
+			"token_endpoint":         idp.server.URL + "/token",
+			"jwks_uri":               idp.server.URL + "/jwks",
+		})
+	})
+	mux.HandleFunc("/jwks", func(w http.ResponseWriter, r *http.Request) {
+		idp.mu.Lock()
+		defer idp.mu.Unlock()
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"keys": []map[string]string{{
+				"kty": "RSA",
+				"use": "sig",
+				"kid": idp.kid,
+				"n":   base64.RawURLEncoding.EncodeToString(idp.key.N.Bytes()),
+				"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(idp.key.E)).Bytes()),
+			}},
+		})
+	})
+	mux.HandleFunc("/token", idp.token)
+	idp.server = httptest.NewServer(mux)
+	t.Cleanup(idp.server.Close)
+
+	return idp
+}
+
+// token implements the token endpoint, including the PKCE check
+func (idp *mockIdP) token(w http.ResponseWriter, r *http.Request) {
+	id, secret, ok := r.BasicAuth()
+	if !ok || id != testClientID || secret != testClientSecret {
+		w.WriteHeader(http.StatusUnauthorized)
+		json.NewEncoder(w).Encode(map[string]string{"error": "invalid_client"})
+		return
+	}
+
+	idp.mu.Lock()
+	grant, ok := idp.codes[r.PostFormValue("code")]
+	delete(idp.codes, r.PostFormValue("code"))
+	idp.mu.Unlock()
+
+	if !ok || r.PostFormValue("redirect_uri") != testRedirectURL || CodeChallenge(r.PostFormValue("code_verifier")) != grant.challenge {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]string{"error": "invalid_grant"})
+		return
+	}
+
+	json.NewEncoder(w).Encode(map[string]string{
+		"access_token": "access",
+		"token_type":   "Bearer",
+		"id_token":     idp.sign(grant.claims),
+	})
+}
+
+// authorize stands in for the user signing in: it issues a code for claims
+func (idp *mockIdP) authorize(authURL string, claims jwt.MapClaims) string {
+	u, err := url.Parse(authURL)
+	if err != nil {
+		idp.t.Fatal(err)
+	}
+	query := u.Query()
+	claims["nonce"] = query.Get("nonce")
+
+	idp.mu.Lock()
+	defer idp.mu.Unlock()
+	code := "code-" + query.Get("state")
+	idp.codes[code] = mockGrant{challenge: query.Get("code_challenge"), claims: claims}
+	return code
+}
+
+// sign signs claims with the provider's current key
+func (idp *mockIdP) sign(claims jwt.MapClaims) string {
+	idp.mu.Lock()
+	defer idp.mu.Unlock()
+
+	token := jwt.NewWithClaims(jwt.SigningMethodRS256, claims)
+	token.Header["kid"] = idp.kid
+	signed, err := token.SignedString(idp.key)
+	if err != nil {
+		idp.t.Fatal(err)
+	}
+	return signed
+}
+
+// claims returns valid ID token claims for a user
+func (idp *mockIdP) claims(email string) jwt.MapClaims {
+	now := time.Now()
+	return jwt.MapClaims{
+		"iss":            idp.server.URL,
+		"sub":            "user-" + email,
+		"aud":            testClientID,
+		"iat":            now.Unix(),
+		"exp":            now.Add(5 * time.Minute).Unix(),
+		"email":          email,
+		"email_verified": true,
+		"name":           "Jane Agent",
+	}
+}
+
+func (idp *mockIdP) provider() *Provider {
+	return NewProvider(Config{
+		IssuerURL:    idp.server.URL,
+		ClientID:     testClientID,
+		ClientSecret: testClientSecret,
+		RedirectURL:  testRedirectURL,
+	}, idp.server.Client())
+}
+
+func newRSAKey(t *testing.T) *rsa.PrivateKey {
+	t.Helper()
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return key
+}
+
+func TestAuthorizationCodeFlow(t *testing.T) {
+	idp := newMockIdP(t)
+	provider := idp.provider()
+	ctx := context.Background()
+
+	verifier := "a-code-verifier-that-is-long-enough-for-pkce-0123456789"
+	authURL, err := provider.AuthCodeURL(ctx, "state-1", "nonce-1", CodeChallenge(verifier))
+	if err != nil {
+		t.Fatalf("AuthCodeURL: %v", err)
+	}
+
+	u, _ := url.Parse(authURL)
+	query := u.Query()
+	if !strings.HasPrefix(authURL, idp.server.URL+"/authorize?") {
+		t.Errorf("auth URL %q does not use the discovered endpoint", authURL)
+	}
+	for param, want := range map[string]string{
+		"response_type":         "code",
+		"client_id":             testClientID,
+		"redirect_uri":          testRedirectURL,
+		"state":                 "state-1",
+		"nonce":                 "nonce-1",
+		"code_challenge_method": "S256",
+		"scope":                 "openid email profile",
+	} {
+		if got := query.Get(param); got != want {
+			t.Errorf("auth URL %s = %q, want %q", param, got, want)
+		}
+	}
+
+	code := idp.authorize(authURL, idp.claims("Jane@Acme.com"))
+
+	if _, err := provider.Exchange(ctx, code, "wrong-verifier", "nonce-1"); err == nil {
+		t.Fatal("Exchange accepted a code with the wrong PKCE verifier")
+	}
+
+	code = idp.authorize(authURL, idp.claims("Jane@Acme.com"))
+	claims, err := provider.Exchange(ctx, code, verifier, "nonce-1")
+	if err != nil {
+		t.Fatalf("Exchange: %v", err)
+	}
+	if claims.Email != "jane@acme.com" || !claims.EmailVerified || claims.Subject != "user-Jane@Acme.com" || claims.Name != "Jane Agent" {
+		t.Errorf("unexpected claims %+v", claims)
+	}
+
+	if _, err := provider.Exchange(ctx, code, verifier, "nonce-1"); err == nil {
+		t.Error("Exchange accepted a code twice")
+	}
+}
+
+func TestVerifyIDTokenRejectsInvalidTokens(t *testing.T) {
+	idp := newMockIdP(t)
+	provider := idp.provider()
+	ctx := context.Background()
+
+	valid := func() jwt.MapClaims {
+		claims := idp.claims("jane@acme.com")
+		claims["nonce"] = "nonce-1"
+		return claims
+	}
+	if _, err := provider.VerifyIDToken(ctx, idp.sign(valid()), "nonce-1"); err != nil {
+		t.Fatalf("valid token rejected: %v", err)
+	}
+
+	tests := []struct {
+		name  string
+		token func() string
+	}{
+		{"wrong nonce", func() string {
+			claims := valid()
+			claims["nonce"] = "other"
+			return idp.sign(claims)
+		}},
+		{"wrong audience", func() string {
+			claims := valid()
+			claims["aud"] = "another-app"
+			return idp.sign(claims)
+		}},
+		{"other authorized party", func() string {
+			claims := valid()
+			claims["aud"] = []string{testClientID, "another-app"}
+			claims["azp"] = "another-app"
+			return idp.sign(claims)
+		}},
+		{"wrong issuer", func() string {
+			claims := valid()
+			claims["iss"] = "https://evil.example.com"
+			return idp.sign(claims)
+		}},
+		{"expired", func() string {
+			claims := valid()
+			claims["exp"] = time.Now().Add(-time.Hour).Unix()
+			return idp.sign(claims)
+		}},
+		{"no expiry", func() string {
+			claims := valid()
+			delete(claims, "exp")
+			return idp.sign(claims)
+		}},
+		{"signed with the client secret", func() string {
+			token := jwt.NewWithClaims(jwt.SigningMethodHS256, valid())
+			token.Header["kid"] = idp.kid
+			signed, _ := token.SignedString([]byte(testClientSecret))
+			return signed
+		}},
+		{"signed with an unknown key", func() string {
+			token := jwt.NewWithClaims(jwt.SigningMethodRS256, valid())
+			token.Header["kid"] = idp.kid
+			signed, _ := token.SignedString(newRSAKey(t))
+			return signed
+		}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := provider.VerifyIDToken(ctx, tt.token(), "nonce-1")
+			if !errors.Is(err, ErrInvalidIDToken) {
+				t.Errorf("got %v, want ErrInvalidIDToken", err)
+			}
+		})
+	}
+}
+
+func TestVerifyIDTokenFollowsKeyRotation(t *testing.T) {
+	idp := newMockIdP(t)
+	provider := idp.provider()
+	ctx := context.Background()
+
+	claims := idp.claims("jane@acme.com")
+	claims["nonce"] = "nonce-1"
+	if _, err := provider.VerifyIDToken(ctx, idp.sign(claims), "nonce-1"); err != nil {
+		t.Fatalf("valid token rejected: %v", err)
+	}
+
+	idp.mu.Lock()
+	idp.key, idp.kid = newRSAKey(t), "key-2"
+	idp.mu.Unlock()
+
+	// Unknown key IDs only trigger a refetch once the refresh interval is up
+	if _, err := provider.VerifyIDToken(ctx, idp.sign(claims), "nonce-1"); err == nil {
+		t.Fatal("token with a new key accepted before the keys were refreshed")
+	}
+
+	provider.mu.Lock()
+	provider.keysFetched = time.Now().Add(-keyRefreshInterval)
+	provider.mu.Unlock()
+
+	if _, err := provider.VerifyIDToken(ctx, idp.sign(claims), "nonce-1"); err != nil {
+		t.Fatalf("token with rotated key rejected: %v", err)
+	}
+}
+
+func TestDiscoveryRejectsMismatchedIssuer(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]string{
+			"issuer":                 "https://evil.example.com",
+			"authorization_endpoint": "https://evil.example.com/authorize",
+			"token_endpoint":         "https://evil.example.com/token",
+			"jwks_uri":               "https://evil.example.com/jwks",
+		})
+	}))
+	defer server.Close()
+
+	provider := NewProvider(Config{IssuerURL: server.URL, ClientID: testClientID, RedirectURL: testRedirectURL}, server.Client())
+	if _, err := provider.AuthCodeURL(context.Background(), "s", "n", "c"); err == nil {
+		t.Fatal("discovery accepted a document for another issuer")
+	}
+}
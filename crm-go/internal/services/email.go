@@ -168,6 +168,52 @@ func (s *EmailService) SendInvitationEmail(recipientEmail, recipientName, organi
 	return s.SendEmail(recipients, subject, htmlContent)
 }
 
+// SendPasswordResetEmail sends a password reset link
+func (s *EmailService) SendPasswordResetEmail(recipientEmail, resetURL string) error {
+	recipients := []Recipient{{Email: recipientEmail}}
+
+	subject := "Reset your CRM Dashboard password"
+
+	htmlContent := fmt.Sprintf(`
+		<div style="font-family: Arial, sans-serif; max-width: 600px; margin: 0 auto; padding: 20px;">
+			<h2>Reset your password</h2>
+			<p>We received a request to reset the password for your CRM Dashboard account.</p>
+			<div style="margin: 30px 0;">
+				<a href="%s" style="background-color: #4f46e5; color: white; padding: 12px 24px; text-decoration: none; border-radius: 4px; display: inline-block;">
+					Reset Password
+				</a>
+			</div>
+			<p>This link will expire in 1 hour and can only be used once.</p>
+			<p>If you did not ask to reset your password, you can safely ignore this email.</p>
+		</div>
+	`, resetURL)
+
+	return s.SendEmail(recipients, subject, htmlContent)
+}
+
+// SendVerificationEmail sends a link confirming the recipient owns their email address
+func (s *EmailService) SendVerificationEmail(recipientEmail, verificationURL string) error {
+	recipients := []Recipient{{Email: recipientEmail}}
+
+	subject := "Verify your email address"
+
+	htmlContent := fmt.Sprintf(`
+		<div style="font-family: Arial, sans-serif; max-width: 600px; margin: 0 auto; padding: 20px;">
+			<h2>Verify your email address</h2>
+			<p>Please confirm that this is the email address for your CRM Dashboard account.</p>
+			<div style="margin: 30px 0;">
+				<a href="%s" style="background-color: #4f46e5; color: white; padding: 12px 24px; text-decoration: none; border-radius: 4px; display: inline-block;">
+					Verify Email
+				</a>
+			</div>
+			<p>This link will expire in 48 hours.</p>
+			<p>If you did not create an account, you can safely ignore this email.</p>
+		</div>
+	`, verificationURL)
+
+	return s.SendEmail(recipients, subject, htmlContent)
+}
+
 // Helper function to get the minimum of two integers
 func min(a, b int) int {
 	if a < b {
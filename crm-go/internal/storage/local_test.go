@@ -0,0 +1,88 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestLocalStorePutGetDelete(t *testing.T) {
+	root := t.TempDir()
+	store, err := NewLocalStore(filepath.Join(root, "uploads"))
+	if err != nil {
+		t.Fatalf("new local store: %v", err)
+	}
+	ctx := context.Background()
+	key := "documents/1/abc/report..v2.pdf"
+
+	read := func() string {
+		t.Helper()
+		reader, err := store.Get(ctx, key)
+		if err != nil {
+			t.Fatalf("get: %v", err)
+		}
+		defer reader.Close()
+		content, _ := io.ReadAll(reader)
+		return string(content)
+	}
+
+	if err := store.Put(ctx, key, strings.NewReader("first draft"), "application/pdf"); err != nil {
+		t.Fatalf("put: %v", err)
+	}
+	if got := read(); got != "first draft" {
+		t.Errorf("get returned %q, want the first draft", got)
+	}
+
+	if err := store.Put(ctx, key, strings.NewReader("final"), "application/pdf"); err != nil {
+		t.Fatalf("replace: %v", err)
+	}
+	if got := read(); got != "final" {
+		t.Errorf("get after replacing returned %q, want the final version", got)
+	}
+
+	// Nothing but the blob is left behind in its directory
+	entries, err := os.ReadDir(filepath.Join(root, "uploads", "documents", "1", "abc"))
+	if err != nil || len(entries) != 1 {
+		t.Errorf("blob directory holds %v (%v), want only the blob", entries, err)
+	}
+
+	if err := store.Delete(ctx, key); err != nil {
+		t.Fatalf("delete: %v", err)
+	}
+	if _, err := store.Get(ctx, key); !errors.Is(err, ErrNotFound) {
+		t.Errorf("get after delete: %v, want ErrNotFound", err)
+	}
+	if err := store.Delete(ctx, key); err != nil {
+		t.Errorf("deleting a missing blob: %v", err)
+	}
+}
+
+func TestLocalStoreStaysBelowItsRoot(t *testing.T) {
+	root := t.TempDir()
+	store, err := NewLocalStore(filepath.Join(root, "uploads"))
+	if err != nil {
+		t.Fatalf("new local store: %v", err)
+	}
+
+	if err := store.Put(context.Background(), "../escaped.txt", strings.NewReader("data"), "text/plain"); err == nil {
+		t.Error("put accepted a key escaping the root")
+	}
+	if _, err := os.Stat(filepath.Join(root, "escaped.txt")); !os.IsNotExist(err) {
+		t.Errorf("a file was written outside the root: %v", err)
+	}
+}
+
+func TestLocalStoreHasNoSignedURLs(t *testing.T) {
+	store, err := NewLocalStore(t.TempDir())
+	if err != nil {
+		t.Fatalf("new local store: %v", err)
+	}
+	if _, err := store.SignedURL(context.Background(), "documents/1/abc/report.pdf", time.Minute); !errors.Is(err, ErrSignedURLNotSupported) {
+		t.Errorf("signed URL: %v, want ErrSignedURLNotSupported", err)
+	}
+}
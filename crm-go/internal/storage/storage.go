@@ -0,0 +1,76 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"crmgo/internal/config"
+)
+
+// Supported storage backends
+const (
+	BackendLocal = "local"
+	BackendS3    = "s3"
+)
+
+// ErrNotFound is returned when no blob is stored under a key
+var ErrNotFound = errors.New("blob not found")
+
+// ErrSignedURLNotSupported is returned by backends that cannot hand out
+// direct links, in which case callers should stream the blob themselves
+var ErrSignedURLNotSupported = errors.New("signed URLs are not supported by this storage backend")
+
+// BlobStore stores binary objects under opaque, backend-independent keys
+type BlobStore interface {
+	// Put writes the contents of r under key, replacing any existing blob
+	Put(ctx context.Context, key string, r io.Reader, contentType string) error
+	// Get returns a reader for the blob stored under key
+	Get(ctx context.Context, key string) (io.ReadCloser, error)
+	// Delete removes the blob stored under key; deleting a missing blob is not an error
+	Delete(ctx context.Context, key string) error
+	// SignedURL returns a time-limited URL that grants read access to the blob
+	SignedURL(ctx context.Context, key string, expiry time.Duration) (string, error)
+}
+
+// New creates the blob store selected by the configuration
+func New(cfg *config.Config) (BlobStore, error) {
+	return NewBackend(cfg.StorageBackend, cfg)
+}
+
+// NewBackend creates the named blob store using the settings in the configuration
+func NewBackend(backend string, cfg *config.Config) (BlobStore, error) {
+	switch strings.ToLower(strings.TrimSpace(backend)) {
+	case BackendLocal, "":
+		return NewLocalStore(cfg.UploadDir)
+	case BackendS3:
+		return NewS3Store(S3Options{
+			Endpoint:        cfg.S3Endpoint,
+			Region:          cfg.S3Region,
+			Bucket:          cfg.S3Bucket,
+			AccessKeyID:     cfg.S3AccessKeyID,
+			SecretAccessKey: cfg.S3SecretAccessKey,
+			PathStyle:       cfg.S3PathStyle,
+		})
+	default:
+		return nil, fmt.Errorf("unknown storage backend %q", backend)
+	}
+}
+
+// validateKey rejects empty keys and keys that could escape a key prefix.
+// Keys are slash-separated paths; dots are fine within a segment, as in
+// "report..v2.pdf", but a segment may not be empty, "." or "..".
+func validateKey(key string) error {
+	if strings.Contains(key, `\`) {
+		return fmt.Errorf("invalid storage key %q", key)
+	}
+	for _, segment := range strings.Split(key, "/") {
+		if segment == "" || segment == "." || segment == ".." {
+			return fmt.Errorf("invalid storage key %q", key)
+		}
+	}
+	return nil
+}
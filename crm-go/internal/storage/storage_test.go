@@ -0,0 +1,26 @@
+package storage
+
+import "testing"
+
+func TestValidateKey(t *testing.T) {
+	for _, tc := range []struct {
+		key   string
+		valid bool
+	}{
+		{"documents/1/abc/report.pdf", true},
+		{"documents/1/abc/report..v2.pdf", true},
+		{"documents/1/abc/..hidden", true},
+		{"", false},
+		{"/etc/passwd", false},
+		{"documents/../../etc/passwd", false},
+		{"..", false},
+		{"documents/./report.pdf", false},
+		{"documents//report.pdf", false},
+		{"documents/", false},
+		{`documents\..\report.pdf`, false},
+	} {
+		if err := validateKey(tc.key); (err == nil) != tc.valid {
+			t.Errorf("validateKey(%q) = %v, want valid %v", tc.key, err, tc.valid)
+		}
+	}
+}
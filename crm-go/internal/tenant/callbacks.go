@@ -0,0 +1,204 @@
+package tenant
+
+import (
+	"fmt"
+	"reflect"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"gorm.io/gorm/schema"
+)
+
+// organisationField is the name of the field that ties a model to its organisation
+const organisationField = "OrganisationID"
+
+// Register installs the tenant scoping callbacks on db
+func Register(db *gorm.DB) error {
+	callbacks := db.Callback()
+
+	if err := callbacks.Query().Before("gorm:query").Register("tenant:query", scopeStatement); err != nil {
+		return err
+	}
+	if err := callbacks.Row().Before("gorm:row").Register("tenant:row", scopeStatement); err != nil {
+		return err
+	}
+	if err := callbacks.Delete().Before("gorm:delete").Register("tenant:delete", scopeStatement); err != nil {
+		return err
+	}
+	if err := callbacks.Update().Before("gorm:update").Register("tenant:update", scopeUpdate); err != nil {
+		return err
+	}
+	return callbacks.Create().Before("gorm:create").Register("tenant:create", stampCreate)
+}
+
+// tenantOf returns the organisation field and ID a statement must be scoped
+// to. ok is false when the statement needs no scoping or has already failed.
+func tenantOf(db *gorm.DB) (field *schema.Field, orgID uint, ok bool) {
+	stmt := db.Statement
+	if db.Error != nil || stmt.Schema == nil {
+		return nil, 0, false
+	}
+
+	if _, owned := reflect.New(stmt.Schema.ModelType).Interface().(Owned); !owned {
+		return nil, 0, false
+	}
+	if isUnscoped(stmt.Context) {
+		return nil, 0, false
+	}
+
+	field = stmt.Schema.LookUpField(organisationField)
+	if field == nil {
+		db.AddError(fmt.Errorf("tenant: %s has no %s field", stmt.Schema.Name, organisationField))
+		return nil, 0, false
+	}
+
+	orgID, ok = OrganisationID(stmt.Context)
+	if !ok {
+		db.AddError(ErrNoTenant)
+		return nil, 0, false
+	}
+
+	return field, orgID, true
+}
+
+// scopeStatement restricts a query, row scan or delete to the caller's organisation
+func scopeStatement(db *gorm.DB) {
+	if field, orgID, ok := tenantOf(db); ok {
+		addOrganisationFilter(db.Statement, field, orgID)
+	}
+}
+
+// scopeUpdate restricts an update to the caller's organisation and refuses
+// to reassign a record to a different organisation
+func scopeUpdate(db *gorm.DB) {
+	field, orgID, ok := tenantOf(db)
+	if !ok {
+		return
+	}
+	stmt := db.Statement
+
+	switch dest := stmt.Dest.(type) {
+	case map[string]interface{}:
+		for column, value := range dest {
+			if (column == field.Name || column == field.DBName) && !sameOrganisation(value, orgID) {
+				db.AddError(ErrCrossTenantWrite)
+				return
+			}
+		}
+	default:
+		destValue := reflect.ValueOf(stmt.Dest)
+		if destValue.Kind() == reflect.Ptr && destValue.Elem().Type() == stmt.Schema.ModelType {
+			if !stampRecord(db, field, destValue.Elem(), orgID) {
+				return
+			}
+		}
+	}
+
+	addOrganisationFilter(stmt, field, orgID)
+}
+
+// stampCreate sets the caller's organisation on new records, rejects records
+// aimed at another organisation and keeps upserts from updating rows owned
+// by other organisations
+func stampCreate(db *gorm.DB) {
+	field, orgID, ok := tenantOf(db)
+	if !ok {
+		return
+	}
+	stmt := db.Statement
+
+	switch stmt.ReflectValue.Kind() {
+	case reflect.Slice, reflect.Array:
+		for i := 0; i < stmt.ReflectValue.Len(); i++ {
+			if !stampRecord(db, field, reflect.Indirect(stmt.ReflectValue.Index(i)), orgID) {
+				return
+			}
+		}
+	case reflect.Struct:
+		if !stampRecord(db, field, stmt.ReflectValue, orgID) {
+			return
+		}
+	case reflect.Map:
+		if values, ok := stmt.Dest.(map[string]interface{}); ok {
+			if value, exists := values[field.DBName]; exists && !sameOrganisation(value, orgID) {
+				db.AddError(ErrCrossTenantWrite)
+				return
+			}
+			values[field.DBName] = orgID
+		}
+	}
+
+	if c, ok := stmt.Clauses["ON CONFLICT"]; ok {
+		if onConflict, ok := c.Expression.(clause.OnConflict); ok && !onConflict.DoNothing {
+			onConflict.Where.Exprs = append(onConflict.Where.Exprs, organisationCondition(field, orgID))
+			c.Expression = onConflict
+			stmt.Clauses["ON CONFLICT"] = c
+		}
+	}
+}
+
+// stampRecord fills in an unset organisation on a record, or reports a
+// cross-tenant write if it is set to a different one
+func stampRecord(db *gorm.DB, field *schema.Field, record reflect.Value, orgID uint) bool {
+	if record.Kind() != reflect.Struct {
+		return true
+	}
+
+	value, zero := field.ValueOf(db.Statement.Context, record)
+	if zero {
+		if err := field.Set(db.Statement.Context, record, orgID); err != nil {
+			db.AddError(err)
+			return false
+		}
+		return true
+	}
+
+	if !sameOrganisation(value, orgID) {
+		db.AddError(ErrCrossTenantWrite)
+		return false
+	}
+	return true
+}
+
+// addOrganisationFilter ANDs the organisation condition onto the statement's
+// WHERE clause, grouping any existing conditions so an OR among them cannot
+// widen the result beyond the organisation
+func addOrganisationFilter(stmt *gorm.Statement, field *schema.Field, orgID uint) {
+	condition := organisationCondition(field, orgID)
+
+	if c, ok := stmt.Clauses["WHERE"]; ok {
+		if where, ok := c.Expression.(clause.Where); ok && len(where.Exprs) > 0 {
+			c.Expression = clause.Where{Exprs: []clause.Expression{clause.And(where.Exprs...), condition}}
+			stmt.Clauses["WHERE"] = c
+			return
+		}
+	}
+
+	stmt.AddClause(clause.Where{Exprs: []clause.Expression{condition}})
+}
+
+// organisationCondition matches rows of the statement's table owned by orgID
+func organisationCondition(field *schema.Field, orgID uint) clause.Expression {
+	return clause.Eq{Column: clause.Column{Table: clause.CurrentTable, Name: field.DBName}, Value: orgID}
+}
+
+// sameOrganisation reports whether an organisation ID value of any integer
+// or pointer type equals orgID
+func sameOrganisation(value interface{}, orgID uint) bool {
+	v := reflect.ValueOf(value)
+	for v.Kind() == reflect.Ptr || v.Kind() == reflect.Interface {
+		if v.IsNil() {
+			return false
+		}
+		v = v.Elem()
+	}
+
+	switch v.Kind() {
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return v.Uint() == uint64(orgID)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return v.Int() >= 0 && uint64(v.Int()) == uint64(orgID)
+	default:
+		return false
+	}
+}
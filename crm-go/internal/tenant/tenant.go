@@ -0,0 +1,60 @@
+// Package tenant scopes database access to the organisation making a request.
+//
+// Models that belong to a single organisation implement Owned. Once the
+// callbacks are registered with Register, every query, update and delete on
+// such a model is restricted to the organisation carried by the statement's
+// context, and every insert is stamped with it. Statements on owned models
+// without an organisation in their context fail rather than run unscoped;
+// code that genuinely needs to cross organisations must opt out explicitly
+// with WithoutScope.
+package tenant
+
+import (
+	"context"
+	"errors"
+)
+
+// Owned is implemented by models that belong to exactly one organisation
+// through an organisation_id column
+type Owned interface {
+	TenantOwned()
+}
+
+// ErrNoTenant is returned for statements on tenant-owned models whose
+// context carries no organisation
+var ErrNoTenant = errors.New("tenant: no organisation in context")
+
+// ErrCrossTenantWrite is returned when a write would move a record into, or
+// create it in, an organisation other than the caller's
+var ErrCrossTenantWrite = errors.New("tenant: record belongs to another organisation")
+
+type contextKey int
+
+const (
+	organisationKey contextKey = iota
+	unscopedKey
+)
+
+// WithOrganisation returns a context that scopes database access to orgID
+func WithOrganisation(ctx context.Context, orgID uint) context.Context {
+	return context.WithValue(ctx, organisationKey, orgID)
+}
+
+// OrganisationID returns the organisation the context is scoped to
+func OrganisationID(ctx context.Context) (uint, bool) {
+	orgID, ok := ctx.Value(organisationKey).(uint)
+	return orgID, ok && orgID != 0
+}
+
+// WithoutScope returns a context whose statements are not tenant scoped.
+// It is meant for system work such as looking up an invitation by its token
+// before the caller belongs to any organisation.
+func WithoutScope(ctx context.Context) context.Context {
+	return context.WithValue(ctx, unscopedKey, true)
+}
+
+// isUnscoped reports whether tenant scoping was disabled for the context
+func isUnscoped(ctx context.Context) bool {
+	unscoped, _ := ctx.Value(unscopedKey).(bool)
+	return unscoped
+}
@@ -0,0 +1,269 @@
+package tenant_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"gorm.io/gorm"
+
+	"crmgo/internal/database"
+	"crmgo/internal/models"
+	"crmgo/internal/tenant"
+)
+
+// fixture holds two organisations with one of each tenant-owned record apiece
+type fixture struct {
+	db         *gorm.DB
+	orgA, orgB uint
+	ctxA, ctxB context.Context
+
+	contactB  models.Contact
+	propertyB models.Property
+	dealB     models.Deal
+	documentB models.Document
+}
+
+func newFixture(t *testing.T) *fixture {
+	t.Helper()
+
+	db, err := database.InitDB(":memory:")
+	if err != nil {
+		t.Fatalf("init db: %v", err)
+	}
+
+	system := db.WithContext(tenant.WithoutScope(context.Background()))
+	orgA := models.Organisation{OrganisationName: "Agency A"}
+	orgB := models.Organisation{OrganisationName: "Agency B"}
+	for _, org := range []*models.Organisation{&orgA, &orgB} {
+		if err := system.Create(org).Error; err != nil {
+			t.Fatalf("create organisation: %v", err)
+		}
+	}
+
+	f := &fixture{
+		db:   db,
+		orgA: orgA.ID,
+		orgB: orgB.ID,
+		ctxA: tenant.WithOrganisation(context.Background(), orgA.ID),
+		ctxB: tenant.WithOrganisation(context.Background(), orgB.ID),
+	}
+
+	// Both organisations get records so leaks show up as extra rows
+	for _, ctx := range []context.Context{f.ctxA, f.ctxB} {
+		scoped := db.WithContext(ctx)
+		contact := models.Contact{Name: "Owner"}
+		mustCreate(t, scoped, &contact)
+		property := models.Property{Name: "Flat", OwnerID: &contact.ID}
+		mustCreate(t, scoped, &property)
+		deal := models.Deal{Name: "Sale", PropertyID: &property.ID}
+		mustCreate(t, scoped, &deal)
+		document := models.Document{Title: "Contract", DealID: &deal.ID, PropertyID: &property.ID}
+		mustCreate(t, scoped, &document)
+
+		if ctx == f.ctxB {
+			f.contactB, f.propertyB, f.dealB, f.documentB = contact, property, deal, document
+		}
+	}
+
+	return f
+}
+
+func mustCreate(t *testing.T, db *gorm.DB, value interface{}) {
+	t.Helper()
+	if err := db.Create(value).Error; err != nil {
+		t.Fatalf("create %T: %v", value, err)
+	}
+}
+
+// ownedModels returns a fresh pointer to each tenant-owned model under test,
+// keyed by name, along with the ID of organisation B's record
+func (f *fixture) ownedModels() map[string]struct {
+	model func() interface{}
+	idB   uint
+} {
+	return map[string]struct {
+		model func() interface{}
+		idB   uint
+	}{
+		"contact":  {func() interface{} { return &models.Contact{} }, f.contactB.ID},
+		"property": {func() interface{} { return &models.Property{} }, f.propertyB.ID},
+		"deal":     {func() interface{} { return &models.Deal{} }, f.dealB.ID},
+		"document": {func() interface{} { return &models.Document{} }, f.documentB.ID},
+	}
+}
+
+func TestCreateStampsOrganisation(t *testing.T) {
+	f := newFixture(t)
+
+	if f.contactB.OrganisationID == nil || *f.contactB.OrganisationID != f.orgB {
+		t.Errorf("contact organisation = %v, want %d", f.contactB.OrganisationID, f.orgB)
+	}
+	if f.propertyB.OrganisationID != f.orgB {
+		t.Errorf("property organisation = %d, want %d", f.propertyB.OrganisationID, f.orgB)
+	}
+	if f.dealB.OrganisationID != f.orgB {
+		t.Errorf("deal organisation = %d, want %d", f.dealB.OrganisationID, f.orgB)
+	}
+	if f.documentB.OrganisationID != f.orgB {
+		t.Errorf("document organisation = %d, want %d", f.documentB.OrganisationID, f.orgB)
+	}
+}
+
+func TestCrossTenantReads(t *testing.T) {
+	f := newFixture(t)
+	db := f.db.WithContext(f.ctxA)
+
+	for name, m := range f.ownedModels() {
+		t.Run(name, func(t *testing.T) {
+			if err := db.First(m.model(), m.idB).Error; !errors.Is(err, gorm.ErrRecordNotFound) {
+				t.Errorf("First by ID: got %v, want record not found", err)
+			}
+
+			if err := db.Where("id = ?", m.idB).Take(m.model()).Error; !errors.Is(err, gorm.ErrRecordNotFound) {
+				t.Errorf("Take by ID: got %v, want record not found", err)
+			}
+
+			var count int64
+			if err := db.Model(m.model()).Count(&count).Error; err != nil || count != 1 {
+				t.Errorf("Count: got %d (%v), want 1", count, err)
+			}
+
+			// An OR in the caller's conditions must not widen the scope
+			count = 0
+			if err := db.Model(m.model()).Where("id = ?", m.idB).Or("1 = 1").Count(&count).Error; err != nil || count != 1 {
+				t.Errorf("Count with OR: got %d (%v), want 1", count, err)
+			}
+
+			var ids []uint
+			if err := db.Model(m.model()).Unscoped().Pluck("id", &ids).Error; err != nil || len(ids) != 1 || ids[0] == m.idB {
+				t.Errorf("Unscoped Pluck: got %v (%v), want only organisation A's record", ids, err)
+			}
+		})
+	}
+
+	// Subqueries are scoped as well
+	var documents []models.Document
+	dealIDs := db.Model(&models.Deal{}).Select("id")
+	if err := db.Where("deal_id IN (?)", dealIDs).Find(&documents).Error; err != nil {
+		t.Fatalf("subquery: %v", err)
+	}
+	for _, document := range documents {
+		if document.OrganisationID != f.orgA {
+			t.Errorf("subquery returned document %d of organisation %d", document.ID, document.OrganisationID)
+		}
+	}
+
+	// Preloaded associations cannot reach into another organisation
+	var properties []models.Property
+	if err := f.db.WithContext(f.ctxA).Preload("Deals").Find(&properties).Error; err != nil {
+		t.Fatalf("preload: %v", err)
+	}
+	for _, property := range properties {
+		for _, deal := range property.Deals {
+			if deal.OrganisationID != f.orgA {
+				t.Errorf("preload returned deal %d of organisation %d", deal.ID, deal.OrganisationID)
+			}
+		}
+	}
+}
+
+func TestCrossTenantWrites(t *testing.T) {
+	f := newFixture(t)
+	db := f.db.WithContext(f.ctxA)
+	system := f.db.WithContext(tenant.WithoutScope(context.Background()))
+
+	t.Run("create in another organisation", func(t *testing.T) {
+		orgB := f.orgB
+		if err := db.Create(&models.Contact{Name: "Intruder", OrganisationID: &orgB}).Error; !errors.Is(err, tenant.ErrCrossTenantWrite) {
+			t.Errorf("contact: got %v, want ErrCrossTenantWrite", err)
+		}
+		if err := db.Create(&models.Property{Name: "Intruder", OrganisationID: f.orgB}).Error; !errors.Is(err, tenant.ErrCrossTenantWrite) {
+			t.Errorf("property: got %v, want ErrCrossTenantWrite", err)
+		}
+		if err := db.Create(&models.Deal{Name: "Intruder", OrganisationID: f.orgB}).Error; !errors.Is(err, tenant.ErrCrossTenantWrite) {
+			t.Errorf("deal: got %v, want ErrCrossTenantWrite", err)
+		}
+		if err := db.Create(&models.Document{OrganisationID: f.orgB}).Error; !errors.Is(err, tenant.ErrCrossTenantWrite) {
+			t.Errorf("document: got %v, want ErrCrossTenantWrite", err)
+		}
+	})
+
+	t.Run("update by ID", func(t *testing.T) {
+		for name, m := range f.ownedModels() {
+			result := db.Model(m.model()).Where("id = ?", m.idB).Update("updated_at", gorm.Expr("updated_at"))
+			if result.Error != nil || result.RowsAffected != 0 {
+				t.Errorf("%s: updated %d rows (%v), want 0", name, result.RowsAffected, result.Error)
+			}
+		}
+	})
+
+	t.Run("save another organisation's record", func(t *testing.T) {
+		deal := f.dealB
+		deal.Name = "Hijacked"
+		if err := db.Save(&deal).Error; !errors.Is(err, tenant.ErrCrossTenantWrite) {
+			t.Errorf("Save: got %v, want ErrCrossTenantWrite", err)
+		}
+
+		// A record with the owner cleared would otherwise be stamped and upserted
+		deal.OrganisationID = 0
+		db.Save(&deal)
+
+		var stored models.Deal
+		if err := system.First(&stored, f.dealB.ID).Error; err != nil {
+			t.Fatalf("reload: %v", err)
+		}
+		if stored.Name != f.dealB.Name || stored.OrganisationID != f.orgB {
+			t.Errorf("deal became %q in organisation %d", stored.Name, stored.OrganisationID)
+		}
+	})
+
+	t.Run("move a record to another organisation", func(t *testing.T) {
+		var property models.Property
+		if err := db.First(&property).Error; err != nil {
+			t.Fatalf("load: %v", err)
+		}
+		err := db.Model(&property).Updates(map[string]interface{}{"organisation_id": f.orgB}).Error
+		if !errors.Is(err, tenant.ErrCrossTenantWrite) {
+			t.Errorf("Updates: got %v, want ErrCrossTenantWrite", err)
+		}
+		err = db.Model(&property).Update("organisation_id", f.orgB).Error
+		if !errors.Is(err, tenant.ErrCrossTenantWrite) {
+			t.Errorf("Update: got %v, want ErrCrossTenantWrite", err)
+		}
+	})
+
+	t.Run("delete", func(t *testing.T) {
+		for name, m := range f.ownedModels() {
+			result := db.Delete(m.model(), m.idB)
+			if result.Error != nil || result.RowsAffected != 0 {
+				t.Errorf("%s: deleted %d rows (%v), want 0", name, result.RowsAffected, result.Error)
+			}
+			if err := system.First(m.model(), m.idB).Error; err != nil {
+				t.Errorf("%s: organisation B's record is gone: %v", name, err)
+			}
+		}
+	})
+}
+
+func TestStatementsWithoutTenantFail(t *testing.T) {
+	f := newFixture(t)
+	db := f.db.WithContext(context.Background())
+
+	var deals []models.Deal
+	if err := db.Find(&deals).Error; !errors.Is(err, tenant.ErrNoTenant) {
+		t.Errorf("Find: got %v, want ErrNoTenant", err)
+	}
+	if err := db.Create(&models.Contact{Name: "Orphan"}).Error; !errors.Is(err, tenant.ErrNoTenant) {
+		t.Errorf("Create: got %v, want ErrNoTenant", err)
+	}
+	if err := db.Delete(&models.Property{}, f.propertyB.ID).Error; !errors.Is(err, tenant.ErrNoTenant) {
+		t.Errorf("Delete: got %v, want ErrNoTenant", err)
+	}
+
+	// Models that do not belong to an organisation are unaffected
+	var organisations []models.Organisation
+	if err := db.Find(&organisations).Error; err != nil || len(organisations) != 2 {
+		t.Errorf("organisations: got %d (%v), want 2", len(organisations), err)
+	}
+}
@@ -0,0 +1,96 @@
+package totp
+
+import (
+	"encoding/base32"
+	"testing"
+	"time"
+)
+
+// rfcSecret is the SHA1 key of the RFC 6238 test vectors, "12345678901234567890"
+var rfcSecret = base32.StdEncoding.EncodeToString([]byte("12345678901234567890"))
+
+func TestCodeMatchesRFC6238(t *testing.T) {
+	// RFC 6238 Appendix B gives eight digit codes; six digit codes are their
+	// last six digits
+	tests := []struct {
+		unix int64
+		code string
+	}{
+		{59, "287082"},
+		{1111111109, "081804"},
+		{1111111111, "050471"},
+		{1234567890, "005924"},
+		{2000000000, "279037"},
+		{20000000000, "353130"},
+	}
+	for _, tt := range tests {
+		code, err := Code(rfcSecret, Step(time.Unix(tt.unix, 0)))
+		if err != nil {
+			t.Fatalf("code at %d: %v", tt.unix, err)
+		}
+		if code != tt.code {
+			t.Errorf("code at %d = %s, want %s", tt.unix, code, tt.code)
+		}
+	}
+}
+
+func TestCodeAcceptsSecretsAsTyped(t *testing.T) {
+	want, err := Code(rfcSecret, 1)
+	if err != nil {
+		t.Fatalf("code: %v", err)
+	}
+
+	// Authenticator apps show secrets in lower case and without padding
+	unpadded := encoding.EncodeToString([]byte("12345678901234567890"))
+	for _, secret := range []string{unpadded, " " + unpadded + " ", "gezdgnbvgy3tqojqgezdgnbvgy3tqojq"} {
+		if code, err := Code(secret, 1); err != nil || code != want {
+			t.Errorf("code for secret %q = %s (%v), want %s", secret, code, err, want)
+		}
+	}
+
+	if _, err := Code("not base32!", 1); err == nil {
+		t.Error("code for an invalid secret: want an error")
+	}
+}
+
+func TestValidateAllowsSkew(t *testing.T) {
+	now := time.Unix(1111111111, 0)
+	step := Step(now)
+	codeAt := func(step int64) string {
+		code, err := Code(rfcSecret, step)
+		if err != nil {
+			t.Fatalf("code: %v", err)
+		}
+		return code
+	}
+
+	tests := []struct {
+		name   string
+		code   string
+		skew   int
+		ok     bool
+		wantAt int64
+	}{
+		{"current step", codeAt(step), 1, true, step},
+		{"previous step", codeAt(step - 1), 1, true, step - 1},
+		{"next step", codeAt(step + 1), 1, true, step + 1},
+		{"two steps behind", codeAt(step - 2), 1, false, 0},
+		{"two steps ahead", codeAt(step + 2), 1, false, 0},
+		{"previous step without skew", codeAt(step - 1), 0, false, 0},
+		{"two steps behind with more skew", codeAt(step - 2), 2, true, step - 2},
+		{"spaced out", codeAt(step)[:3] + " " + codeAt(step)[3:], 1, true, step},
+		{"too short", codeAt(step)[:5], 1, false, 0},
+		{"eight digits", "14050471", 1, false, 0},
+		{"empty", "", 1, false, 0},
+	}
+	for _, tt := range tests {
+		got, ok := Validate(rfcSecret, tt.code, now, tt.skew)
+		if ok != tt.ok || got != tt.wantAt {
+			t.Errorf("%s: Validate(%q) = %d, %v, want %d, %v", tt.name, tt.code, got, ok, tt.wantAt, tt.ok)
+		}
+	}
+
+	if _, ok := Validate("not base32!", codeAt(step), now, 1); ok {
+		t.Error("code accepted for an invalid secret")
+	}
+}
@@ -0,0 +1,113 @@
+// lib/authTokens.js
+'use client';
+
+import { graphqlRequest } from './graphqlClient';
+
+// Access tokens only last a few minutes. Signing in also hands out a refresh
+// token, which is exchanged for a new pair shortly before the access token
+// expires, or when the API says the caller is no longer authenticated.
+// Each refresh token works only once, so refreshes are never run in parallel,
+// not even from two tabs.
+
+const REFRESH_TOKEN_MUTATION = `
+  mutation RefreshToken($refreshToken: String!) {
+    refreshToken(refreshToken: $refreshToken) {
+      token
+      refreshToken
+      expiresAt
+    }
+  }
+`;
+
+// Refresh this long before the access token expires
+const REFRESH_MARGIN_MS = 60 * 1000;
+
+let pendingRefresh = null;
+
+// Store the tokens of an AuthResult from login, register or refreshToken
+export function storeTokens({ token, refreshToken, expiresAt }) {
+  if (token) {
+    localStorage.setItem('token', token);
+  }
+  if (refreshToken) {
+    localStorage.setItem('refreshToken', refreshToken);
+  }
+  if (expiresAt) {
+    localStorage.setItem('tokenExpiresAt', expiresAt);
+  }
+}
+
+export function clearTokens() {
+  localStorage.removeItem('token');
+  localStorage.removeItem('refreshToken');
+  localStorage.removeItem('tokenExpiresAt');
+}
+
+export function hasRefreshToken() {
+  return typeof window !== 'undefined' && !!localStorage.getItem('refreshToken');
+}
+
+function expiresSoon() {
+  const expiresAt = Date.parse(localStorage.getItem('tokenExpiresAt') || '');
+  return !Number.isNaN(expiresAt) && expiresAt - Date.now() < REFRESH_MARGIN_MS;
+}
+
+// Whether a GraphQL error means the request was made without a valid token
+export function isAuthenticationError(message = '') {
+  return message.includes('not authenticated');
+}
+
+// Returns an access token to send, refreshing it first if it is about to
+// expire. Returns null when signed out.
+export async function getAccessToken() {
+  if (typeof window === 'undefined') {
+    return null;
+  }
+
+  const token = localStorage.getItem('token');
+  if (token && !expiresSoon()) {
+    return token;
+  }
+  if (!hasRefreshToken()) {
+    return token;
+  }
+  return refreshAccessToken();
+}
+
+// Exchanges the refresh token for a new access token and returns it, or null
+// when the session has ended and the user must sign in again
+export function refreshAccessToken() {
+  if (!pendingRefresh) {
+    const staleToken = localStorage.getItem('token');
+    const run = () => refresh(staleToken);
+    const refreshing = navigator.locks ? navigator.locks.request('crm-token-refresh', run) : run();
+    pendingRefresh = refreshing.finally(() => {
+      pendingRefresh = null;
+    });
+  }
+  return pendingRefresh;
+}
+
+async function refresh(staleToken) {
+  // Another tab may have refreshed while this one waited for the lock
+  const current = localStorage.getItem('token');
+  if (current && current !== staleToken && !expiresSoon()) {
+    return current;
+  }
+
+  const refreshToken = localStorage.getItem('refreshToken');
+  if (!refreshToken) {
+    return null;
+  }
+
+  try {
+    const data = await graphqlRequest(REFRESH_TOKEN_MUTATION, { refreshToken });
+    storeTokens(data.refreshToken);
+    return data.refreshToken.token;
+  } catch (err) {
+    // The session was revoked or has expired
+    console.error('Token refresh error:', err);
+    clearTokens();
+    return null;
+  }
+}
@@ -50,6 +50,8 @@ export const LOGIN_MUTATION = `
   mutation Login($input: LoginInput!) {
     login(input: $input) {
       token
+      refreshToken
+      expiresAt
       user {
         id
         email
@@ -75,6 +77,8 @@ export const REGISTER_MUTATION = `
   mutation Register($input: RegisterInput!) {
     register(input: $input) {
       token
+      refreshToken
+      expiresAt
       user {
         id
         email